@@ -0,0 +1,133 @@
+// Package backup saves the running and startup configs of devices to a versioned Store, leaving out
+// the lines that change without the config changing, like timestamps:
+//
+//	store, _ := backup.Open("backups")
+//	report := backup.Run(ctx, m, nil, store, backup.Options{Startup: true, Message: "nightly"})
+//	versions, _ := store.List("core1", backup.Running)
+//	diff, _ := store.Diff("core1", backup.Running, 1, 2)
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/morganhein/gondi"
+	"github.com/morganhein/gondi/interaction"
+	"github.com/morganhein/gondi/logger"
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/transport"
+)
+
+var log schema.Logger
+
+func init() {
+	log = logger.Log
+}
+
+// Volatile matches the lines Strip leaves out, which change without the config changing.
+var Volatile = []*regexp.Regexp{
+	regexp.MustCompile(`^Building configuration`),
+	regexp.MustCompile(`^Current configuration ?:`),
+	regexp.MustCompile(`^!+ ?(Last configuration change|NVRAM config last updated) at `),
+	regexp.MustCompile(`^!Time: `),
+	regexp.MustCompile(`^ntp clock-period `),
+	regexp.MustCompile(`^## Last (commit|changed): `),
+	regexp.MustCompile(`^\S+ uptime is `),
+	// the time IOS XR prints before its config, ie "Tue Mar  8 14:02:11.123 UTC"
+	regexp.MustCompile(`^(Mon|Tue|Wed|Thu|Fri|Sat|Sun) [A-Z][a-z]{2} +\d+ \d\d:\d\d:\d\d`),
+}
+
+// Strip leaves out the Volatile lines of the config, and the blank lines they leave at its start.
+func Strip(config string) string {
+	var kept []string
+	for _, line := range strings.Split(strings.Replace(config, "\r\n", "\n", -1), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if volatile(line) || (len(kept) == 0 && line == "") {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	for len(kept) > 0 && kept[len(kept)-1] == "" {
+		kept = kept[:len(kept)-1]
+	}
+	if len(kept) == 0 {
+		return ""
+	}
+	return strings.Join(kept, "\n") + "\n"
+}
+
+func volatile(line string) bool {
+	for _, r := range Volatile {
+		if r.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// Options tune Run.
+type Options struct {
+	Startup bool   // also back up the startup configs, of the platforms that have them
+	Author  string // recorded with each version
+	Message string // recorded with each version, ie "nightly"
+	Run     gondi.RunOptions
+}
+
+// Run backs up the running config of every device in ids, or of every registered device if ids is empty,
+// and their startup configs if options.Startup is set. The output of each device's result lists the
+// versions saved, ie "running v3 6f1c2a90", with "(unchanged)" when the config was already the latest.
+func Run(ctx context.Context, m *gondi.Manager, ids []string, store *Store, options Options) *gondi.Report {
+	job := gondi.Job{
+		Command: "backup",
+		Run: func(ctx context.Context, device schema.Device) ([]string, error) {
+			return backup(ctx, gondi.DeviceID(ctx), device, store, options)
+		},
+	}
+	return m.RunAll(ctx, ids, job, options.Run)
+}
+
+// backup saves the configs of a single device, giving up on it once ctx is cancelled
+func backup(ctx context.Context, id string, device schema.Device, store *Store, options Options) ([]string, error) {
+	platform := schema.DeviceType(transport.Generic)
+	if p, ok := device.(interface{ Platform() schema.DeviceType }); ok {
+		platform = p.Platform()
+	}
+	d := interaction.Wrap(platform, device)
+	meta := Metadata{Author: options.Author, Message: options.Message, Time: time.Now()}
+	running, err := d.ShowConfigContext(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to show the running config: %s", err)
+	}
+	v, changed, err := store.Save(id, Running, Strip(running), meta)
+	if err != nil {
+		return nil, err
+	}
+	saved := []string{describe(v, changed)}
+	if !options.Startup {
+		return saved, nil
+	}
+	startup, err := d.ShowStartupConfigContext(ctx)
+	if errors.Is(err, interaction.ErrNoStartupConfig) {
+		log.Debugf("%s has no startup config to back up.", id)
+		return saved, nil
+	}
+	if err != nil {
+		return saved, fmt.Errorf("Unable to show the startup config: %s", err)
+	}
+	if v, changed, err = store.Save(id, Startup, Strip(startup), meta); err != nil {
+		return saved, err
+	}
+	return append(saved, describe(v, changed)), nil
+}
+
+func describe(v Version, changed bool) string {
+	s := fmt.Sprintf("%s v%d %s", v.Kind, v.Number, v.Hash[:8])
+	if !changed {
+		s += " (unchanged)"
+	}
+	return s
+}
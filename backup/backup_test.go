@@ -0,0 +1,140 @@
+package backup
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/morganhein/gondi"
+	"github.com/morganhein/gondi/gondisim"
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrip(t *testing.T) {
+	config := "Building configuration...\r\n\r\nCurrent configuration : 1312 bytes\r\n!\r\n" +
+		"! Last configuration change at 14:02:11 UTC Tue Mar 8 2022 by admin\r\n" +
+		"! NVRAM config last updated at 14:02:15 UTC Tue Mar 8 2022 by admin\r\n" +
+		"!\r\nhostname access1\r\n!\r\nntp clock-period 36029056\r\nntp server 10.0.0.1\r\n!\r\nend\r\n\r\n"
+	assert.Equal(t, "!\n!\nhostname access1\n!\nntp server 10.0.0.1\n!\nend\n", Strip(config))
+
+	assert.Equal(t, "!! IOS XR Configuration 6.1.4\nhostname core1\n", Strip("Tue Mar  8 14:02:11.123 UTC\n"+
+		"Building configuration...\n!! IOS XR Configuration 6.1.4\n"+
+		"!! Last configuration change at Tue Mar  8 14:02:11 2022 by admin\nhostname core1\n"))
+	assert.Equal(t, "version 19.4R3-S2.2;\n", Strip("## Last commit: 2022-03-08 14:02:11 UTC by admin\n"+
+		"version 19.4R3-S2.2;\n"))
+	assert.Empty(t, Strip("Building configuration...\n\n"))
+}
+
+func startDevice(t *testing.T, platform string, startup string) *gondisim.Server {
+	var outputs map[string]string
+	if startup != "" {
+		outputs = map[string]string{"show startup-config": startup}
+	}
+	sim, err := gondisim.NewTelnet(platform, gondisim.WithOutputs(outputs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sim.Close() })
+	return sim
+}
+
+func register(t *testing.T, m *gondi.Manager, id string, platform schema.DeviceType, sim *gondisim.Server) {
+	assert.NoError(t, m.Register(gondi.DeviceConfig{
+		ID:       id,
+		Platform: platform,
+		Methods:  []schema.ConnectionMethod{transport.Telnet},
+		Options: schema.ConnectOptions{
+			Host:           sim.Host(),
+			Port:           sim.Port(),
+			Username:       sim.Username,
+			Password:       sim.Password,
+			EnablePassword: sim.EnablePassword,
+		},
+	}))
+}
+
+func TestRun(t *testing.T) {
+	access := startDevice(t, "cisco_ios", "hostname access1\n!\nend")
+	edge := startDevice(t, string(transport.Juniper), "")
+	m := gondi.NewG()
+	defer m.Shutdown()
+	register(t, m, "access1", transport.Cisco, access)
+	register(t, m, "edge1", transport.Juniper, edge)
+	store, err := Open(t.TempDir())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	report := Run(context.Background(), m, nil, store, Options{Startup: true, Message: "nightly"})
+	assert.Equal(t, 2, report.Succeeded())
+	for _, result := range report.Results {
+		assert.NoError(t, result.Err, result.DeviceID)
+		switch result.DeviceID {
+		case "access1":
+			if assert.Len(t, result.Output, 2) {
+				assert.True(t, strings.HasPrefix(result.Output[0], "running v1 "))
+				assert.True(t, strings.HasPrefix(result.Output[1], "startup v1 "))
+			}
+		case "edge1":
+			// Junos has no startup config
+			assert.Len(t, result.Output, 1)
+		}
+	}
+
+	config, v, err := store.Get("access1", Running, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "nightly", v.Message)
+	assert.True(t, strings.HasPrefix(config, "!\n!\nversion 15.2\n"), config)
+	assert.NotContains(t, config, "ntp clock-period")
+	assert.NotContains(t, config, "access1>")
+	config, _, err = store.Get("access1", Startup, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "hostname access1\n!\nend\n", config)
+	config, _, err = store.Get("edge1", Running, 0)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(config, "version 19.4R3-S2.2;\nsystem {\n"), config)
+
+	// nothing changed, so nothing new is saved
+	report = Run(context.Background(), m, []string{"access1"}, store, Options{})
+	if assert.Len(t, report.Results, 1) && assert.NoError(t, report.Results[0].Err) {
+		assert.Contains(t, report.Results[0].Output[0], "(unchanged)")
+	}
+	versions, _ := store.List("access1", "")
+	assert.Len(t, versions, 2)
+}
+
+func TestRun_Timeout(t *testing.T) {
+	// the config never finishes, so only the timeout ends the backup
+	sim, err := gondisim.NewTelnet("cisco_ios", gondisim.WithHandler(func(command string, term gondisim.Terminal) bool {
+		if command != "show running-config" {
+			return false
+		}
+		term.Print("Building configuration...")
+		term.Ask("")
+		return true
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	m := gondi.NewG()
+	defer m.Shutdown()
+	register(t, m, "access1", transport.Cisco, sim)
+	store, err := Open(t.TempDir())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	start := time.Now()
+	report := Run(context.Background(), m, nil, store, Options{Run: gondi.RunOptions{Timeout: time.Second}})
+	if assert.Len(t, report.Results, 1) {
+		assert.Error(t, report.Results[0].Err)
+	}
+	// well before the 10s the session waits for a prompt
+	assert.True(t, time.Since(start) < 5*time.Second, time.Since(start).String())
+	versions, _ := store.List("access1", "")
+	assert.Empty(t, versions)
+}
@@ -0,0 +1,146 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines shown around each change of a diff
+const contextLines = 3
+
+// edit is a line of a diff: kept (' '), removed ('-') or added ('+'), with the number of lines of
+// the old and new configs before it
+type edit struct {
+	op   byte
+	line string
+	a, b int
+}
+
+// lines splits the config into its lines, without the newline that ends the last
+func lines(config string) []string {
+	if config == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(config, "\n"), "\n")
+}
+
+// edits returns the shortest list of edits turning a into b, using Myers' algorithm.
+func edits(a, b []string) []edit {
+	n, m := len(a), len(b)
+	max := n + m
+	v := make([]int, 2*max+2)
+	var trace [][]int
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[max+k-1] < v[max+k+1]) {
+				x = v[max+k+1]
+			} else {
+				x = v[max+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[max+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+	// walk back through the furthest points reached, from the end
+	var reversed []edit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		prev := k - 1
+		if k == -d || (k != d && v[max+k-1] < v[max+k+1]) {
+			prev = k + 1
+		}
+		px := v[max+prev]
+		py := px - prev
+		for x > px && y > py {
+			x--
+			y--
+			reversed = append(reversed, edit{' ', a[x], x, y})
+		}
+		if d == 0 {
+			break
+		}
+		if x == px {
+			y--
+			reversed = append(reversed, edit{'+', b[y], x, y})
+		} else {
+			x--
+			reversed = append(reversed, edit{'-', a[x], x, y})
+		}
+	}
+	result := make([]edit, len(reversed))
+	for i, e := range reversed {
+		result[len(reversed)-1-i] = e
+	}
+	return result
+}
+
+// unified renders the changes from a to b as a unified diff, or nothing if there are none
+func unified(a, b []string, from, to string) string {
+	es := edits(a, b)
+	// the ranges of edits shown, each change with the lines around it
+	var hunks [][2]int
+	for i, e := range es {
+		if e.op == ' ' {
+			continue
+		}
+		start, end := i-contextLines, i+contextLines+1
+		if start < 0 {
+			start = 0
+		}
+		if end > len(es) {
+			end = len(es)
+		}
+		if len(hunks) > 0 && start <= hunks[len(hunks)-1][1] {
+			hunks[len(hunks)-1][1] = end
+		} else {
+			hunks = append(hunks, [2]int{start, end})
+		}
+	}
+	if len(hunks) == 0 {
+		return ""
+	}
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", from, to)
+	for _, h := range hunks {
+		var before, after int
+		for _, e := range es[h[0]:h[1]] {
+			if e.op != '+' {
+				before++
+			}
+			if e.op != '-' {
+				after++
+			}
+		}
+		first := es[h[0]]
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", span(first.a, before), span(first.b, after))
+		for _, e := range es[h[0]:h[1]] {
+			out.WriteByte(e.op)
+			out.WriteString(e.line)
+			out.WriteByte('\n')
+		}
+	}
+	return out.String()
+}
+
+// span is the range of lines of a hunk, numbered from 1, ie "4,7"
+func span(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
@@ -0,0 +1,273 @@
+package backup
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kind is the config a version is of.
+type Kind string
+
+// The kinds of config backed up
+const (
+	Running Kind = "running"
+	Startup Kind = "startup"
+)
+
+// ErrNoVersion is returned for versions that were never saved.
+var ErrNoVersion = errors.New("The version does not exist.")
+
+// Metadata is recorded with each version.
+type Metadata struct {
+	Author  string
+	Message string
+	Time    time.Time // now if zero
+}
+
+// Version is a config of a device as it was saved.
+type Version struct {
+	Device  string    `json:"device"`
+	Kind    Kind      `json:"kind"`
+	Number  int       `json:"number"` // 1 for the first version of the device's kind of config
+	Hash    string    `json:"hash"`   // the SHA-256 of the config, which is also where it's stored
+	Size    int       `json:"size"`
+	Time    time.Time `json:"time"`
+	Author  string    `json:"author,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+// Store keeps the versions of each device's configs in a directory, as
+//
+//	objects/<hash>          each config, stored once however many versions share it
+//	versions/<device>.json  the versions of the device's configs, one JSON object per line, oldest first
+//
+// A new version is only recorded when the config differs from the latest of its kind.
+// A Store is safe for concurrent use, but only by a single process.
+type Store struct {
+	dir string
+	mut sync.Mutex
+}
+
+// Open opens the store in the directory, creating it if needed.
+func Open(dir string) (*Store, error) {
+	for _, d := range []string{"objects", "versions"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0700); err != nil {
+			return nil, fmt.Errorf("Unable to create the backup store: %s", err)
+		}
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Save records the config as the next version of the device's kind of config, returning false and the
+// latest version instead if the config hasn't changed since.
+func (s *Store) Save(device string, kind Kind, config string, meta Metadata) (version Version, changed bool, err error) {
+	if device == "" {
+		return Version{}, false, errors.New("A backup requires a device.")
+	}
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	versions, err := s.versions(device)
+	if err != nil {
+		return Version{}, false, err
+	}
+	sum := sha256.Sum256([]byte(config))
+	version = Version{
+		Device:  device,
+		Kind:    kind,
+		Number:  1,
+		Hash:    hex.EncodeToString(sum[:]),
+		Size:    len(config),
+		Time:    meta.Time,
+		Author:  meta.Author,
+		Message: meta.Message,
+	}
+	if version.Time.IsZero() {
+		version.Time = time.Now()
+	}
+	if latest, ok := last(versions, kind); ok {
+		if latest.Hash == version.Hash {
+			return latest, false, nil
+		}
+		version.Number = latest.Number + 1
+	}
+	if err := s.write(version.Hash, config); err != nil {
+		return Version{}, false, err
+	}
+	line, err := json.Marshal(version)
+	if err != nil {
+		return Version{}, false, err
+	}
+	f, err := os.OpenFile(s.log(device), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return Version{}, false, fmt.Errorf("Unable to record the version: %s", err)
+	}
+	if _, err = f.Write(append(line, '\n')); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return Version{}, false, fmt.Errorf("Unable to record the version: %s", err)
+	}
+	return version, true, nil
+}
+
+// List returns the versions of the device's kind of config, or of all its configs if kind is empty,
+// oldest first.
+func (s *Store) List(device string, kind Kind) ([]Version, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	versions, err := s.versions(device)
+	if err != nil {
+		return nil, err
+	}
+	if kind == "" {
+		return versions, nil
+	}
+	var listed []Version
+	for _, v := range versions {
+		if v.Kind == kind {
+			listed = append(listed, v)
+		}
+	}
+	return listed, nil
+}
+
+// Get returns the config of a version, and its details. Version 0 is the latest.
+func (s *Store) Get(device string, kind Kind, number int) (string, Version, error) {
+	versions, err := s.List(device, kind)
+	if err != nil {
+		return "", Version{}, err
+	}
+	var version Version
+	switch {
+	case len(versions) == 0 || number < 0 || number > len(versions):
+		return "", Version{}, ErrNoVersion
+	case number == 0:
+		version = versions[len(versions)-1]
+	default:
+		version = versions[number-1]
+	}
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, "objects", version.Hash))
+	if err != nil {
+		return "", Version{}, fmt.Errorf("Unable to read version %d: %s", version.Number, err)
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != version.Hash {
+		return "", Version{}, fmt.Errorf("Version %d of %s is corrupt.", version.Number, device)
+	}
+	return string(data), version, nil
+}
+
+// Diff returns the changes from one version of the device's kind of config to another as a unified diff,
+// which is empty if they are the same. Version 0 is the latest.
+func (s *Store) Diff(device string, kind Kind, from, to int) (string, error) {
+	a, va, err := s.Get(device, kind, from)
+	if err != nil {
+		return "", err
+	}
+	b, vb, err := s.Get(device, kind, to)
+	if err != nil {
+		return "", err
+	}
+	label := func(v Version) string {
+		return fmt.Sprintf("%s %s v%d\t%s", device, kind, v.Number, v.Time.Format(time.RFC3339))
+	}
+	return unified(lines(a), lines(b), label(va), label(vb)), nil
+}
+
+// Devices returns the devices with saved versions, sorted.
+func (s *Store) Devices() ([]string, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(s.dir, "versions"))
+	if err != nil {
+		return nil, err
+	}
+	var devices []string
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".json")
+		if e.IsDir() || name == e.Name() {
+			continue
+		}
+		if device, err := url.PathUnescape(name); err == nil {
+			devices = append(devices, device)
+		}
+	}
+	sort.Strings(devices)
+	return devices, nil
+}
+
+// log returns the file the versions of the device are recorded in
+func (s *Store) log(device string) string {
+	return filepath.Join(s.dir, "versions", url.PathEscape(device)+".json")
+}
+
+// versions reads the versions of the device, oldest first
+func (s *Store) versions(device string) ([]Version, error) {
+	f, err := os.Open(s.log(device))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var versions []Version
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var v Version
+		if err := json.Unmarshal(scanner.Bytes(), &v); err != nil {
+			return nil, fmt.Errorf("Unable to read the versions of %s: %s", device, err)
+		}
+		versions = append(versions, v)
+	}
+	return versions, scanner.Err()
+}
+
+// write stores the config under its hash, unless it already is
+func (s *Store) write(hash, config string) error {
+	file := filepath.Join(s.dir, "objects", hash)
+	if _, err := os.Stat(file); err == nil {
+		return nil
+	}
+	f, err := ioutil.TempFile(filepath.Dir(file), "."+hash)
+	if err != nil {
+		return fmt.Errorf("Unable to store the config: %s", err)
+	}
+	_, err = f.WriteString(config)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), file)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("Unable to store the config: %s", err)
+	}
+	return nil
+}
+
+// last returns the latest version of the kind
+func last(versions []Version, kind Kind) (Version, bool) {
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].Kind == kind {
+			return versions[i], true
+		}
+	}
+	return Version{}, false
+}
@@ -0,0 +1,115 @@
+package backup
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if !assert.NoError(t, err) {
+		return
+	}
+	first := "hostname core1\ninterface Loopback0\n ip address 10.255.0.1 255.255.255.255\n"
+	second := strings.Replace(first, "10.255.0.1", "10.255.0.2", 1)
+	at := time.Date(2022, 3, 8, 14, 2, 11, 0, time.UTC)
+
+	v1, changed, err := s.Save("core1", Running, first, Metadata{Author: "ops", Message: "nightly", Time: at})
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, 1, v1.Number)
+	assert.Equal(t, "ops", v1.Author)
+
+	// an unchanged config isn't a new version
+	same, changed, err := s.Save("core1", Running, first, Metadata{})
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, v1, same)
+
+	v2, changed, err := s.Save("core1", Running, second, Metadata{Time: at.Add(time.Hour)})
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, 2, v2.Number)
+
+	// the kinds are numbered apart, and share the stored configs
+	s1, _, err := s.Save("core1", Startup, first, Metadata{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, s1.Number)
+	assert.Equal(t, v1.Hash, s1.Hash)
+	objects, _ := ioutil.ReadDir(filepath.Join(dir, "objects"))
+	assert.Len(t, objects, 2)
+
+	versions, err := s.List("core1", Running)
+	assert.NoError(t, err)
+	assert.Equal(t, []Version{v1, v2}, versions)
+	all, err := s.List("core1", "")
+	assert.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	config, v, err := s.Get("core1", Running, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, second, config)
+	assert.Equal(t, v2, v)
+	config, _, err = s.Get("core1", Running, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, first, config)
+	_, _, err = s.Get("core1", Running, 3)
+	assert.Equal(t, ErrNoVersion, err)
+	_, _, err = s.Get("edge1", Running, 0)
+	assert.Equal(t, ErrNoVersion, err)
+
+	diff, err := s.Diff("core1", Running, 1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "--- core1 running v1\t2022-03-08T14:02:11Z\n"+
+		"+++ core1 running v2\t2022-03-08T15:02:11Z\n"+
+		"@@ -1,3 +1,3 @@\n"+
+		" hostname core1\n"+
+		" interface Loopback0\n"+
+		"- ip address 10.255.0.1 255.255.255.255\n"+
+		"+ ip address 10.255.0.2 255.255.255.255\n", diff)
+	diff, err = s.Diff("core1", Running, 2, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, diff)
+
+	// the store can be reopened, and names devices safely
+	_, _, err = s.Save("site/a", Running, first, Metadata{})
+	assert.NoError(t, err)
+	s, err = Open(dir)
+	assert.NoError(t, err)
+	devices, err := s.Devices()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"core1", "site/a"}, devices)
+	versions, _ = s.List("core1", Running)
+	assert.Len(t, versions, 2)
+
+	_, _, err = s.Save("", Running, first, Metadata{})
+	assert.EqualError(t, err, "A backup requires a device.")
+}
+
+func TestStore_Corrupt(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := Open(dir)
+	v, _, err := s.Save("core1", Running, "hostname core1\n", Metadata{})
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "objects", v.Hash), []byte("hostname evil\n"), 0600))
+	_, _, err = s.Get("core1", Running, 1)
+	assert.EqualError(t, err, "Version 1 of core1 is corrupt.")
+}
+
+func TestUnified(t *testing.T) {
+	a := lines("a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n")
+	b := lines("a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n")
+	assert.Equal(t, "--- old\n+++ new\n"+
+		"@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n"+
+		"@@ -10,3 +10,4 @@\n j\n k\n l\n+m\n", unified(a, b, "old", "new"))
+
+	assert.Equal(t, "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n", unified(nil, lines("a\nb\n"), "old", "new"))
+	assert.Equal(t, "--- old\n+++ new\n@@ -1 +0,0 @@\n-a\n", unified(lines("a\n"), nil, "old", "new"))
+	assert.Empty(t, unified(a, a, "old", "new"))
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/morganhein/gondi/backup"
+	"github.com/morganhein/gondi/format"
+)
+
+// backupCommand saves the configurations of the selected devices to a versioned store, or with
+// "list", "show" and "diff", looks at the versions saved, ie gondi backup diff core1 3 4
+func backupCommand(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "list", "show", "diff":
+			return historyCommand(args[0], args[1:])
+		}
+	}
+	var o options
+	var dir, message string
+	var startup bool
+	fs := newFlags("backup", "[flags] | list <device> | show <device> [version] | diff <device> <from> [to]")
+	fs.StringVar(&dir, "dir", "backups", "the directory of the versioned store the configurations are saved to")
+	fs.BoolVar(&startup, "startup", false, "also save the startup configurations")
+	fs.StringVar(&message, "message", "", "a message recorded with each version saved")
+	o.register(fs)
+	if err := o.parse(fs, args); err != nil {
+		return fail(err)
+	}
+	store, err := backup.Open(dir)
+	if err != nil {
+		return fail(err)
+	}
+	m, _, err := o.manager()
+	if err != nil {
+		return fail(err)
+	}
+	defer m.Shutdown()
+	ids, err := o.selected(m)
+	if err != nil {
+		return fail(err)
+	}
+
+	out, err := format.New(os.Stdout, o.format)
+	if err != nil {
+		return fail(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report := backup.Run(ctx, m, ids, store, backup.Options{
+		Startup: startup,
+		Author:  os.Getenv("USER"),
+		Message: message,
+		Run:     o.runOptions(out),
+	})
+	if err := out.Close(); err != nil {
+		return fail(err)
+	}
+	if len(report.Failed()) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// historyCommand lists, shows or diffs the versions of a device's configuration in the store
+func historyCommand(action string, args []string) int {
+	var dir, kind string
+	usage := map[string]string{
+		"list": "list [flags] <device>",
+		"show": "show [flags] <device> [version]",
+		"diff": "diff [flags] <device> <from> [to]",
+	}
+	fs := newFlags("backup", usage[action])
+	fs.StringVar(&dir, "dir", "backups", "the directory of the versioned store")
+	fs.StringVar(&kind, "kind", string(backup.Running), "the configuration: running or startup")
+	if err := fs.Parse(args); err != nil {
+		return fail(err)
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 2
+	}
+	// the versions, of which 0 is the latest
+	var versions []int
+	for _, arg := range fs.Args()[1:] {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 {
+			return fail(fmt.Errorf("Invalid version %q.", arg))
+		}
+		versions = append(versions, n)
+	}
+	if (action == "list" && len(versions) > 0) || (action == "show" && len(versions) > 1) ||
+		(action == "diff" && (len(versions) < 1 || len(versions) > 2)) {
+		fs.Usage()
+		return 2
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return fail(fmt.Errorf("No backups found in %s.", dir))
+	}
+	store, err := backup.Open(dir)
+	if err != nil {
+		return fail(err)
+	}
+	device := fs.Arg(0)
+	switch action {
+	case "list":
+		list, err := store.List(device, backup.Kind(kind))
+		if err != nil {
+			return fail(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tTIME\tHASH\tSIZE\tAUTHOR\tMESSAGE")
+		for _, v := range list {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%s\n", v.Number, v.Time.Format(time.RFC3339), v.Hash[:12], v.Size,
+				v.Author, v.Message)
+		}
+		w.Flush()
+	case "show":
+		versions = append(versions, 0)
+		config, _, err := store.Get(device, backup.Kind(kind), versions[0])
+		if err != nil {
+			return fail(err)
+		}
+		fmt.Print(config)
+	case "diff":
+		versions = append(versions, 0)
+		diff, err := store.Diff(device, backup.Kind(kind), versions[0], versions[1])
+		if err != nil {
+			return fail(err)
+		}
+		fmt.Print(diff)
+	}
+	return 0
+}
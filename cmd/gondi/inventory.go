@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/morganhein/gondi/format"
+	"github.com/morganhein/gondi/transport"
+)
+
+// inventoryCommand lists the selected devices of the inventory, ie gondi inventory list --select tag:core
+func inventoryCommand(args []string) int {
+	var o options
+	fs := newFlags("inventory", "list [flags]")
+	o.register(fs)
+	if len(args) == 0 || args[0] != "list" {
+		fs.Usage()
+		return 2
+	}
+	if err := o.parse(fs, args[1:]); err != nil {
+		return fail(err)
+	}
+	m, inv, err := o.manager()
+	if err != nil {
+		return fail(err)
+	}
+	defer m.Shutdown()
+	ids, err := m.Select(o.selection)
+	if err != nil {
+		return fail(err)
+	}
+
+	type device struct {
+		ID       string            `json:"id"`
+		Platform string            `json:"platform"`
+		Host     string            `json:"host"`
+		Port     int               `json:"port,omitempty"`
+		Methods  []string          `json:"methods,omitempty"`
+		Groups   []string          `json:"groups,omitempty"`
+		Tags     []string          `json:"tags,omitempty"`
+		Vars     map[string]string `json:"vars,omitempty"`
+	}
+	devices := []device{}
+	for _, id := range ids {
+		d, _ := inv.Device(id)
+		host := d.Host
+		if host == "" {
+			host = d.Console
+		}
+		methods := make([]string, len(d.Methods))
+		for i, method := range d.Methods {
+			methods[i] = transport.MethodName(method)
+		}
+		devices = append(devices, device{d.ID, string(d.Platform), host, d.Port, methods, d.Groups, d.Tags, d.Vars})
+	}
+
+	switch o.format {
+	case format.JSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(devices); err != nil {
+			return fail(err)
+		}
+		return 0
+	case format.NDJSON:
+		enc := json.NewEncoder(os.Stdout)
+		for _, d := range devices {
+			if err := enc.Encode(d); err != nil {
+				return fail(err)
+			}
+		}
+		return 0
+	case format.CSV:
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"id", "platform", "host", "port", "methods", "groups", "tags"})
+		for _, d := range devices {
+			w.Write([]string{d.ID, d.Platform, d.Host, strconv.Itoa(d.Port), strings.Join(d.Methods, "|"),
+				strings.Join(d.Groups, "|"), strings.Join(d.Tags, "|")})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return fail(err)
+		}
+		return 0
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tPLATFORM\tHOST\tMETHODS\tGROUPS\tTAGS")
+	for _, d := range devices {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", d.ID, d.Platform, d.Host, strings.Join(d.Methods, ","),
+			strings.Join(d.Groups, ","), strings.Join(d.Tags, ","))
+	}
+	w.Flush()
+	return 0
+}
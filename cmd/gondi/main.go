@@ -1,79 +1,65 @@
+// Command gondi runs commands on the devices of an inventory, backs up their configurations,
+// and opens interactive sessions to them.
 package main
 
 import (
-	"encoding/csv"
-	"encoding/json"
+	"flag"
+	"fmt"
 	"os"
-	"strconv"
-	"time"
 
-	"github.com/morganhein/gondi"
 	"github.com/morganhein/gondi/logger"
-	"github.com/morganhein/gondi/schema"
 )
 
-func main() {
-	log := logger.Log
+var log = logger.Log
 
-	cwd, _ := os.Getwd()
-	log.Debugf("Current %s\n", cwd)
-	csvfile, err := os.Open("devices.csv")
-	if err != nil {
-		log.Criticalf("Unable to open the devices.csv file: %s. No devices loaded, exiting.", err.Error())
-		os.Exit(1)
-	}
-	defer csvfile.Close()
-	options := csv.NewReader(csvfile)
+// command is a subcommand of the CLI
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
 
-	g := gondi.NewG()
-	rows, err := options.ReadAll()
-	if err != nil {
-		log.Criticalf("Cannot load devices from csv file: %s. No devices loaded, exiting.", err.Error())
-		os.Exit(1)
-	}
+var commands = []command{
+	{"run", "run a command on the selected devices", runCommand},
+	{"backup", "save the configurations of the selected devices", backupCommand},
+	{"shell", "open an interactive session to a device", shellCommand},
+	{"inventory", "list the devices of the inventory", inventoryCommand},
+}
 
-	for _, row := range rows {
-		log.Info(row)
-		d, err := strconv.Atoi(row[1])
-		if err != nil {
-			log.Warningf("Error converting devicetype to an integer: %s. Skipping.", err)
-			continue
-		}
-		t, err := strconv.Atoi(row[2])
-		if err != nil {
-			log.Warningf("Error converting the method type to an integer: %s. Skipping.", err)
-			continue
-		}
-		p, err := strconv.Atoi(row[4])
-		if err != nil {
-			log.Warningf("Error converting the port to an integer: %s. Skipping.", err)
-			continue
-		}
-		opt := schema.ConnectOptions{
-			Host:           row[3],
-			Port:           p,
-			Username:       row[5],
-			Password:       row[6],
-			EnablePassword: row[7],
-		}
-		dev, err := g.Connect(schema.DeviceType(d), row[0], schema.ConnectionMethod(t), opt)
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: gondi <command> [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun \"gondi <command> -h\" for the flags of a command.\n")
+}
 
-		if err != nil {
-			log.Warningf("Cannot connect to device due to: %s. Skipping.", err.Error())
-			continue
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	if name == "-h" || name == "--help" || name == "help" {
+		usage()
+		os.Exit(0)
+	}
+	for _, c := range commands {
+		if c.name == name {
+			os.Exit(c.run(os.Args[2:]))
 		}
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command %q.\n\n", name)
+	usage()
+	os.Exit(2)
+}
 
-		log.Debug("Successfully connected to device.")
-		time.Sleep(time.Duration(1) * time.Second)
-		//ret, err := dev.WriteCapture("show configuration")
-		//ret, err := dev.WriteCapture("show run")
-		ret, err := dev.WriteCapture("show version")
-		if err != nil {
-			log.Warningf("%s\n", err.Error())
-		}
-		b, _ := json.MarshalIndent(ret, "", "  ")
-		log.Info("\nResult: ", string(b))
-		dev.Disconnect()
+// newFlags creates the flag set of a subcommand
+func newFlags(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: gondi %s %s\n\nFlags:\n", name, args)
+		fs.PrintDefaults()
 	}
-	g.Shutdown()
+	return fs
 }
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/morganhein/gondi"
+	"github.com/morganhein/gondi/credentials"
+	"github.com/morganhein/gondi/format"
+	"github.com/morganhein/gondi/inventory"
+	"github.com/morganhein/gondi/logger"
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/transport"
+)
+
+// options are the flags shared by the subcommands
+type options struct {
+	inventory   string
+	selection   string
+	concurrency int
+	format      string
+	logLevel    string
+	timeout     time.Duration
+	// the host key checking of the devices that don't set their own
+	hostKey            string
+	hostKeyFingerprint string
+	knownHosts         string
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+	path := os.Getenv("GONDI_INVENTORY")
+	if path == "" {
+		path = "devices.yaml"
+	}
+	fs.StringVar(&o.inventory, "inventory", path, "the inventory file, .yaml, .json or .csv ($GONDI_INVENTORY)")
+	fs.StringVar(&o.selection, "select", "", "the devices to use, ie \"site=dc1 && !tag:maintenance\"")
+	fs.IntVar(&o.concurrency, "concurrency", 10, "the number of devices worked on at once")
+	fs.StringVar(&o.format, "format", format.Text, "the output format: "+strings.Join(format.Names(), ", "))
+	fs.StringVar(&o.logLevel, "log-level", "warning", "the log level: critical, error, warning, notice, info or debug")
+	fs.DurationVar(&o.timeout, "timeout", time.Duration(2)*time.Minute, "the time allowed for each device")
+	fs.StringVar(&o.hostKey, "host-key", "", "how SSH host keys are checked, for devices that don't set host_key: "+
+		"strict, pinned, tofu or insecure")
+	fs.StringVar(&o.hostKeyFingerprint, "host-key-fingerprint", "", "the pinned host key, for devices that don't set "+
+		"host_key_fingerprint, ie \"SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8\"")
+	fs.StringVar(&o.knownHosts, "known-hosts", "", "the known_hosts file, for devices that don't set known_hosts "+
+		"(default ~/.ssh/known_hosts)")
+}
+
+// parse parses the flags, and applies the log level
+func (o *options) parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if _, err := format.New(io.Discard, o.format); err != nil {
+		return err
+	}
+	if o.hostKey != "" {
+		mode, err := transport.ParseHostKeyMode(o.hostKey)
+		if err != nil {
+			return err
+		}
+		if mode == schema.HostKeyPinned && o.hostKeyFingerprint == "" {
+			return errors.New("The pinned host key mode requires --host-key-fingerprint.")
+		}
+	}
+	return logger.SetLevel(o.logLevel)
+}
+
+// load reads the inventory, applying the host key flags to the devices without their own. Invalid
+// devices are skipped with a warning.
+func (o *options) load() (*inventory.Inventory, error) {
+	inv, err := inventory.Load(o.inventory)
+	var invalid inventory.Errors
+	if errors.As(err, &invalid) {
+		for _, next := range invalid {
+			log.Warningf("Skipping an invalid device: %s", next)
+		}
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range inv.Devices {
+		d := &inv.Devices[i]
+		if d.HostKey == "" && d.HostKeyFingerprint == "" {
+			d.HostKey, d.HostKeyFingerprint = strings.ToLower(strings.TrimSpace(o.hostKey)), o.hostKeyFingerprint
+		}
+		if d.KnownHosts == "" {
+			d.KnownHosts = o.knownHosts
+		}
+	}
+	return inv, nil
+}
+
+// manager loads the inventory into a new manager. Passwords left out of the inventory are looked
+// up in the environment, or in the encrypted file at $GONDI_CREDENTIALS_FILE.
+func (o *options) manager() (*gondi.Manager, *inventory.Inventory, error) {
+	inv, err := o.load()
+	if err != nil {
+		return nil, nil, err
+	}
+	providers := credentials.Chain{credentials.Env{}}
+	if path := os.Getenv("GONDI_CREDENTIALS_FILE"); path != "" {
+		file, err := credentials.OpenFile(path, []byte(os.Getenv("GONDI_CREDENTIALS_PASSPHRASE")))
+		if err != nil {
+			return nil, nil, err
+		}
+		providers = append(providers, file)
+	}
+	m := gondi.NewManager(gondi.ManagerOptions{Credentials: providers})
+	if err := inv.Register(m); err != nil {
+		m.Shutdown()
+		return nil, nil, err
+	}
+	return m, inv, nil
+}
+
+// selected returns the ids of the devices matching the selection, failing if there are none.
+func (o *options) selected(m *gondi.Manager) ([]string, error) {
+	ids, err := m.Select(o.selection)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("No devices selected.")
+	}
+	return ids, nil
+}
+
+// fail reports an error, returning the exit code for it
+func fail(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	fmt.Fprintln(os.Stderr, err)
+	return 2
+}
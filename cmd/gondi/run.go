@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/morganhein/gondi"
+	"github.com/morganhein/gondi/format"
+)
+
+// runCommand runs a command on the selected devices, ie gondi run -c "show version" --select site=dc1
+func runCommand(args []string) int {
+	var o options
+	var cmd string
+	fs := newFlags("run", "-c <command> [flags]")
+	fs.StringVar(&cmd, "c", "", "the command to run, or the arguments after the flags")
+	o.register(fs)
+	if err := o.parse(fs, args); err != nil {
+		return fail(err)
+	}
+	if cmd == "" {
+		cmd = strings.Join(fs.Args(), " ")
+	}
+	if cmd == "" {
+		fs.Usage()
+		return 2
+	}
+	m, _, err := o.manager()
+	if err != nil {
+		return fail(err)
+	}
+	defer m.Shutdown()
+	ids, err := o.selected(m)
+	if err != nil {
+		return fail(err)
+	}
+
+	out, err := format.New(os.Stdout, o.format)
+	if err != nil {
+		return fail(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report := m.RunAll(ctx, ids, gondi.Command(cmd), o.runOptions(out))
+	if err := out.Close(); err != nil {
+		return fail(err)
+	}
+	if len(report.Failed()) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runOptions applies the flags to RunAll, writing each result to out as it finishes, and logging the progress
+func (o *options) runOptions(out format.Writer) gondi.RunOptions {
+	return gondi.RunOptions{
+		Workers: o.concurrency,
+		Timeout: o.timeout,
+		Progress: func(result gondi.Result, done, total int) {
+			if err := out.Write(result); err != nil {
+				log.Warningf("Unable to write the result of %s: %s", result.DeviceID, err)
+			}
+			if result.Err != nil {
+				log.Warningf("[%d/%d] %s failed: %s", done, total, result.DeviceID, result.Err)
+				return
+			}
+			log.Infof("[%d/%d] %s finished in %s.", done, total, result.DeviceID, result.Duration())
+		},
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/morganhein/gondi/shell"
+)
+
+// shellCommand attaches the terminal to a session on a device, until ~. is typed at the start of a line
+func shellCommand(args []string) int {
+	var o options
+	var record string
+	fs := newFlags("shell", "<device> [flags]")
+	fs.StringVar(&record, "record", "", "write a transcript of the session to this file")
+	o.register(fs)
+	if len(args) == 0 || args[0] == "" || args[0][0] == '-' {
+		fs.Usage()
+		return 2
+	}
+	id := args[0]
+	if err := o.parse(fs, args[1:]); err != nil {
+		return fail(err)
+	}
+	m, _, err := o.manager()
+	if err != nil {
+		return fail(err)
+	}
+	defer m.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	acquired, release, err := m.Acquire(ctx, id)
+	cancel()
+	if err != nil {
+		return fail(err)
+	}
+	defer release()
+	device, ok := acquired.(shell.Device)
+	if !ok {
+		return fail(errors.New("The device does not support interactive sessions."))
+	}
+
+	var opts shell.Options
+	if record != "" {
+		f, err := os.Create(record)
+		if err != nil {
+			return fail(fmt.Errorf("Unable to create the transcript: %s", err))
+		}
+		defer f.Close()
+		opts.Record = f
+	}
+	fmt.Fprintf(os.Stderr, "Connected to %s, type ~. at the start of a line to disconnect.\n", id)
+	if err := shell.Attach(context.Background(), device, opts); err != nil {
+		return fail(err)
+	}
+	fmt.Fprintf(os.Stderr, "\r\nDisconnected from %s.\n", id)
+	return 0
+}
@@ -0,0 +1,180 @@
+// Package configtree parses device configs into trees of statements, so that two configs can be
+// compared by what they configure rather than by their text. Indented configs, like those of IOS,
+// IOS XR and Foundry, are parsed by ParseIOS, and the brace style configs of Junos by ParseJunos.
+package configtree
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/transport"
+)
+
+// Node is a statement of a config, with the statements nested under it.
+type Node struct {
+	Line     string  `json:"line"` // the statement, without its indentation, braces or semicolon
+	Children []*Node `json:"children,omitempty"`
+}
+
+// Find returns the statement at the path of lines below the node, or nil if there is none.
+func (n *Node) Find(path ...string) *Node {
+	node := n
+	for _, line := range path {
+		var next *Node
+		for _, c := range node.Children {
+			if c.Line == line {
+				next = c
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		node = next
+	}
+	return node
+}
+
+// Lines returns the statement and those below it as indented lines, each level by the indent.
+func (n *Node) Lines(indent string) []string {
+	lines := []string{n.Line}
+	for _, c := range n.Children {
+		for _, line := range c.Lines(indent) {
+			lines = append(lines, indent+line)
+		}
+	}
+	return lines
+}
+
+// Ignored matches the lines of an indented config that aren't statements, but are printed by
+// the device around them, ie "Current configuration : 1312 bytes".
+var Ignored = []*regexp.Regexp{
+	regexp.MustCompile(`^Building configuration`),
+	regexp.MustCompile(`^Current configuration`),
+	regexp.MustCompile(`^ntp clock-period`),
+	// the time printed by IOS XR first, ie "Tue Mar  8 14:02:11.123 UTC"
+	regexp.MustCompile(`^\w{3} \w{3} +\d+ \d+:\d+:\d+(\.\d+)? \w+$`),
+}
+
+// banner matches the start of a multiline banner, with its delimiter, ie "banner motd ^C"
+var banner = regexp.MustCompile(`^banner \S+ (\^C|\S)`)
+
+// Parse parses the config by the style of the platform: Junos configs by their braces, and all
+// others by their indentation.
+func Parse(platform schema.DeviceType, config string) (*Node, error) {
+	if platform == transport.Juniper {
+		return ParseJunos(config)
+	}
+	return ParseIOS(config), nil
+}
+
+// ParseIOS parses an indented config, where each statement is nested under the last one indented less.
+// Comments ("!"), "end" and the lines matched by Ignored are left out, and the lines of a banner are
+// kept as they are, under it.
+func ParseIOS(config string) *Node {
+	root := &Node{}
+	type level struct {
+		indent int
+		node   *Node
+	}
+	stack := []level{{-1, root}}
+	lines := strings.Split(strings.ReplaceAll(config, "\r", ""), "\n")
+	for i := 0; i < len(lines); i++ {
+		raw := strings.TrimRight(lines[i], " \t")
+		text := strings.TrimLeft(raw, " \t")
+		if text == "" || strings.HasPrefix(text, "!") || text == "end" || ignored(text) {
+			continue
+		}
+		indent := len(raw) - len(text)
+		for len(stack) > 1 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		node := &Node{Line: text}
+		parent := stack[len(stack)-1].node
+		parent.Children = append(parent.Children, node)
+		stack = append(stack, level{indent, node})
+
+		if m := banner.FindStringSubmatch(text); m != nil {
+			// the banner ends at the next delimiter, unless it is on the same line
+			if strings.Contains(text[len(m[0]):], m[1]) {
+				continue
+			}
+			for i++; i < len(lines); i++ {
+				line := strings.TrimRight(lines[i], " \t")
+				node.Children = append(node.Children, &Node{Line: line})
+				if strings.Contains(line, m[1]) {
+					break
+				}
+			}
+		}
+	}
+	return root
+}
+
+// ParseJunos parses a brace style config, where a statement ending with "{" opens a stanza closed by
+// "}", and other statements end with ";". Comments are left out.
+func ParseJunos(config string) (*Node, error) {
+	root := &Node{}
+	stack := []*Node{root}
+	comment := false
+	for n, line := range strings.Split(strings.ReplaceAll(config, "\r", ""), "\n") {
+		text := strings.TrimSpace(line)
+		if comment {
+			if i := strings.Index(text, "*/"); i >= 0 {
+				comment = false
+				text = strings.TrimSpace(text[i+2:])
+			} else {
+				continue
+			}
+		}
+		if strings.HasPrefix(text, "/*") {
+			if i := strings.Index(text, "*/"); i >= 0 {
+				text = strings.TrimSpace(text[i+2:])
+			} else {
+				comment = true
+				continue
+			}
+		}
+		// trailing comments, ie "; ## SECRET-DATA" or "; /* note */"
+		if i := strings.Index(text, "; #"); i >= 0 {
+			text = text[:i+1]
+		}
+		if i := strings.Index(text, " /*"); i >= 0 && strings.HasSuffix(text, "*/") {
+			text = strings.TrimSpace(text[:i])
+		}
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, "[edit") ||
+			(strings.HasPrefix(text, "{") && strings.HasSuffix(text, "}")) {
+			continue
+		}
+		parent := stack[len(stack)-1]
+		switch {
+		case text == "}":
+			if len(stack) == 1 {
+				return nil, fmt.Errorf("Unexpected \"}\" on line %d of the config.", n+1)
+			}
+			stack = stack[:len(stack)-1]
+		case strings.HasSuffix(text, "{"):
+			node := &Node{Line: strings.TrimSpace(strings.TrimSuffix(text, "{"))}
+			parent.Children = append(parent.Children, node)
+			stack = append(stack, node)
+		default:
+			parent.Children = append(parent.Children, &Node{Line: strings.TrimSuffix(text, ";")})
+		}
+	}
+	if len(stack) > 1 {
+		return nil, fmt.Errorf("The config ends inside %q.", stack[len(stack)-1].Line)
+	}
+	return root, nil
+}
+
+// ignored returns true if the line of an indented config isn't a statement
+func ignored(line string) bool {
+	for _, r := range Ignored {
+		if r.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
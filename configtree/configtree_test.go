@@ -0,0 +1,205 @@
+package configtree
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/morganhein/gondi/gondisim"
+	"github.com/morganhein/gondi/interaction"
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIOS(t *testing.T) {
+	config, err := gondisim.Output("cisco_ios", "show running-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := ParseIOS(config)
+	assert.Equal(t, "version 15.2", root.Children[0].Line)
+	for _, n := range root.Children {
+		assert.NotContains(t, []string{"end", "!"}, n.Line)
+		assert.NotContains(t, n.Line, "configuration")
+		assert.NotContains(t, n.Line, "clock-period")
+	}
+	uplink := root.Find("interface GigabitEthernet1/0/1")
+	if assert.NotNil(t, uplink) {
+		assert.Equal(t, []string{"interface GigabitEthernet1/0/1", " description uplink to dist1", " switchport mode trunk"},
+			uplink.Lines(" "))
+	}
+	assert.NotNil(t, root.Find("line vty 0 4", "transport input ssh telnet"))
+	assert.Nil(t, root.Find("line vty 0 4", "shutdown"))
+
+	// IOS XR nests deeper, and the banner keeps its lines
+	root = ParseIOS("Tue Mar  8 14:02:11.123 UTC\nrouter static\n address-family ipv4 unicast\n  0.0.0.0/0 10.0.0.1\n !\n!\n" +
+		"banner motd ^C\n  Authorised access only\n!\n^C\nbanner exec ^Chello^C\nhostname core1\n")
+	assert.Equal(t, []string{"router static", "  address-family ipv4 unicast", "    0.0.0.0/0 10.0.0.1",
+		"banner motd ^C", "    Authorised access only", "  !", "  ^C", "banner exec ^Chello^C", "hostname core1"},
+		text(root, "  "))
+}
+
+func TestParseJunos(t *testing.T) {
+	config, err := gondisim.Output(string(transport.Juniper), "show configuration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := ParseJunos(config)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"version 19.4R3-S2.2", "system", "interfaces", "routing-options"}, lines(root.Children))
+	assert.NotNil(t, root.Find("system", "root-authentication", `encrypted-password "$6$abcd$0123456789"`))
+	assert.NotNil(t, root.Find("interfaces", "xe-0/0/0", "unit 0", "family inet", "address 10.1.0.2/30"))
+	assert.NotNil(t, root.Find("system", "services", "netconf", "ssh"))
+
+	root, err = ParseJunos("{master:0}\n/* managed\n by hand */\nsystem {\n    inactive: ntp; /* off */\n}\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"system", "inactive: ntp"}, text(root, ""))
+
+	_, err = ParseJunos("system {\n    host-name edge1;\n")
+	assert.EqualError(t, err, `The config ends inside "system".`)
+	_, err = ParseJunos("system {\n}\n}\n")
+	assert.EqualError(t, err, `Unexpected "}" on line 3 of the config.`)
+}
+
+// text returns the lines of the statements of the config
+func text(root *Node, indent string) []string {
+	var l []string
+	for _, n := range root.Children {
+		l = append(l, n.Lines(indent)...)
+	}
+	return l
+}
+
+func lines(nodes []*Node) []string {
+	var l []string
+	for _, n := range nodes {
+		l = append(l, n.Line)
+	}
+	return l
+}
+
+func TestDiff(t *testing.T) {
+	from := "hostname access1\n!\ninterface Gi1\n description uplink\n ip address 10.0.0.1 255.255.255.0\n ip ospf cost 10\n!\n" +
+		"interface Gi2\n shutdown\n!\nntp server 10.0.0.1\nntp server 10.0.0.2\n"
+	// reordered and reindented statements are the same
+	to := "ntp server 10.0.0.2\nntp server 10.0.0.1\nhostname access2\n!\ninterface Gi1\n  ip address 10.0.0.2 255.255.255.0\n" +
+		"  description to dist1\n  ip ospf network point-to-point\n!\ninterface Gi3\n description new\n"
+	changes, err := Compare(transport.Cisco, from, to)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, Changes{
+		{Type: Changed, Path: []string{}, From: &Node{Line: "hostname access1"}, To: &Node{Line: "hostname access2"}},
+		{Type: Changed, Path: []string{"interface Gi1"}, From: &Node{Line: "description uplink"},
+			To: &Node{Line: "description to dist1"}},
+		{Type: Changed, Path: []string{"interface Gi1"}, From: &Node{Line: "ip address 10.0.0.1 255.255.255.0"},
+			To: &Node{Line: "ip address 10.0.0.2 255.255.255.0"}},
+		{Type: Removed, Path: []string{"interface Gi1"}, From: &Node{Line: "ip ospf cost 10"}},
+		{Type: Added, Path: []string{"interface Gi1"}, To: &Node{Line: "ip ospf network point-to-point"}},
+		{Type: Removed, Path: []string{}, From: &Node{Line: "interface Gi2", Children: []*Node{{Line: "shutdown"}}}},
+		{Type: Added, Path: []string{}, To: &Node{Line: "interface Gi3", Children: []*Node{{Line: "description new"}}}},
+	}, changes)
+
+	assert.Equal(t, "-hostname access1\n+hostname access2\n"+
+		" interface Gi1\n- description uplink\n+ description to dist1\n"+
+		"- ip address 10.0.0.1 255.255.255.0\n+ ip address 10.0.0.2 255.255.255.0\n"+
+		"- ip ospf cost 10\n+ ip ospf network point-to-point\n"+
+		"-interface Gi2\n- shutdown\n+interface Gi3\n+ description new\n", changes.Text())
+
+	data, err := changes.JSON()
+	assert.NoError(t, err)
+	var decoded []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	if assert.Len(t, decoded, 7) {
+		assert.Equal(t, map[string]interface{}{
+			"type": "changed",
+			"path": []interface{}{"interface Gi1"},
+			"from": map[string]interface{}{"line": "description uplink"},
+			"to":   map[string]interface{}{"line": "description to dist1"},
+		}, decoded[1])
+	}
+
+	same, err := Compare(transport.Cisco, from, from)
+	assert.NoError(t, err)
+	assert.Empty(t, same.Text())
+	data, _ = same.JSON()
+	assert.Equal(t, "[]", string(data))
+}
+
+func TestSimilar(t *testing.T) {
+	assert.Equal(t, 1, similar("hostname a", "hostname b"))
+	assert.Equal(t, 1, similar("description uplink", "description to dist1"))
+	assert.Equal(t, 3, similar("switchport access vlan 10", "switchport access vlan 20"))
+	assert.Equal(t, 1, similar("shutdown", "no shutdown"))
+	assert.Zero(t, similar("no cdp enable", "no cdp run"))
+	assert.Zero(t, similar("ip ospf cost 10", "ip ospf network point-to-point"))
+	assert.Zero(t, similar("no shutdown", "no ip address"))
+	assert.Zero(t, similar("no shutdown", "shutdown now"))
+	assert.Zero(t, similar("description uplink to dist1", "description desk 2-14"))
+	// the entries of a list are different statements
+	assert.Zero(t, similar("vlan 20", "vlan 30"))
+	assert.Zero(t, similar("username alice privilege 15 secret 5 abc", "username bob privilege 15 secret 5 abc"))
+	assert.Zero(t, similar("interface Gi1", "interface Gi2"))
+	assert.Zero(t, similar("vlan 20", "vlan 20-30 name users"))
+	assert.Equal(t, 6, similar("username alice privilege 15 secret 5 abc", "username alice privilege 15 secret 5 def"))
+}
+
+func TestDiff_Junos(t *testing.T) {
+	from, err := gondisim.Output(string(transport.Juniper), "show configuration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	to := strings.Replace(from, `"to core1"`, `"to core2"`, 1)
+	to = strings.Replace(to, "    xe-0/0/1 {\n        disable;\n    }\n", "", 1)
+	to = strings.Replace(to, "## Last commit: 2022-03-08 14:02:11 UTC", "## Last commit: 2022-03-09 09:00:00 UTC", 1)
+	changes, err := Compare(transport.Juniper, from, to)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, " interfaces\n  xe-0/0/0\n-  description \"to core1\"\n+  description \"to core2\"\n"+
+		"- xe-0/0/1\n-  disable\n", changes.Text())
+
+	_, err = Compare(transport.Juniper, from, "system {\n")
+	assert.Error(t, err)
+}
+
+func TestDiff_ShowConfig(t *testing.T) {
+	p, err := gondisim.Lookup("cisco_ios")
+	if err != nil {
+		t.Fatal(err)
+	}
+	running := p.Outputs["show running-config"]
+	desired := strings.Replace(running, " description desk 2-14\n", " description desk 2-16\n", 1)
+	desired = strings.Replace(desired, "Current configuration : 1312 bytes", "Current configuration : 1290 bytes", 1)
+
+	// the enable password is a word of the config, which is captured as the device sent it
+	sim := gondisim.New(p)
+	if err := sim.StartTelnet(); err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+	dev, err := interaction.New(transport.Cisco)
+	assert.NoError(t, err)
+	err = dev.Connect(transport.Telnet, schema.ConnectOptions{
+		Host:           sim.Host(),
+		Port:           sim.Port(),
+		Username:       sim.Username,
+		Password:       sim.Password,
+		EnablePassword: sim.EnablePassword,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer dev.Disconnect()
+	config, err := dev.ShowConfig(false)
+	if !assert.NoError(t, err) {
+		return
+	}
+	changes, err := Compare(transport.Cisco, config, desired)
+	assert.NoError(t, err)
+	assert.Equal(t, Changes{{Type: Changed, Path: []string{"interface GigabitEthernet1/0/2"},
+		From: &Node{Line: "description desk 2-14"}, To: &Node{Line: "description desk 2-16"}}}, changes)
+}
@@ -0,0 +1,216 @@
+package configtree
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/morganhein/gondi/schema"
+)
+
+// ChangeType is how a statement differs between two configs.
+type ChangeType string
+
+// The types of change
+const (
+	Added   ChangeType = "added"
+	Removed ChangeType = "removed"
+	Changed ChangeType = "changed"
+)
+
+// Change is a statement that differs between two configs.
+type Change struct {
+	Type ChangeType `json:"type"`
+	Path []string   `json:"path"`           // the stanzas the statement is in, outermost first
+	From *Node      `json:"from,omitempty"` // the statement removed or changed, with those below it
+	To   *Node      `json:"to,omitempty"`   // the statement added, or that it changed to
+}
+
+// Changes are the differences between two configs, in the order of the first config with
+// the statements only in the second last.
+type Changes []Change
+
+// Settings are the first words of the statements that hold a single value, so that a statement with
+// another value replaces the old one, ie "hostname access2" replaces "hostname access1". Other statements
+// differing in their second word are entries of a list, ie "vlan 20" and "vlan 30", or "username alice"
+// and "username bob".
+var Settings = []string{"hostname", "description", "name", "alias", "remark", "version", "location",
+	"contact", "mtu", "bandwidth", "speed", "duplex", "delay", "encapsulation"}
+
+// Diff returns the statements that differ from one config to another. Statements are matched by
+// their path, so the order of the statements doesn't matter. A statement replaced by one that starts
+// the same, ie "description uplink" by "description to dist1", is Changed; otherwise the statements
+// are Removed and Added, with all those below them.
+func Diff(from, to *Node) Changes {
+	changes := Changes{}
+	diff([]string{}, from.Children, to.Children, &changes)
+	return changes
+}
+
+// Compare parses two configs of the platform, as returned by ShowConfig, and returns their differences.
+func Compare(platform schema.DeviceType, from, to string) (Changes, error) {
+	a, err := Parse(platform, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := Parse(platform, to)
+	if err != nil {
+		return nil, err
+	}
+	return Diff(a, b), nil
+}
+
+// diff adds the changes between the statements below the path
+func diff(path []string, a, b []*Node, changes *Changes) {
+	// match the statements with the same line, in order, so that repeated lines pair up
+	unmatched := make(map[string][]int)
+	for j, n := range b {
+		unmatched[n.Line] = append(unmatched[n.Line], j)
+	}
+	matches := make([]int, len(a))
+	matched := make([]bool, len(b))
+	for i, n := range a {
+		matches[i] = -1
+		if js := unmatched[n.Line]; len(js) > 0 {
+			matches[i], matched[js[0]] = js[0], true
+			unmatched[n.Line] = js[1:]
+		}
+	}
+	// then pair the statements left, which replaced each other
+	replaced := make([]int, len(a))
+	for i, n := range a {
+		replaced[i] = -1
+		if matches[i] >= 0 || len(n.Children) > 0 {
+			continue
+		}
+		best := 0
+		for j, m := range b {
+			if matched[j] || len(m.Children) > 0 {
+				continue
+			}
+			if p := similar(n.Line, m.Line); p > best {
+				best, replaced[i] = p, j
+			}
+		}
+		if replaced[i] >= 0 {
+			matched[replaced[i]] = true
+		}
+	}
+
+	for i, n := range a {
+		switch {
+		case matches[i] >= 0:
+			diff(append(path[:len(path):len(path)], n.Line), n.Children, b[matches[i]].Children, changes)
+		case replaced[i] >= 0:
+			*changes = append(*changes, Change{Type: Changed, Path: path, From: n, To: b[replaced[i]]})
+		default:
+			*changes = append(*changes, Change{Type: Removed, Path: path, From: n})
+		}
+	}
+	for j, m := range b {
+		if !matched[j] {
+			*changes = append(*changes, Change{Type: Added, Path: path, To: m})
+		}
+	}
+}
+
+// similar returns the number of words two statements share, if one is the other with a new value, or 0.
+// That is when they differ in only one word after the first, ie "ip address 10.0.0.1 255.0.0.0" and
+// "ip address 10.0.0.2 255.0.0.0", share the first of two words, ie "hostname a" and "hostname b", or
+// one negates the other, ie "shutdown" and "no shutdown". "ip ospf cost 10" and "ip ospf network
+// point-to-point" are different settings, and so are statements differing in their second word, unless
+// their first is one of the Settings: "vlan 20" and "vlan 30" are different vlans.
+func similar(a, b string) int {
+	wa, wb := strings.Fields(a), strings.Fields(b)
+	na, nb := negated(wa), negated(wb)
+	if na {
+		wa = wa[1:]
+	}
+	if nb {
+		wb = wb[1:]
+	}
+	if len(wa) == 0 || len(wb) == 0 || wa[0] != wb[0] {
+		return 0
+	}
+	if na != nb {
+		if strings.Join(wa, " ") == strings.Join(wb, " ") {
+			return len(wa)
+		}
+		return 0
+	}
+	setting := contains(Settings, wa[0])
+	if len(wa) != len(wb) {
+		if (len(wa) <= 2 || len(wb) <= 2) && setting {
+			return 1
+		}
+		return 0
+	}
+	same := 0
+	for i := range wa {
+		if wa[i] == wb[i] {
+			same++
+		}
+	}
+	if same != len(wa)-1 || (wa[1] != wb[1] && !setting) {
+		return 0
+	}
+	return same
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// negated returns true if the words are of a statement starting with "no"
+func negated(words []string) bool {
+	return len(words) > 1 && words[0] == "no"
+}
+
+// Text renders the changes like a unified diff, with the stanzas around each change indented
+// above it, and the statements removed or added prefixed by "-" or "+".
+func (c Changes) Text() string {
+	var out strings.Builder
+	var shown []string
+	for _, change := range c {
+		// the stanzas, unless they were shown for the change before
+		common := 0
+		for common < len(shown) && common < len(change.Path) && shown[common] == change.Path[common] {
+			common++
+		}
+		for i := common; i < len(change.Path); i++ {
+			write(&out, ' ', i, change.Path[i])
+		}
+		shown = change.Path
+		if change.From != nil {
+			for _, line := range change.From.Lines(" ") {
+				write(&out, '-', len(change.Path), line)
+			}
+		}
+		if change.To != nil {
+			for _, line := range change.To.Lines(" ") {
+				write(&out, '+', len(change.Path), line)
+			}
+		}
+	}
+	return out.String()
+}
+
+// JSON renders the changes as an indented array of objects.
+func (c Changes) JSON() ([]byte, error) {
+	if c == nil {
+		c = Changes{}
+	}
+	return json.MarshalIndent(c, "", "  ")
+}
+
+// write writes a line of the Text of changes, indented by its depth
+func write(out *strings.Builder, op byte, depth int, line string) {
+	out.WriteByte(op)
+	out.WriteString(strings.Repeat(" ", depth))
+	out.WriteString(line)
+	out.WriteByte('\n')
+}
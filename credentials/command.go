@@ -0,0 +1,48 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/morganhein/gondi/schema"
+)
+
+// Command runs an external program to get the credentials, ie a password manager's CLI. The
+// device key is passed as the last argument, and in the GONDI_DEVICE environment variable.
+// The program prints a JSON object to stdout:
+//
+//	{"username": "admin", "password": "secret", "enable_password": "secret"}
+//
+// Printing nothing means it has no credentials for the device.
+type Command struct {
+	Path string
+	Args []string
+}
+
+func (c Command) Credentials(ctx context.Context, key string) (schema.Credentials, error) {
+	cmd := exec.CommandContext(ctx, c.Path, append(append([]string(nil), c.Args...), key)...)
+	cmd.Env = append(os.Environ(), "GONDI_DEVICE="+key)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return schema.Credentials{}, fmt.Errorf("The credential command failed: %s: %s", err, msg)
+		}
+		return schema.Credentials{}, fmt.Errorf("The credential command failed: %s", err)
+	}
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return schema.Credentials{}, ErrNotFound
+	}
+	var e entry
+	if err := json.Unmarshal(stdout.Bytes(), &e); err != nil {
+		// the output isn't quoted, since it could hold the secrets
+		return schema.Credentials{}, fmt.Errorf("The credential command printed invalid JSON: %s", err)
+	}
+	return schema.Credentials(e), nil
+}
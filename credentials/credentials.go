@@ -0,0 +1,48 @@
+// Package credentials has the built in credential providers, which look up the username and
+// passwords of a device when it connects instead of keeping them in the inventory.
+package credentials
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/morganhein/gondi/schema"
+)
+
+// ErrNotFound is returned by providers that have no credentials for the device.
+var ErrNotFound = schema.ErrNoCredentials
+
+// Chain tries each provider in turn, until one has credentials for the device.
+type Chain []schema.CredentialProvider
+
+func (c Chain) Credentials(ctx context.Context, key string) (schema.Credentials, error) {
+	for _, p := range c {
+		creds, err := p.Credentials(ctx, key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		return creds, err
+	}
+	return schema.Credentials{}, ErrNotFound
+}
+
+// Static returns the same credentials for every device.
+type Static schema.Credentials
+
+func (s Static) Credentials(ctx context.Context, key string) (schema.Credentials, error) {
+	return schema.Credentials(s), nil
+}
+
+// envName turns a device key into the part of an environment variable name, ie "core-1.dc1" into "CORE_1_DC1"
+func envName(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, key)
+}
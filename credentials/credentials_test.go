@@ -0,0 +1,96 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/morganhein/gondi/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnv(t *testing.T) {
+	t.Setenv("TEST_USERNAME", "admin")
+	t.Setenv("TEST_PASSWORD", "everyone")
+	t.Setenv("TEST_CORE_1_DC1_PASSWORD", "core")
+	env := Env{Prefix: "TEST_"}
+
+	creds, err := env.Credentials(context.Background(), "core-1.dc1")
+	assert.NoError(t, err)
+	assert.Equal(t, schema.Credentials{Username: "admin", Password: "core"}, creds)
+	creds, err = env.Credentials(context.Background(), "access1")
+	assert.NoError(t, err)
+	assert.Equal(t, schema.Credentials{Username: "admin", Password: "everyone"}, creds)
+
+	_, err = Env{Prefix: "MISSING_"}.Credentials(context.Background(), "access1")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	entries := map[string]schema.Credentials{
+		"default": {Username: "admin", Password: "everyone"},
+		"core1":   {Username: "root", Password: "core", EnablePassword: "enable"},
+	}
+	assert.NoError(t, WriteFile(path, []byte("passphrase"), entries))
+
+	f, err := OpenFile(path, []byte("passphrase"))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"default", "core1"}, f.Keys())
+	creds, err := f.Credentials(context.Background(), "core1")
+	assert.NoError(t, err)
+	assert.Equal(t, entries["core1"], creds)
+	creds, err = f.Credentials(context.Background(), "access1")
+	assert.NoError(t, err)
+	assert.Equal(t, entries["default"], creds)
+
+	_, err = OpenFile(path, []byte("wrong"))
+	assert.Error(t, err)
+	_, err = Open(bytes.NewReader([]byte("plain text")), []byte("passphrase"))
+	assert.Error(t, err)
+	assert.Error(t, WriteFile(path, nil, entries))
+
+	// the passwords are encrypted
+	var buf bytes.Buffer
+	assert.NoError(t, Seal(&buf, []byte("passphrase"), entries))
+	assert.NotContains(t, buf.String(), "everyone")
+
+	f, err = Open(&buf, []byte("passphrase"))
+	assert.NoError(t, err)
+	delete(f.entries, "default")
+	_, err = f.Credentials(context.Background(), "access1")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestCommand(t *testing.T) {
+	c := Command{Path: "sh", Args: []string{"-c", `
+case "$1" in
+  core1) echo "{\"username\": \"$GONDI_DEVICE\", \"password\": \"core\"}" ;;
+  broken) echo "not json" ;;
+  failing) echo "vault sealed" >&2; exit 1 ;;
+esac`, "sh"}}
+
+	creds, err := c.Credentials(context.Background(), "core1")
+	assert.NoError(t, err)
+	assert.Equal(t, schema.Credentials{Username: "core1", Password: "core"}, creds)
+	_, err = c.Credentials(context.Background(), "access1")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	_, err = c.Credentials(context.Background(), "broken")
+	assert.Error(t, err)
+	_, err = c.Credentials(context.Background(), "failing")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "vault sealed")
+	}
+}
+
+func TestChain(t *testing.T) {
+	chain := Chain{Env{Prefix: "MISSING_"}, Static{Username: "admin"}}
+	creds, err := chain.Credentials(context.Background(), "sw1")
+	assert.NoError(t, err)
+	assert.Equal(t, "admin", creds.Username)
+
+	_, err = Chain{Env{Prefix: "MISSING_"}}.Credentials(context.Background(), "sw1")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
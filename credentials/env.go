@@ -0,0 +1,46 @@
+package credentials
+
+import (
+	"context"
+	"os"
+
+	"github.com/morganhein/gondi/schema"
+)
+
+// Env reads the credentials from environment variables. Each of USERNAME, PASSWORD and
+// ENABLE_PASSWORD is looked up for the device first, then for every device, ie for the
+// device "core-1" with the default prefix:
+//
+//	GONDI_CORE_1_PASSWORD, then GONDI_PASSWORD
+type Env struct {
+	Prefix string // the prefix of the variables, "GONDI_" if empty
+}
+
+func (e Env) Credentials(ctx context.Context, key string) (schema.Credentials, error) {
+	found := false
+	lookup := func(name string) string {
+		for _, variable := range []string{e.prefix() + envName(key) + "_" + name, e.prefix() + name} {
+			if value, ok := os.LookupEnv(variable); ok {
+				found = true
+				return value
+			}
+		}
+		return ""
+	}
+	creds := schema.Credentials{
+		Username:       lookup("USERNAME"),
+		Password:       lookup("PASSWORD"),
+		EnablePassword: lookup("ENABLE_PASSWORD"),
+	}
+	if !found {
+		return creds, ErrNotFound
+	}
+	return creds, nil
+}
+
+func (e Env) prefix() string {
+	if e.Prefix == "" {
+		return "GONDI_"
+	}
+	return e.Prefix
+}
@@ -0,0 +1,150 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/morganhein/gondi/schema"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// magic starts every credentials file, and versions its format
+const magic = "GONDICRED1"
+
+const (
+	saltSize  = 16
+	nonceSize = 24
+)
+
+// entry is the JSON form of the credentials of a device
+type entry struct {
+	Username       string `json:"username,omitempty"`
+	Password       string `json:"password,omitempty"`
+	EnablePassword string `json:"enable_password,omitempty"`
+}
+
+// File holds the credentials of an encrypted file, by device key. The "default" entry is used for
+// the devices that have none of their own.
+//
+// The file is a JSON object of the entries, sealed with NaCl secretbox using a key derived
+// from a passphrase with scrypt.
+type File struct {
+	entries map[string]schema.Credentials
+}
+
+// OpenFile decrypts the credentials file at path with the passphrase.
+func OpenFile(path string, passphrase []byte) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the credentials file: %s", err)
+	}
+	return Open(bytes.NewReader(data), passphrase)
+}
+
+// Open decrypts a credentials file with the passphrase.
+func Open(r io.Reader, passphrase []byte) (*File, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the credentials file: %s", err)
+	}
+	if len(data) < len(magic)+saltSize+nonceSize || string(data[:len(magic)]) != magic {
+		return nil, errors.New("Not a credentials file.")
+	}
+	data = data[len(magic):]
+	key, err := deriveKey(passphrase, data[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+	var nonce [nonceSize]byte
+	copy(nonce[:], data[saltSize:])
+	plain, ok := secretbox.Open(nil, data[saltSize+nonceSize:], &nonce, key)
+	if !ok {
+		return nil, errors.New("Unable to decrypt the credentials file, the passphrase is wrong or the file is damaged.")
+	}
+	var entries map[string]entry
+	if err := json.Unmarshal(plain, &entries); err != nil {
+		return nil, fmt.Errorf("Unable to parse the credentials file: %s", err)
+	}
+	f := &File{entries: make(map[string]schema.Credentials, len(entries))}
+	for k, e := range entries {
+		f.entries[k] = schema.Credentials(e)
+	}
+	return f, nil
+}
+
+// WriteFile encrypts the credentials with the passphrase, and writes them to path, readable only by the owner.
+func WriteFile(path string, passphrase []byte, entries map[string]schema.Credentials) error {
+	var buf bytes.Buffer
+	if err := Seal(&buf, passphrase, entries); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0600)
+}
+
+// Seal encrypts the credentials with the passphrase.
+func Seal(w io.Writer, passphrase []byte, entries map[string]schema.Credentials) error {
+	if len(passphrase) == 0 {
+		return errors.New("The credentials file requires a passphrase.")
+	}
+	plain := make(map[string]entry, len(entries))
+	for k, c := range entries {
+		plain[k] = entry(c)
+	}
+	data, err := json.Marshal(plain)
+	if err != nil {
+		return err
+	}
+	salt := make([]byte, saltSize)
+	var nonce [nonceSize]byte
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return err
+	}
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	out := append([]byte(magic), salt...)
+	out = append(out, nonce[:]...)
+	out = secretbox.Seal(out, data, &nonce, key)
+	_, err = w.Write(out)
+	return err
+}
+
+func deriveKey(passphrase, salt []byte) (*[32]byte, error) {
+	derived, err := scrypt.Key(passphrase, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	var key [32]byte
+	copy(key[:], derived)
+	return &key, nil
+}
+
+func (f *File) Credentials(ctx context.Context, key string) (schema.Credentials, error) {
+	if creds, ok := f.entries[key]; ok {
+		return creds, nil
+	}
+	if creds, ok := f.entries["default"]; ok {
+		return creds, nil
+	}
+	return schema.Credentials{}, ErrNotFound
+}
+
+// Keys returns the device keys in the file.
+func (f *File) Keys() []string {
+	keys := make([]string, 0, len(f.entries))
+	for k := range f.entries {
+		keys = append(keys, k)
+	}
+	return keys
+}
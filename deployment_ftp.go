@@ -0,0 +1,262 @@
+package gondi
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/morganhein/gondi/schema"
+)
+
+// FTP as in RFC 959, with just enough of it for devices to fetch and store a file in passive
+// or active mode. Devices log in with the user "gondi" and the token of the transfer as the password.
+
+// ftpIdle is how long a control connection may sit unused
+var ftpIdle = time.Duration(2) * time.Minute
+
+func (s *DeploymentServer) serveFTP(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.listening(schema.FTP, l, l.Addr())
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				// closed
+				return
+			}
+			session := &ftpSession{s: s, conn: conn, r: bufio.NewReader(conn), cwd: "/"}
+			s.track(conn, session.serve)
+		}
+	}()
+	return nil
+}
+
+type ftpSession struct {
+	s       *DeploymentServer
+	conn    net.Conn
+	r       *bufio.Reader
+	token   string
+	user    string
+	cwd     string
+	passive net.Listener // listening for the data connection after PASV or EPSV
+	active  string       // the address to connect to for the data after PORT
+}
+
+func (f *ftpSession) reply(code int, message string) {
+	fmt.Fprintf(f.conn, "%d %s\r\n", code, message)
+}
+
+func (f *ftpSession) serve() {
+	defer f.closePassive()
+	f.reply(220, "gondi deployment server ready.")
+	for {
+		f.conn.SetReadDeadline(time.Now().Add(ftpIdle))
+		line, err := f.r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command, arg := line, ""
+		if i := strings.Index(line, " "); i >= 0 {
+			command, arg = line[:i], line[i+1:]
+		}
+		command = strings.ToUpper(command)
+		if f.token == "" && command != "USER" && command != "PASS" && command != "QUIT" {
+			f.reply(530, "Please login with USER and PASS.")
+			continue
+		}
+		switch command {
+		case "USER":
+			f.user = arg
+			f.reply(331, "Password required.")
+		case "PASS":
+			if f.user != deployUser || !f.s.authorized(schema.FTP, arg) {
+				f.reply(530, "Login incorrect.")
+				continue
+			}
+			f.token = arg
+			f.reply(230, "Logged in.")
+		case "SYST":
+			f.reply(215, "UNIX Type: L8")
+		case "FEAT":
+			fmt.Fprint(f.conn, "211-Features:\r\n EPSV\r\n PASV\r\n SIZE\r\n211 End\r\n")
+		case "TYPE", "MODE", "STRU":
+			f.reply(200, "OK.")
+		case "NOOP":
+			f.reply(200, "OK.")
+		case "PWD", "XPWD":
+			f.reply(257, strconv.Quote(f.cwd))
+		case "CWD", "XCWD":
+			f.cwd = f.path(arg)
+			f.reply(250, "OK.")
+		case "CDUP":
+			f.cwd = path.Dir(f.cwd)
+			f.reply(250, "OK.")
+		case "PASV", "EPSV":
+			f.listenPassive(command)
+		case "PORT":
+			f.port(arg)
+		case "SIZE":
+			f.size(arg)
+		case "RETR":
+			f.transfer(arg, false)
+		case "STOR":
+			f.transfer(arg, true)
+		case "QUIT":
+			f.reply(221, "Goodbye.")
+			return
+		default:
+			f.reply(502, "Command not implemented.")
+		}
+	}
+}
+
+// path returns the absolute path of a file given relative to the working directory
+func (f *ftpSession) path(file string) string {
+	if strings.HasPrefix(file, "/") {
+		return path.Clean(file)
+	}
+	return path.Join(f.cwd, file)
+}
+
+func (f *ftpSession) closePassive() {
+	if f.passive != nil {
+		f.passive.Close()
+		f.passive = nil
+	}
+}
+
+// listenPassive listens for the data connection on the address the client reached us on
+func (f *ftpSession) listenPassive(command string) {
+	f.closePassive()
+	f.active = ""
+	host, _, _ := net.SplitHostPort(f.conn.LocalAddr().String())
+	l, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		f.reply(425, "Unable to open a data connection.")
+		return
+	}
+	f.passive = l
+	port := l.Addr().(*net.TCPAddr).Port
+	if command == "EPSV" {
+		f.reply(229, fmt.Sprintf("Entering Extended Passive Mode (|||%d|).", port))
+		return
+	}
+	ip := net.ParseIP(host).To4()
+	if ip == nil {
+		f.reply(425, "PASV requires IPv4, use EPSV.")
+		f.closePassive()
+		return
+	}
+	f.reply(227, fmt.Sprintf("Entering Passive Mode (%d,%d,%d,%d,%d,%d).", ip[0], ip[1], ip[2], ip[3],
+		port>>8, port&0xff))
+}
+
+// port records the address to connect to for the data, given as "h1,h2,h3,h4,p1,p2"
+func (f *ftpSession) port(arg string) {
+	f.closePassive()
+	parts := strings.Split(arg, ",")
+	if len(parts) != 6 {
+		f.reply(501, "Invalid PORT.")
+		return
+	}
+	var n [6]int
+	for i, p := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || v < 0 || v > 255 {
+			f.reply(501, "Invalid PORT.")
+			return
+		}
+		n[i] = v
+	}
+	ip := fmt.Sprintf("%d.%d.%d.%d", n[0], n[1], n[2], n[3])
+	// only connect back to the client, so the server can't be used to reach other hosts
+	if host, _, _ := net.SplitHostPort(f.conn.RemoteAddr().String()); host != ip {
+		f.reply(501, "PORT must be the address of the client.")
+		return
+	}
+	f.active = net.JoinHostPort(ip, strconv.Itoa(n[4]<<8|n[5]))
+	f.reply(200, "PORT OK.")
+}
+
+// data opens the data connection set up by the last PASV, EPSV or PORT
+func (f *ftpSession) data() (net.Conn, error) {
+	switch {
+	case f.passive != nil:
+		defer f.closePassive()
+		if l, ok := f.passive.(*net.TCPListener); ok {
+			l.SetDeadline(time.Now().Add(time.Duration(30) * time.Second))
+		}
+		return f.passive.Accept()
+	case f.active != "":
+		defer func() { f.active = "" }()
+		return net.DialTimeout("tcp", f.active, time.Duration(30)*time.Second)
+	}
+	return nil, errors.New("Use PASV, EPSV or PORT first.")
+}
+
+func (f *ftpSession) size(arg string) {
+	g, err := f.s.lookup(schema.FTP, f.token, strings.TrimPrefix(f.path(arg), "/"), false)
+	if err != nil {
+		f.reply(550, err.Error())
+		return
+	}
+	file, size, err := f.s.open(g)
+	if err != nil {
+		f.reply(550, "File not found.")
+		return
+	}
+	file.Close()
+	f.reply(213, strconv.FormatInt(size, 10))
+}
+
+// transfer sends or receives the file of the allowed transfer over a data connection
+func (f *ftpSession) transfer(arg string, upload bool) {
+	g, err := f.s.claim(schema.FTP, f.token, strings.TrimPrefix(f.path(arg), "/"), upload)
+	if err != nil {
+		f.reply(550, err.Error())
+		return
+	}
+	start := time.Now()
+	remote := f.conn.RemoteAddr().String()
+	var file io.ReadCloser
+	if !upload {
+		if file, _, err = f.s.open(g); err != nil {
+			f.reply(550, "File not found.")
+			f.s.finish(g, remote, 0, start, err)
+			return
+		}
+		defer file.Close()
+	}
+	f.reply(150, "Opening data connection.")
+	conn, err := f.data()
+	if err != nil {
+		f.reply(425, "Unable to open the data connection.")
+		f.s.finish(g, remote, 0, start, err)
+		return
+	}
+	var n int64
+	if upload {
+		n, err = f.s.receive(g, conn)
+	} else {
+		n, err = io.Copy(conn, file)
+	}
+	conn.Close()
+	if err != nil {
+		f.reply(451, "Transfer aborted.")
+	} else {
+		f.reply(226, "Transfer complete.")
+	}
+	f.s.finish(g, remote, n, start, err)
+}
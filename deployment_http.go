@@ -0,0 +1,77 @@
+package gondi
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/morganhein/gondi/schema"
+)
+
+// HTTP serves downloads with GET, and takes uploads with PUT or POST, at "/<token>/<file>".
+
+func (s *DeploymentServer) serveHTTP(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Handler:           http.HandlerFunc(s.handleHTTP),
+		ReadHeaderTimeout: time.Duration(30) * time.Second,
+	}
+	s.listening(schema.HTTP, server, l.Addr())
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		server.Serve(l)
+	}()
+	return nil
+}
+
+func (s *DeploymentServer) handleHTTP(w http.ResponseWriter, r *http.Request) {
+	var upload bool
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPut, http.MethodPost:
+		upload = true
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, POST")
+		http.Error(w, "Method not allowed.", http.StatusMethodNotAllowed)
+		return
+	}
+	token, file := splitToken(r.URL.Path)
+	if r.Method == http.MethodHead {
+		if _, err := s.lookup(schema.HTTP, token, file, false); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+		}
+		return
+	}
+	g, err := s.claim(schema.HTTP, token, file, upload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	start := time.Now()
+	var n int64
+	if upload {
+		if n, err = s.receive(g, r.Body); err != nil {
+			http.Error(w, "Unable to save the file.", http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+	} else {
+		f, size, err := s.open(g)
+		if err != nil {
+			http.Error(w, "File not found.", http.StatusNotFound)
+			s.finish(g, r.RemoteAddr, 0, start, err)
+			return
+		}
+		defer f.Close()
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		n, err = io.Copy(w, f)
+	}
+	s.finish(g, r.RemoteAddr, n, start, err)
+}
@@ -0,0 +1,256 @@
+package gondi
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/morganhein/gondi/schema"
+	"golang.org/x/crypto/ssh"
+)
+
+// SCP over an SSH server that only runs "scp -t" and "scp -f" for a single file. Devices log in with
+// the user "gondi" and the token of the transfer as the password.
+
+func (s *DeploymentServer) serveSCP(addr string) error {
+	key := s.options.HostKey
+	if key == nil {
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return fmt.Errorf("Unable to generate a host key: %s", err)
+		}
+		if key, err = ssh.NewSignerFromKey(private); err != nil {
+			return fmt.Errorf("Unable to generate a host key: %s", err)
+		}
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if meta.User() != deployUser || !s.authorized(schema.SCP, string(password)) {
+				return nil, ErrTransferDenied
+			}
+			return &ssh.Permissions{Extensions: map[string]string{"token": string(password)}}, nil
+		},
+	}
+	config.AddHostKey(key)
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.listening(schema.SCP, l, l.Addr())
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				// closed
+				return
+			}
+			s.track(conn, func() { s.scpConn(conn, config) })
+		}
+	}()
+	return nil
+}
+
+func (s *DeploymentServer) scpConn(conn net.Conn, config *ssh.ServerConfig) {
+	conn.SetDeadline(time.Now().Add(time.Duration(30) * time.Second))
+	server, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		s.log.Debugf("SCP login from %s failed: %s", conn.RemoteAddr(), err)
+		return
+	}
+	defer server.Close()
+	conn.SetDeadline(time.Time{})
+	go ssh.DiscardRequests(requests)
+	for next := range channels {
+		if next.ChannelType() != "session" {
+			next.Reject(ssh.UnknownChannelType, "Only sessions are supported.")
+			continue
+		}
+		channel, requests, err := next.Accept()
+		if err != nil {
+			return
+		}
+		s.scpSession(channel, requests, server.Permissions.Extensions["token"], conn.RemoteAddr().String())
+	}
+}
+
+// scpSession runs the scp command of a session, then closes it with the exit status
+func (s *DeploymentServer) scpSession(channel ssh.Channel, requests <-chan *ssh.Request, token, remote string) {
+	defer channel.Close()
+	for req := range requests {
+		if req.Type != "exec" {
+			req.Reply(req.Type == "env" || req.Type == "pty-req", nil)
+			continue
+		}
+		var payload struct{ Command string }
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+			req.Reply(false, nil)
+			return
+		}
+		upload, file, err := scpCommand(payload.Command)
+		if err != nil {
+			req.Reply(false, nil)
+			return
+		}
+		req.Reply(true, nil)
+		status := uint32(0)
+		if err := s.scp(channel, token, file, upload, remote); err != nil {
+			fmt.Fprintf(channel.Stderr(), "%s\n", err)
+			status = 1
+		}
+		exit := make([]byte, 4)
+		binary.BigEndian.PutUint32(exit, status)
+		channel.SendRequest("exit-status", false, exit)
+		return
+	}
+}
+
+// scpCommand reads the direction and file of an scp command, ie "scp -t router1.cfg" receives a file
+func scpCommand(command string) (upload bool, file string, err error) {
+	fields := strings.Fields(command)
+	if len(fields) < 3 || fields[0] != "scp" {
+		return false, "", fmt.Errorf("Unsupported command %q.", command)
+	}
+	direction := ""
+	for _, flag := range fields[1 : len(fields)-1] {
+		switch flag {
+		case "-t", "-f":
+			direction = flag
+		case "-r":
+			return false, "", errors.New("Recursive copies are not supported.")
+		}
+	}
+	if direction == "" {
+		return false, "", fmt.Errorf("Unsupported command %q.", command)
+	}
+	return direction == "-t", fields[len(fields)-1], nil
+}
+
+// scp runs the remote end of the scp protocol for an allowed transfer
+func (s *DeploymentServer) scp(channel ssh.Channel, token, file string, upload bool, remote string) error {
+	g, err := s.claim(schema.SCP, token, file, upload)
+	if err != nil {
+		scpFail(channel, err)
+		return err
+	}
+	start := time.Now()
+	var n int64
+	if upload {
+		n, err = s.scpReceive(channel, g)
+	} else {
+		n, err = s.scpSend(channel, g)
+	}
+	if err != nil {
+		scpFail(channel, err)
+	}
+	s.finish(g, remote, n, start, err)
+	return err
+}
+
+// scpReceive reads the file sent by "scp file host:path", which starts with "C<mode> <size> <name>"
+func (s *DeploymentServer) scpReceive(channel ssh.Channel, g *grant) (int64, error) {
+	r := bufio.NewReader(channel)
+	if err := scpOK(channel); err != nil {
+		return 0, err
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return 0, fmt.Errorf("Unable to read the file header: %s", err)
+		}
+		switch line[0] {
+		case 'T':
+			// the times of the file, which aren't kept
+			if err := scpOK(channel); err != nil {
+				return 0, err
+			}
+			continue
+		case 'C':
+		default:
+			return 0, fmt.Errorf("Unexpected scp header %q.", strings.TrimSpace(line))
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return 0, fmt.Errorf("Invalid scp header %q.", strings.TrimSpace(line))
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || size < 0 {
+			return 0, fmt.Errorf("Invalid scp file size %q.", fields[1])
+		}
+		if err := scpOK(channel); err != nil {
+			return 0, err
+		}
+		n, err := s.receive(g, io.LimitReader(r, size))
+		if err == nil && n != size {
+			err = fmt.Errorf("Received %d of %d bytes.", n, size)
+		}
+		if err != nil {
+			return n, err
+		}
+		// the file is followed by a zero byte
+		if b, err := r.ReadByte(); err != nil || b != 0 {
+			return n, errors.New("The file did not end as expected.")
+		}
+		return n, scpOK(channel)
+	}
+}
+
+// scpSend sends the file asked for by "scp host:path file", waiting for the client to accept each step
+func (s *DeploymentServer) scpSend(channel ssh.Channel, g *grant) (int64, error) {
+	r := bufio.NewReader(channel)
+	if err := scpAck(r); err != nil {
+		return 0, err
+	}
+	f, size, err := s.open(g)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	name := g.File[strings.LastIndex(g.File, "/")+1:]
+	if _, err := fmt.Fprintf(channel, "C0644 %d %s\n", size, name); err != nil {
+		return 0, err
+	}
+	if err := scpAck(r); err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(channel, f)
+	if err != nil {
+		return n, err
+	}
+	if err := scpOK(channel); err != nil {
+		return n, err
+	}
+	return n, scpAck(r)
+}
+
+func scpOK(w io.Writer) error {
+	_, err := w.Write([]byte{0})
+	return err
+}
+
+// scpFail tells the client the transfer failed
+func scpFail(w io.Writer, err error) {
+	fmt.Fprintf(w, "\x02%s\n", err)
+}
+
+// scpAck waits for the client to accept the last step
+func scpAck(r *bufio.Reader) error {
+	b, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if b == 0 {
+		return nil
+	}
+	message, _ := r.ReadString('\n')
+	return fmt.Errorf("The device refused the transfer: %s", strings.TrimSpace(message))
+}
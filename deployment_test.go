@@ -0,0 +1,271 @@
+package gondi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/morganhein/gondi/gondisim"
+	"github.com/morganhein/gondi/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+// deployConfig is larger than a TFTP block, and not a multiple of it
+var deployConfig = []byte(strings.Repeat("interface GigabitEthernet0/1\n description uplink\n", 30))
+
+func newDeployment(t *testing.T, events func(TransferEvent)) (*DeploymentServer, string) {
+	root := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "router1.cfg"), deployConfig, 0644))
+	s, err := NewDeploymentServer(DeploymentOptions{
+		Root:   root,
+		TFTP:   "127.0.0.1:0",
+		FTP:    "127.0.0.1:0",
+		SCP:    "127.0.0.1:0",
+		HTTP:   "127.0.0.1:0",
+		Events: events,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, root
+}
+
+func TestDeployment_HTTP(t *testing.T) {
+	var mut sync.Mutex
+	var events []TransferEvent
+	s, root := newDeployment(t, func(e TransferEvent) {
+		mut.Lock()
+		events = append(events, e)
+		mut.Unlock()
+	})
+
+	download, err := s.Allow(schema.HTTP, "router1.cfg", false)
+	assert.NoError(t, err)
+	assert.Equal(t, download.Token+"/router1.cfg", download.Path)
+	resp, err := http.Get(download.URL())
+	if assert.NoError(t, err) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, deployConfig, body)
+	}
+	event, err := s.Wait(context.Background(), download.Token)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(deployConfig)), event.Bytes)
+
+	// the transfer can't be repeated
+	resp, err = http.Get(download.URL())
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+
+	upload, err := s.Allow(schema.HTTP, "saved/router1.cfg", true)
+	assert.NoError(t, err)
+	req, _ := http.NewRequest(http.MethodPut, upload.URL(), bytes.NewReader(deployConfig))
+	resp, err = http.DefaultClient.Do(req)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+	_, err = s.Wait(context.Background(), upload.Token)
+	assert.NoError(t, err)
+	saved, err := ioutil.ReadFile(filepath.Join(root, "saved", "router1.cfg"))
+	assert.NoError(t, err)
+	assert.Equal(t, deployConfig, saved)
+
+	mut.Lock()
+	defer mut.Unlock()
+	if assert.Len(t, events, 2) {
+		assert.False(t, events[0].Upload)
+		assert.True(t, events[1].Upload)
+		assert.Equal(t, "saved/router1.cfg", events[1].File)
+		assert.Equal(t, int64(len(deployConfig)), events[1].Bytes)
+	}
+}
+
+func TestDeployment_Denied(t *testing.T) {
+	s, _ := newDeployment(t, nil)
+	_, err := s.Allow(schema.HTTP, "missing.cfg", false)
+	assert.Error(t, err)
+	_, err = s.Allow(schema.HTTP, "", true)
+	assert.EqualError(t, err, "A transfer requires a file name.")
+
+	// files are always inside the root
+	t1, err := s.Allow(schema.HTTP, "../../router1.cfg", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "router1.cfg", t1.File)
+
+	// a token only allows its own file and direction
+	base := fmt.Sprintf("http://%s/%s/", s.Addr(schema.HTTP), t1.Token)
+	resp, err := http.Get(base + "other.cfg")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+	req, _ := http.NewRequest(http.MethodPut, base+"router1.cfg", strings.NewReader("replaced"))
+	resp, err = http.DefaultClient.Do(req)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+
+	s.Revoke(t1.Token)
+	resp, err = http.Get(t1.URL())
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+
+	s2, err := NewDeploymentServer(DeploymentOptions{Root: t.TempDir()})
+	assert.NoError(t, err)
+	_, err = s2.Allow(schema.TFTP, "router1.cfg", true)
+	assert.EqualError(t, err, "The deployment server is not serving tftp.")
+	s2.Close()
+}
+
+func TestDeployment_TFTP(t *testing.T) {
+	s, root := newDeployment(t, nil)
+	download, err := s.Allow(schema.TFTP, "router1.cfg", false)
+	assert.NoError(t, err)
+	data, err := gondisim.Fetch(download.URL())
+	assert.NoError(t, err)
+	assert.Equal(t, deployConfig, data)
+	_, err = s.Wait(context.Background(), download.Token)
+	assert.NoError(t, err)
+
+	_, err = gondisim.Fetch(download.URL())
+	assert.EqualError(t, err, "The transfer is not allowed.")
+
+	// a multiple of the block size ends with an empty block
+	exact := bytes.Repeat([]byte("x"), 2*tftpBlockSize)
+	upload, err := s.Allow(schema.TFTP, "router2.cfg", true)
+	assert.NoError(t, err)
+	assert.NoError(t, gondisim.Send(upload.URL(), exact))
+	event, err := s.Wait(context.Background(), upload.Token)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(exact)), event.Bytes)
+	saved, err := ioutil.ReadFile(filepath.Join(root, "router2.cfg"))
+	assert.NoError(t, err)
+	assert.Equal(t, exact, saved)
+}
+
+func TestDeployment_FTP(t *testing.T) {
+	s, root := newDeployment(t, nil)
+	download, err := s.Allow(schema.FTP, "router1.cfg", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "router1.cfg", download.Path)
+
+	conn, err := textproto.Dial("tcp", s.Addr(schema.FTP).String())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	ftpExpect(t, conn, "", 220)
+	ftpExpect(t, conn, "USER gondi", 331)
+	ftpExpect(t, conn, "PASS wrong", 530)
+	ftpExpect(t, conn, "USER gondi", 331)
+	ftpExpect(t, conn, "PASS "+download.Options.Password, 230)
+	ftpExpect(t, conn, "TYPE I", 200)
+	assert.Equal(t, strconv.Itoa(len(deployConfig)), ftpExpect(t, conn, "SIZE router1.cfg", 213))
+
+	data := ftpPassive(t, conn)
+	ftpExpect(t, conn, "RETR router1.cfg", 150)
+	got, _ := ioutil.ReadAll(data)
+	data.Close()
+	ftpExpect(t, conn, "", 226)
+	assert.Equal(t, deployConfig, got)
+	_, err = s.Wait(context.Background(), download.Token)
+	assert.NoError(t, err)
+
+	upload, err := s.Allow(schema.FTP, "backups/router1.cfg", true)
+	assert.NoError(t, err)
+	conn2, err := textproto.Dial("tcp", s.Addr(schema.FTP).String())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn2.Close()
+	ftpExpect(t, conn2, "", 220)
+	ftpExpect(t, conn2, "USER gondi", 331)
+	ftpExpect(t, conn2, "PASS "+upload.Options.Password, 230)
+	ftpExpect(t, conn2, "CWD /backups", 250)
+	data = ftpPassive(t, conn2)
+	ftpExpect(t, conn2, "STOR router1.cfg", 150)
+	data.Write(deployConfig)
+	data.Close()
+	ftpExpect(t, conn2, "", 226)
+	ftpExpect(t, conn2, "QUIT", 221)
+	_, err = s.Wait(context.Background(), upload.Token)
+	assert.NoError(t, err)
+	saved, err := ioutil.ReadFile(filepath.Join(root, "backups", "router1.cfg"))
+	assert.NoError(t, err)
+	assert.Equal(t, deployConfig, saved)
+}
+
+func TestDeployment_SCP(t *testing.T) {
+	s, root := newDeployment(t, nil)
+	download, err := s.Allow(schema.SCP, "router1.cfg", false)
+	assert.NoError(t, err)
+	data, err := gondisim.Fetch(download.URL())
+	assert.NoError(t, err)
+	assert.Equal(t, deployConfig, data)
+	_, err = s.Wait(context.Background(), download.Token)
+	assert.NoError(t, err)
+
+	// the token is spent
+	_, err = gondisim.Fetch(download.URL())
+	assert.Error(t, err)
+
+	upload, err := s.Allow(schema.SCP, "router3.cfg", true)
+	assert.NoError(t, err)
+	assert.NoError(t, gondisim.Send(upload.URL(), deployConfig))
+	_, err = s.Wait(context.Background(), upload.Token)
+	assert.NoError(t, err)
+	saved, err := ioutil.ReadFile(filepath.Join(root, "router3.cfg"))
+	assert.NoError(t, err)
+	assert.Equal(t, deployConfig, saved)
+}
+
+func TestDeployment_Wait(t *testing.T) {
+	s, _ := newDeployment(t, nil)
+	transfer, err := s.Allow(schema.HTTP, "router1.cfg", false)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(50)*time.Millisecond)
+	defer cancel()
+	_, err = s.Wait(ctx, transfer.Token)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	_, err = s.Wait(context.Background(), "unknown")
+	assert.EqualError(t, err, `Unknown transfer "unknown".`)
+}
+
+// ftpExpect sends the command, if any, and returns the message of the reply with the code
+func ftpExpect(t *testing.T, conn *textproto.Conn, command string, code int) string {
+	if command != "" {
+		assert.NoError(t, conn.PrintfLine("%s", command))
+	}
+	_, message, err := conn.ReadResponse(code)
+	assert.NoError(t, err, command)
+	return message
+}
+
+// ftpPassive opens a data connection with EPSV
+func ftpPassive(t *testing.T, conn *textproto.Conn) net.Conn {
+	message := ftpExpect(t, conn, "EPSV", 229)
+	port := message[strings.Index(message, "|||")+3 : strings.LastIndex(message, "|")]
+	data, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,258 @@
+package gondi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/morganhein/gondi/schema"
+)
+
+// TFTP as in RFC 1350, with 512 byte blocks and octet transfers. Netascii requests are sent as is,
+// since configs already end their lines the way the device expects.
+
+const (
+	tftpRRQ uint16 = iota + 1
+	tftpWRQ
+	tftpDATA
+	tftpACK
+	tftpERROR
+)
+
+const (
+	tftpBlockSize = 512
+	tftpRetries   = 5
+)
+
+// tftpTimeout is how long to wait for each packet before sending the last one again
+var tftpTimeout = time.Duration(3) * time.Second
+
+// The TFTP error codes
+const (
+	tftpErrUndefined uint16 = iota
+	tftpErrNotFound
+	tftpErrAccess
+)
+
+func (s *DeploymentServer) serveTFTP(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	s.listening(schema.TFTP, conn, conn.LocalAddr())
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		buf := make([]byte, 1024)
+		for {
+			n, remote, err := conn.ReadFrom(buf)
+			if err != nil {
+				// closed
+				return
+			}
+			request := make([]byte, n)
+			copy(request, buf[:n])
+			s.tftpRequest(conn.LocalAddr(), remote, request)
+		}
+	}()
+	return nil
+}
+
+// tftpRequest answers a read or write request from its own port, as the protocol requires
+func (s *DeploymentServer) tftpRequest(local, remote net.Addr, request []byte) {
+	if len(request) < 4 {
+		return
+	}
+	op := binary.BigEndian.Uint16(request)
+	if op != tftpRRQ && op != tftpWRQ {
+		return
+	}
+	fields := strings.Split(string(request[2:]), "\x00")
+	if len(fields) < 2 {
+		return
+	}
+	host, _, _ := net.SplitHostPort(local.String())
+	conn, err := net.ListenPacket("udp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		s.log.Warningf("Unable to answer a TFTP request from %s: %s", remote, err)
+		return
+	}
+	s.track(conn, func() {
+		token, file := splitToken(fields[0])
+		upload := op == tftpWRQ
+		g, err := s.claim(schema.TFTP, token, file, upload)
+		if err != nil {
+			tftpError(conn, remote, tftpErrAccess, err.Error())
+			return
+		}
+		start := time.Now()
+		var n int64
+		if upload {
+			n, err = s.receive(g, &tftpReader{conn: conn, remote: remote})
+			if err != nil {
+				tftpError(conn, remote, tftpErrUndefined, err.Error())
+			}
+		} else {
+			n, err = s.tftpSend(conn, remote, g)
+		}
+		s.finish(g, remote.String(), n, start, err)
+	})
+}
+
+// tftpSend sends an allowed download, waiting for each block to be acknowledged
+func (s *DeploymentServer) tftpSend(conn net.PacketConn, remote net.Addr, g *grant) (int64, error) {
+	f, _, err := s.open(g)
+	if err != nil {
+		tftpError(conn, remote, tftpErrNotFound, "File not found.")
+		return 0, err
+	}
+	defer f.Close()
+	var sent int64
+	block := uint16(1)
+	data := make([]byte, tftpBlockSize)
+	for {
+		n, err := io.ReadFull(f, data)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			tftpError(conn, remote, tftpErrUndefined, err.Error())
+			return sent, err
+		}
+		packet := make([]byte, 4+n)
+		binary.BigEndian.PutUint16(packet, tftpDATA)
+		binary.BigEndian.PutUint16(packet[2:], block)
+		copy(packet[4:], data[:n])
+		if err := tftpExchange(conn, remote, packet, tftpACK, block); err != nil {
+			return sent, err
+		}
+		sent += int64(n)
+		if n < tftpBlockSize {
+			return sent, nil
+		}
+		block++
+	}
+}
+
+// tftpExchange sends the packet until the reply with the opcode and block number arrives
+func tftpExchange(conn net.PacketConn, remote net.Addr, packet []byte, op, block uint16) error {
+	buf := make([]byte, 4+tftpBlockSize)
+	for try := 0; try < tftpRetries; try++ {
+		if _, err := conn.WriteTo(packet, remote); err != nil {
+			return err
+		}
+		deadline := time.Now().Add(tftpTimeout)
+		for {
+			conn.SetReadDeadline(deadline)
+			n, from, err := conn.ReadFrom(buf)
+			if err, ok := err.(net.Error); ok && err.Timeout() {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if from.String() != remote.String() || n < 4 {
+				continue
+			}
+			switch binary.BigEndian.Uint16(buf) {
+			case tftpERROR:
+				return fmt.Errorf("The device aborted the transfer: %s", bytes.TrimRight(buf[4:n], "\x00"))
+			case op:
+				if binary.BigEndian.Uint16(buf[2:]) == block {
+					return nil
+				}
+			}
+		}
+	}
+	return errors.New("The TFTP transfer timed out.")
+}
+
+// tftpReader reads the data blocks of an upload, acknowledging each of them
+type tftpReader struct {
+	conn    net.PacketConn
+	remote  net.Addr
+	block   uint16
+	pending []byte // the data of the last block, not yet read
+	done    bool
+}
+
+func (r *tftpReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// next acknowledges the last block, and waits for the one after it
+func (r *tftpReader) next() error {
+	ack := make([]byte, 4)
+	binary.BigEndian.PutUint16(ack, tftpACK)
+	binary.BigEndian.PutUint16(ack[2:], r.block)
+	buf := make([]byte, 4+tftpBlockSize)
+	for try := 0; try < tftpRetries; try++ {
+		if _, err := r.conn.WriteTo(ack, r.remote); err != nil {
+			return err
+		}
+		deadline := time.Now().Add(tftpTimeout)
+		for {
+			r.conn.SetReadDeadline(deadline)
+			n, from, err := r.conn.ReadFrom(buf)
+			if err, ok := err.(net.Error); ok && err.Timeout() {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if from.String() != r.remote.String() || n < 4 {
+				continue
+			}
+			switch binary.BigEndian.Uint16(buf) {
+			case tftpERROR:
+				return fmt.Errorf("The device aborted the transfer: %s", bytes.TrimRight(buf[4:n], "\x00"))
+			case tftpDATA:
+				if binary.BigEndian.Uint16(buf[2:]) != r.block+1 {
+					// a block sent again, because our acknowledgement was lost
+					continue
+				}
+				r.block++
+				r.pending = append([]byte(nil), buf[4:n]...)
+				if n-4 < tftpBlockSize {
+					r.done = true
+					// acknowledge the final block
+					binary.BigEndian.PutUint16(ack[2:], r.block)
+					_, err := r.conn.WriteTo(ack, r.remote)
+					return err
+				}
+				return nil
+			}
+		}
+	}
+	return errors.New("The TFTP transfer timed out.")
+}
+
+func tftpError(conn net.PacketConn, remote net.Addr, code uint16, message string) {
+	packet := make([]byte, 4, 5+len(message))
+	binary.BigEndian.PutUint16(packet, tftpERROR)
+	binary.BigEndian.PutUint16(packet[2:], code)
+	packet = append(append(packet, message...), 0)
+	conn.WriteTo(packet, remote)
+}
+
+// splitToken splits a path of "token/file" as used by TFTP and HTTP
+func splitToken(p string) (token, file string) {
+	p = strings.TrimPrefix(p, "/")
+	i := strings.Index(p, "/")
+	if i < 0 {
+		return p, ""
+	}
+	return p[:i], p[i+1:]
+}
@@ -0,0 +1,63 @@
+package format
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/morganhein/gondi"
+)
+
+// csvHeader names the columns of the CSV format. The output lines are joined into a single field.
+var csvHeader = []string{"device", "command", "status", "error", "start", "end", "duration", "output"}
+
+// csvWriter writes a row per result, as each result is given
+type csvWriter struct {
+	w      *csv.Writer
+	header bool // the header was written
+}
+
+func newCSV(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Write(r gondi.Result) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	rec := NewRecord(r)
+	row := []string{
+		rec.Device,
+		rec.Command,
+		status(r),
+		rec.Error,
+		rec.Start.Format(time.RFC3339Nano),
+		rec.End.Format(time.RFC3339Nano),
+		rec.Duration,
+		strings.Join(rec.Output, "\n"),
+	}
+	if err := c.w.Write(row); err != nil {
+		return err
+	}
+	// flush each row, so results show up as they finish
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// Close writes the header if there were no results.
+func (c *csvWriter) Close() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) writeHeader() error {
+	if c.header {
+		return nil
+	}
+	c.header = true
+	return c.w.Write(csvHeader)
+}
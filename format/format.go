@@ -0,0 +1,146 @@
+// Package format writes the results of Manager.RunAll as JSON, NDJSON, CSV, an aligned table, or
+// plain text. The writers take the results one at a time, so they can be given each result as it
+// finishes from RunOptions.Progress:
+//
+//	out, _ := format.New(os.Stdout, "ndjson")
+//	report := m.RunAll(ctx, ids, gondi.Command("show version"), gondi.RunOptions{
+//		Progress: func(r gondi.Result, done, total int) { out.Write(r) },
+//	})
+//	out.Close()
+package format
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/morganhein/gondi"
+)
+
+// Writer writes results in a format. The streaming formats (ndjson, csv and text) write each result
+// as it is given; json and table need every result, so they write them on Close, sorted by device.
+// Writers are not safe for concurrent use, but Progress calls never are concurrent.
+type Writer interface {
+	Write(result gondi.Result) error
+	// Close writes what is left. It doesn't close the underlying writer.
+	Close() error
+}
+
+// The names of the formats
+const (
+	JSON   = "json"
+	NDJSON = "ndjson"
+	CSV    = "csv"
+	Table  = "table"
+	Text   = "text"
+)
+
+// Names returns the names of the formats.
+func Names() []string {
+	return []string{JSON, NDJSON, CSV, Table, Text}
+}
+
+// New returns a writer of the named format.
+func New(w io.Writer, name string) (Writer, error) {
+	switch name {
+	case JSON:
+		return &jsonWriter{w: w}, nil
+	case NDJSON:
+		return newNDJSON(w), nil
+	case CSV:
+		return newCSV(w), nil
+	case Table:
+		return &tableWriter{w: w}, nil
+	case Text:
+		return &textWriter{w: w}, nil
+	}
+	return nil, fmt.Errorf("Unknown format %q, expected one of %s.", name, strings.Join(Names(), ", "))
+}
+
+// WriteReport writes every result of the report in the named format.
+func WriteReport(w io.Writer, name string, report *gondi.Report) error {
+	out, err := New(w, name)
+	if err != nil {
+		return err
+	}
+	for _, r := range report.Results {
+		if err := out.Write(r); err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
+
+// Record is the serialized form of a result.
+type Record struct {
+	Device   string    `json:"device"`
+	Command  string    `json:"command"`
+	Output   []string  `json:"output"`
+	Error    string    `json:"error,omitempty"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration string    `json:"duration"`
+}
+
+// NewRecord returns the serialized form of the result.
+func NewRecord(r gondi.Result) Record {
+	rec := Record{
+		Device:   r.DeviceID,
+		Command:  r.Command,
+		Output:   r.Output,
+		Start:    r.Start,
+		End:      r.End,
+		Duration: r.Duration().Round(time.Millisecond).String(),
+	}
+	if rec.Output == nil {
+		rec.Output = []string{}
+	}
+	if r.Err != nil {
+		rec.Error = r.Err.Error()
+	}
+	return rec
+}
+
+// status describes whether the result succeeded
+func status(r gondi.Result) string {
+	if r.Err != nil {
+		return "failed"
+	}
+	return "ok"
+}
+
+// sortResults orders the results by device, then command, keeping the order of equal ones
+func sortResults(results []gondi.Result) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].DeviceID != results[j].DeviceID {
+			return results[i].DeviceID < results[j].DeviceID
+		}
+		return results[i].Command < results[j].Command
+	})
+}
+
+// summary counts the results that succeeded, and the time from the first start to the last end
+type summary struct {
+	total, succeeded int
+	start, end       time.Time
+}
+
+func (s *summary) add(r gondi.Result) {
+	s.total++
+	if r.Err == nil {
+		s.succeeded++
+	}
+	if s.start.IsZero() || r.Start.Before(s.start) {
+		s.start = r.Start
+	}
+	if r.End.After(s.end) {
+		s.end = r.End
+	}
+}
+
+func (s *summary) String() string {
+	return fmt.Sprintf("%d of %d devices succeeded in %s.", s.succeeded, s.total,
+		s.end.Sub(s.start).Round(time.Millisecond))
+}
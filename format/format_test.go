@@ -0,0 +1,96 @@
+package format
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/morganhein/gondi"
+	"github.com/stretchr/testify/assert"
+)
+
+var start = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// report has a failed device before a successful one, out of order
+var report = &gondi.Report{
+	Results: []gondi.Result{
+		{DeviceID: "edge1", Command: "show version", Err: errors.New("Unable to connect."),
+			Start: start, End: start.Add(time.Duration(2) * time.Second)},
+		{DeviceID: "core1", Command: "show version", Output: []string{"IOS 15.2", "uptime\t3 weeks"},
+			Start: start, End: start.Add(time.Duration(1500) * time.Millisecond)},
+	},
+}
+
+func write(t *testing.T, name string) string {
+	var buf bytes.Buffer
+	assert.NoError(t, WriteReport(&buf, name, report))
+	return buf.String()
+}
+
+func TestNew_Unknown(t *testing.T) {
+	_, err := New(&bytes.Buffer{}, "xml")
+	assert.EqualError(t, err, `Unknown format "xml", expected one of json, ndjson, csv, table, text.`)
+}
+
+func TestJSON(t *testing.T) {
+	var records []Record
+	assert.NoError(t, json.Unmarshal([]byte(write(t, JSON)), &records))
+	assert.Equal(t, []Record{
+		{Device: "core1", Command: "show version", Output: []string{"IOS 15.2", "uptime\t3 weeks"},
+			Start: start, End: start.Add(time.Duration(1500) * time.Millisecond), Duration: "1.5s"},
+		{Device: "edge1", Command: "show version", Output: []string{}, Error: "Unable to connect.",
+			Start: start, End: start.Add(time.Duration(2) * time.Second), Duration: "2s"},
+	}, records)
+
+	var buf bytes.Buffer
+	out, _ := New(&buf, JSON)
+	assert.NoError(t, out.Close())
+	assert.Equal(t, "[]\n", buf.String())
+}
+
+func TestNDJSON(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(write(t, NDJSON)), "\n")
+	assert.Len(t, lines, 2)
+	var rec Record
+	// written in the order given
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &rec))
+	assert.Equal(t, "edge1", rec.Device)
+	assert.Equal(t, "Unable to connect.", rec.Error)
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &rec))
+	assert.Equal(t, "core1", rec.Device)
+}
+
+func TestCSV(t *testing.T) {
+	rows, err := csv.NewReader(strings.NewReader(write(t, CSV))).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{
+		csvHeader,
+		{"edge1", "show version", "failed", "Unable to connect.", "2024-03-01T12:00:00Z", "2024-03-01T12:00:02Z", "2s", ""},
+		{"core1", "show version", "ok", "", "2024-03-01T12:00:00Z", "2024-03-01T12:00:01.5Z", "1.5s", "IOS 15.2\nuptime\t3 weeks"},
+	}, rows)
+
+	var buf bytes.Buffer
+	out, _ := New(&buf, CSV)
+	assert.NoError(t, out.Close())
+	assert.Equal(t, strings.Join(csvHeader, ",")+"\n", buf.String())
+}
+
+func TestTable(t *testing.T) {
+	assert.Equal(t, ""+
+		"DEVICE  COMMAND       STATUS  DURATION  OUTPUT\n"+
+		"core1   show version  ok      1.5s      IOS 15.2\n"+
+		"                                        uptime    3 weeks\n"+
+		"edge1   show version  failed  2s        Unable to connect.\n"+
+		"1 of 2 devices succeeded in 2s.\n", write(t, Table))
+}
+
+func TestText(t *testing.T) {
+	assert.Equal(t, ""+
+		"edge1: show version failed: Unable to connect.\n\n"+
+		"core1: show version\nIOS 15.2\nuptime\t3 weeks\n\n"+
+		"1 of 2 devices succeeded in 2s.\n", write(t, Text))
+}
@@ -0,0 +1,47 @@
+package format
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/morganhein/gondi"
+)
+
+// jsonWriter writes an indented array of the records
+type jsonWriter struct {
+	w       io.Writer
+	results []gondi.Result
+}
+
+func (j *jsonWriter) Write(r gondi.Result) error {
+	j.results = append(j.results, r)
+	return nil
+}
+
+func (j *jsonWriter) Close() error {
+	sortResults(j.results)
+	records := make([]Record, len(j.results))
+	for i, r := range j.results {
+		records[i] = NewRecord(r)
+	}
+	enc := json.NewEncoder(j.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(records)
+}
+
+// ndjsonWriter writes a record per line, as each result is given
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func newNDJSON(w io.Writer) *ndjsonWriter {
+	return &ndjsonWriter{enc: json.NewEncoder(w)}
+}
+
+func (n *ndjsonWriter) Write(r gondi.Result) error {
+	return n.enc.Encode(NewRecord(r))
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,85 @@
+package format
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/morganhein/gondi"
+)
+
+// tableWriter writes the results as aligned columns, with a row per line of output, followed by a summary
+type tableWriter struct {
+	w       io.Writer
+	results []gondi.Result
+	summary summary
+}
+
+func (t *tableWriter) Write(r gondi.Result) error {
+	t.results = append(t.results, r)
+	t.summary.add(r)
+	return nil
+}
+
+func (t *tableWriter) Close() error {
+	sortResults(t.results)
+	tw := tabwriter.NewWriter(t.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DEVICE\tCOMMAND\tSTATUS\tDURATION\tOUTPUT")
+	for _, r := range t.results {
+		rec := NewRecord(r)
+		lines := rec.Output
+		if r.Err != nil {
+			lines = []string{rec.Error}
+		}
+		first := ""
+		if len(lines) > 0 {
+			first = lines[0]
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", cell(rec.Device), cell(rec.Command), status(r), rec.Duration, cell(first))
+		for i := 1; i < len(lines); i++ {
+			fmt.Fprintf(tw, "\t\t\t\t%s\n", cell(lines[i]))
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if t.summary.total == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintln(t.w, t.summary.String())
+	return err
+}
+
+// cell keeps tabs in the text from breaking the columns
+func cell(text string) string {
+	return strings.Replace(text, "\t", "    ", -1)
+}
+
+// textWriter writes the output of each device under a heading, as each result is given, and a summary on Close
+type textWriter struct {
+	w       io.Writer
+	summary summary
+}
+
+func (t *textWriter) Write(r gondi.Result) error {
+	t.summary.add(r)
+	if r.Err != nil {
+		_, err := fmt.Fprintf(t.w, "%s: %s failed: %s\n\n", r.DeviceID, r.Command, r.Err)
+		return err
+	}
+	fmt.Fprintf(t.w, "%s: %s\n", r.DeviceID, r.Command)
+	for _, line := range r.Output {
+		fmt.Fprintln(t.w, line)
+	}
+	_, err := fmt.Fprintln(t.w)
+	return err
+}
+
+func (t *textWriter) Close() error {
+	if t.summary.total == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintln(t.w, t.summary.String())
+	return err
+}
@@ -1,55 +1,286 @@
 package gondi
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/morganhein/gondi/logger"
 	"github.com/morganhein/gondi/schema"
-	"github.com/morganhein/gondi/transport"
+	"github.com/morganhein/gondi/selector"
 )
 
+// ErrUnknownDevice is wrapped by the errors returned for ids that were never registered.
+var ErrUnknownDevice = errors.New("Unknown device")
+
+// ManagerOptions tune the pool. Zero values use the defaults.
+type ManagerOptions struct {
+	IdleTimeout    time.Duration // close sessions unused for this long, 5 minutes by default
+	HealthInterval time.Duration // how often idle sessions are checked, 30 seconds by default
+	HealthTimeout  time.Duration // how long a session has to answer a health check, 10 seconds by default
+	ConnectTimeout time.Duration // how long each connection method is tried for, 1 minute by default
+	// Credentials looks up the credentials of the devices that don't have a provider of their own
+	Credentials schema.CredentialProvider
+}
+
+// Manager is a pool of device sessions. Devices are registered with their connection details,
+// and connect lazily on first use. Sessions left unused for the idle timeout are closed, and
+// the others are health checked in the background, reconnecting the ones that dropped.
+// A Manager is safe for concurrent use.
 type Manager struct {
-	devices      map[string]schema.Device
+	mut          sync.RWMutex
+	devices      map[string]*pool
+	options      ManagerOptions
 	dispatchQuit chan bool
+	done         chan struct{}
+	stop         sync.Once
 	log          schema.Logger
 }
 
+// NewG creates a manager with the default options.
 func NewG() *Manager {
+	return NewManager(ManagerOptions{})
+}
+
+// NewManager creates a manager, and starts its health checks. Call Shutdown to stop them.
+func NewManager(options ManagerOptions) *Manager {
+	if options.IdleTimeout <= 0 {
+		options.IdleTimeout = time.Duration(5) * time.Minute
+	}
+	if options.HealthInterval <= 0 {
+		options.HealthInterval = time.Duration(30) * time.Second
+	}
+	if options.HealthTimeout <= 0 {
+		options.HealthTimeout = time.Duration(10) * time.Second
+	}
+	if options.ConnectTimeout <= 0 {
+		options.ConnectTimeout = time.Duration(1) * time.Minute
+	}
 	g := &Manager{
-		devices:      make(map[string]schema.Device),
+		devices:      make(map[string]*pool),
+		options:      options,
 		dispatchQuit: make(chan bool, 1),
+		done:         make(chan struct{}),
 		log:          logger.Log,
 	}
+	go g.maintain()
 	return g
 }
 
-// Connect tries to connect to the given device using the proposed method. It does not handle trying to connect
-// using other methods if the primary one fails, that should be handled upstream if there is an error.
-func (m *Manager) Connect(deviceType schema.DeviceType, id string, method schema.ConnectionMethod,
+// Register adds a device to the pool without connecting to it.
+func (m *Manager) Register(config DeviceConfig) error {
+	if config.ID == "" {
+		return errors.New("A device requires an id.")
+	}
+	p, err := newPool(config, m.options)
+	if err != nil {
+		return err
+	}
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if _, ok := m.devices[config.ID]; ok {
+		return fmt.Errorf("A device is already registered with the id %q.", config.ID)
+	}
+	m.devices[config.ID] = p
+	return nil
+}
+
+// Unregister disconnects the device and removes it from the pool.
+func (m *Manager) Unregister(id string) error {
+	m.mut.Lock()
+	p, ok := m.devices[id]
+	delete(m.devices, id)
+	m.mut.Unlock()
+	if !ok {
+		return fmt.Errorf("%w %q.", ErrUnknownDevice, id)
+	}
+	p.mut.Lock()
+	p.closed = true
+	p.mut.Unlock()
+	p.disconnect()
+	return nil
+}
+
+// Connect registers the device and connects to it straight away, returning the pooled device.
+// The methods are tried in order until one succeeds, falling back to the driver's supported
+// methods if none are given. The method that worked is recorded in the device's Options().Method.
+// If every method fails, the returned *ConnectError explains why each of them did.
+func (m *Manager) Connect(deviceType schema.DeviceType, id string, methods []schema.ConnectionMethod,
 	options schema.ConnectOptions) (schema.Device, error) {
-	device := transport.New(deviceType)
 	m.log.Info("Trying to connect from Manager.")
+	err := m.Register(DeviceConfig{ID: id, Platform: deviceType, Methods: methods, Options: options})
+	if err != nil {
+		return nil, err
+	}
+	p, err := m.pool(id)
+	if err != nil {
+		return nil, err
+	}
+	s, err := p.acquire(context.Background())
+	if err != nil {
+		m.Unregister(id)
+		return nil, err
+	}
+	p.release(s)
+	return &pooled{pool: p}, nil
+}
+
+func (m *Manager) pool(id string) (*pool, error) {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	p, ok := m.devices[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %q.", ErrUnknownDevice, id)
+	}
+	return p, nil
+}
+
+// GetDevice returns the pooled device registered with the id. Each command it runs borrows
+// a session from the pool, connecting if needed. Use Acquire to run several commands that
+// depend on each other on the same session.
+func (m *Manager) GetDevice(id string) (device schema.Device, err error) {
+	p, err := m.pool(id)
+	if err != nil {
+		return nil, err
+	}
+	return &pooled{pool: p}, nil
+}
+
+// Acquire reserves a session of the device, connecting if needed, and waiting for a session to
+// be released if the device already has MaxSessions busy. The release function must be called
+// once done, and the device must not be used after that.
+func (m *Manager) Acquire(ctx context.Context, id string) (device schema.Device, release func(), err error) {
+	p, err := m.pool(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := p.acquire(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	var once sync.Once
+	return s.device, func() { once.Do(func() { p.release(s) }) }, nil
+}
 
-	for _, supported := range device.SupportedMethods() {
-		if supported == method {
-			m.devices[id] = device
-			if err := device.Connect(method, options); err != nil {
-				return nil, err
-			}
-			return device, nil
+// State returns the state of the device.
+func (m *Manager) State(id string) (State, error) {
+	p, err := m.pool(id)
+	if err != nil {
+		return Closed, err
+	}
+	return p.state(), nil
+}
+
+// Devices returns the sorted ids of the registered devices.
+func (m *Manager) Devices() []string {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	ids := make([]string, 0, len(m.devices))
+	for id := range m.devices {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Select returns the sorted ids of the registered devices matching the selector expression,
+// ie "site=dc1 && platform=junos && !tag:maintenance". See the selector package for the syntax.
+func (m *Manager) Select(expr string) ([]string, error) {
+	s, err := selector.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	ids := []string{}
+	for id, p := range m.devices {
+		p.mut.Lock()
+		target := p.config.target()
+		p.mut.Unlock()
+		if s.Match(target) {
+			ids = append(ids, id)
 		}
 	}
+	sort.Strings(ids)
+	return ids, nil
+}
 
-	return nil, errors.New("Device does not support the method requested.")
+// maintain closes idle sessions and health checks the others until shutdown
+func (m *Manager) maintain() {
+	defer close(m.done)
+	ticker := time.NewTicker(m.options.HealthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.dispatchQuit:
+			return
+		case <-ticker.C:
+			m.check()
+		}
+	}
 }
 
-func (m *Manager) GetDevice(id string) (device schema.Device, err error) {
-	return m.devices[id], nil
+func (m *Manager) check() {
+	m.mut.RLock()
+	pools := make([]*pool, 0, len(m.devices))
+	for _, p := range m.devices {
+		pools = append(pools, p)
+	}
+	m.mut.RUnlock()
+
+	wg := sync.WaitGroup{}
+	for _, p := range pools {
+		timeout := p.config.IdleTimeout
+		if timeout <= 0 {
+			timeout = m.options.IdleTimeout
+		}
+		expired, alive := p.idle(time.Now().Add(-timeout))
+		for _, s := range expired {
+			m.log.Debugf("Closing the idle session to %s.", p.config.ID)
+			p.drop(s)
+		}
+		for _, s := range alive {
+			wg.Add(1)
+			go func(p *pool, s *session) {
+				defer wg.Done()
+				if healthy(s.device, m.options.HealthTimeout) {
+					p.put(s, false)
+					return
+				}
+				m.log.Warningf("The session to %s dropped, reconnecting.", p.config.ID)
+				p.drop(s)
+				m.reconnect(p)
+			}(p, s)
+		}
+	}
+	wg.Wait()
+}
+
+// reconnect replaces a dropped session. If it fails, the device is marked as failed and tries again on next use.
+func (m *Manager) reconnect(p *pool) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.options.HealthTimeout)
+	defer cancel()
+	s, err := p.acquire(ctx)
+	if err != nil {
+		m.log.Warningf("Unable to reconnect to %s: %s", p.config.ID, err)
+		return
+	}
+	p.release(s)
 }
 
+// Shutdown stops the health checks and disconnects every device.
 func (m *Manager) Shutdown() error {
-	for _, d := range m.devices {
-		_ = d.Disconnect()
+	m.stop.Do(func() {
+		m.dispatchQuit <- true
+		<-m.done
+	})
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	for _, p := range m.devices {
+		p.disconnect()
 	}
 	return nil
 }
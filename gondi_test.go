@@ -0,0 +1,332 @@
+package gondi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/morganhein/gondi/credentials"
+	"github.com/morganhein/gondi/gondisim"
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+// startSim starts a fake IOS switch whose "show slow" command takes a while to answer.
+func startSim(t *testing.T) *gondisim.Server {
+	p, err := gondisim.Lookup("cisco_ios")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := gondisim.New(p)
+	sim.Handler = func(command string, term gondisim.Terminal) bool {
+		if !strings.HasPrefix(command, "show slow") {
+			return false
+		}
+		time.Sleep(time.Duration(200) * time.Millisecond)
+		term.Print("done")
+		return true
+	}
+	if err := sim.StartTelnet(); err != nil {
+		t.Fatal(err)
+	}
+	return sim
+}
+
+func simConfig(id string, sim *gondisim.Server) DeviceConfig {
+	return DeviceConfig{
+		ID:       id,
+		Platform: transport.Cisco,
+		Methods:  []schema.ConnectionMethod{transport.Telnet},
+		Options: schema.ConnectOptions{
+			Host:     sim.Host(),
+			Port:     sim.Port(),
+			Username: sim.Username,
+			Password: sim.Password,
+		},
+	}
+}
+
+// logins counts the sessions opened to the simulator, from the command each driver sends after login
+func logins(sim *gondisim.Server) int {
+	n := 0
+	for _, command := range sim.Commands() {
+		if command == "terminal length 0" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestManager_Register(t *testing.T) {
+	g := NewG()
+	defer g.Shutdown()
+
+	assert.NoError(t, g.Register(DeviceConfig{ID: "sw1", Platform: transport.Cisco}))
+	assert.Error(t, g.Register(DeviceConfig{ID: "sw1", Platform: transport.Cisco}))
+	assert.True(t, errors.Is(g.Register(DeviceConfig{ID: "sw2", Platform: "carrier_pigeon"}),
+		transport.ErrUnknownPlatform))
+
+	_, err := g.GetDevice("missing")
+	assert.True(t, errors.Is(err, ErrUnknownDevice))
+	_, err = g.State("missing")
+	assert.True(t, errors.Is(err, ErrUnknownDevice))
+
+	assert.Equal(t, []string{"sw1"}, g.Devices())
+	assert.NoError(t, g.Unregister("sw1"))
+	assert.Empty(t, g.Devices())
+}
+
+func TestManager_LazyConnect(t *testing.T) {
+	sim := startSim(t)
+	defer sim.Close()
+	g := NewG()
+	defer g.Shutdown()
+
+	assert.NoError(t, g.Register(simConfig("sw1", sim)))
+	state, _ := g.State("sw1")
+	assert.Equal(t, Closed, state)
+	assert.Equal(t, 0, logins(sim))
+
+	dev, err := g.GetDevice("sw1")
+	assert.NoError(t, err)
+	res, err := dev.WriteCapture("show slow")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"done", "access1>"}, res)
+	state, _ = g.State("sw1")
+	assert.Equal(t, Ready, state)
+
+	// the session is reused
+	_, err = dev.WriteCapture("show slow")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, logins(sim))
+}
+
+func TestManager_Failed(t *testing.T) {
+	// a port nothing listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	g := NewG()
+	defer g.Shutdown()
+	assert.NoError(t, g.Register(DeviceConfig{
+		ID:       "gone",
+		Platform: transport.Cisco,
+		Methods:  []schema.ConnectionMethod{transport.Telnet},
+		Options:  schema.ConnectOptions{Host: "127.0.0.1", Port: port},
+	}))
+	dev, _ := g.GetDevice("gone")
+	_, err = dev.WriteCapture("show version")
+	assert.Error(t, err)
+	state, _ := g.State("gone")
+	assert.Equal(t, Failed, state)
+}
+
+func TestManager_MaxSessions(t *testing.T) {
+	sim := startSim(t)
+	defer sim.Close()
+	g := NewG()
+	defer g.Shutdown()
+
+	config := simConfig("sw1", sim)
+	config.MaxSessions = 2
+	assert.NoError(t, g.Register(config))
+	dev, _ := g.GetDevice("sw1")
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := dev.WriteCapture("show slow")
+			assert.NoError(t, err)
+		}()
+	}
+	assert.Eventually(t, func() bool {
+		state, _ := g.State("sw1")
+		return state == Busy
+	}, time.Second, time.Duration(5)*time.Millisecond)
+	wg.Wait()
+	assert.Equal(t, 2, logins(sim))
+}
+
+func TestManager_Acquire(t *testing.T) {
+	sim := startSim(t)
+	defer sim.Close()
+	g := NewG()
+	defer g.Shutdown()
+	assert.NoError(t, g.Register(simConfig("sw1", sim)))
+
+	dev, release, err := g.Acquire(context.Background(), "sw1")
+	assert.NoError(t, err)
+
+	// the only session is reserved, so others wait
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(100)*time.Millisecond)
+	defer cancel()
+	_, _, err = g.Acquire(ctx, "sw1")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	_, err = dev.WriteCapture("show version")
+	assert.NoError(t, err)
+	release()
+	release()
+
+	_, release, err = g.Acquire(context.Background(), "sw1")
+	assert.NoError(t, err)
+	release()
+}
+
+func TestManager_IdleTimeout(t *testing.T) {
+	sim := startSim(t)
+	defer sim.Close()
+	g := NewManager(ManagerOptions{IdleTimeout: time.Duration(100) * time.Millisecond,
+		HealthInterval: time.Duration(20) * time.Millisecond})
+	defer g.Shutdown()
+	assert.NoError(t, g.Register(simConfig("sw1", sim)))
+	dev, _ := g.GetDevice("sw1")
+
+	_, err := dev.WriteCapture("show version")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		state, _ := g.State("sw1")
+		return state == Closed
+	}, time.Second, time.Duration(10)*time.Millisecond)
+
+	// connects again on the next use
+	_, err = dev.WriteCapture("show version")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, logins(sim))
+}
+
+func TestManager_Reconnect(t *testing.T) {
+	sim := startSim(t)
+	defer sim.Close()
+	g := NewManager(ManagerOptions{HealthInterval: time.Duration(50) * time.Millisecond,
+		HealthTimeout: time.Duration(200) * time.Millisecond})
+	defer g.Shutdown()
+	assert.NoError(t, g.Register(simConfig("sw1", sim)))
+	dev, _ := g.GetDevice("sw1")
+
+	_, err := dev.WriteCapture("show version")
+	assert.NoError(t, err)
+	sim.Drop()
+
+	// the health check notices and logs in again, without waiting for the next command
+	assert.Eventually(t, func() bool {
+		return logins(sim) == 2
+	}, time.Duration(3)*time.Second, time.Duration(20)*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		state, _ := g.State("sw1")
+		return state == Ready
+	}, time.Second, time.Duration(10)*time.Millisecond)
+	res, err := dev.WriteCapture("show slow")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"done", "access1>"}, res)
+}
+
+func TestState_String(t *testing.T) {
+	var names []string
+	for _, s := range []State{Closed, Connecting, Ready, Busy, Failed} {
+		names = append(names, s.String())
+	}
+	assert.Equal(t, "closed connecting ready busy failed", strings.Join(names, " "))
+	assert.Equal(t, "unknown", fmt.Sprint(State(42)))
+}
+
+func TestManager_Fallback(t *testing.T) {
+	sim := startSim(t)
+	defer sim.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	closed := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	g := NewG()
+	defer g.Shutdown()
+
+	// nothing answers SSH, so the telnet attempt is the one that succeeds
+	config := simConfig("sw1", sim)
+	config.Methods = []schema.ConnectionMethod{transport.SSH, transport.Telnet}
+	config.Ports = map[schema.ConnectionMethod]int{transport.SSH: closed}
+	assert.NoError(t, g.Register(config))
+	dev, _ := g.GetDevice("sw1")
+	res, err := dev.WriteCapture("show slow")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"done", "access1>"}, res)
+	assert.Equal(t, transport.Telnet, dev.Options().Method)
+}
+
+func TestManager_ConnectError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	g := NewManager(ManagerOptions{ConnectTimeout: time.Duration(2) * time.Second})
+	defer g.Shutdown()
+	_, err = g.Connect(transport.Cisco, "gone", []schema.ConnectionMethod{transport.Telnet, schema.ConnectionMethod(9)},
+		schema.ConnectOptions{Host: "127.0.0.1", Port: port})
+	var connectErr *ConnectError
+	if assert.True(t, errors.As(err, &connectErr)) {
+		assert.Equal(t, "gone", connectErr.ID)
+		assert.Len(t, connectErr.Attempts, 2)
+		assert.Equal(t, transport.Telnet, connectErr.Attempts[0].Method)
+	}
+	assert.Contains(t, err.Error(), "telnet: ")
+	assert.Contains(t, err.Error(), "method 9: ")
+	var opErr *net.OpError
+	assert.True(t, errors.As(err, &opErr))
+	// the device isn't left registered
+	assert.Empty(t, g.Devices())
+}
+
+func TestManager_Select(t *testing.T) {
+	g := NewG()
+	defer g.Shutdown()
+	assert.NoError(t, g.Register(DeviceConfig{ID: "core1", Platform: transport.Juniper,
+		Labels: map[string]string{"site": "dc1"}, Tags: []string{"core"}}))
+	assert.NoError(t, g.Register(DeviceConfig{ID: "core2", Platform: transport.Juniper,
+		Labels: map[string]string{"site": "dc2"}, Tags: []string{"core", "maintenance"}}))
+	assert.NoError(t, g.Register(DeviceConfig{ID: "access1", Platform: transport.Cisco,
+		Labels: map[string]string{"site": "dc1", "platform": "junos"}, Groups: []string{"access"},
+		Options: schema.ConnectOptions{Host: "10.0.0.1"}}))
+
+	ids, err := g.Select("platform=junos && !tag:maintenance")
+	assert.NoError(t, err)
+	// the label doesn't override the driver's platform
+	assert.Equal(t, []string{"core1"}, ids)
+	ids, err = g.Select("site=dc1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"access1", "core1"}, ids)
+	ids, err = g.Select("host=10.0.0.* || group:none")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"access1"}, ids)
+	ids, err = g.Select("")
+	assert.NoError(t, err)
+	assert.Equal(t, g.Devices(), ids)
+	_, err = g.Select("site=")
+	assert.Error(t, err)
+}
+
+func TestManager_Credentials(t *testing.T) {
+	sim := startSim(t)
+	defer sim.Close()
+	sim.Password = "s3cret!"
+	g := NewManager(ManagerOptions{Credentials: credentials.Static{Password: "s3cret!"}})
+	defer g.Shutdown()
+
+	config := simConfig("sw1", sim)
+	config.Options.Password = ""
+	assert.NoError(t, g.Register(config))
+	dev, _ := g.GetDevice("sw1")
+	_, err := dev.WriteCapture("show slow")
+	assert.NoError(t, err)
+	// the looked up password isn't kept in the device's options
+	assert.Empty(t, dev.Options().Password)
+}
@@ -0,0 +1,212 @@
+package gondisim
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// The SSH server serves the device's files over the sftp subsystem, unless SFTP is false, and to
+// "scp -t" and "scp -f". The files are kept in memory, by path.
+
+// File returns the contents of the file on the device.
+func (s *Server) File(path string) ([]byte, bool) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	data, ok := s.files[path]
+	return data, ok
+}
+
+// SetFile writes the file on the device.
+func (s *Server) SetFile(path string, data []byte) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.files == nil {
+		s.files = make(map[string][]byte)
+	}
+	s.files[path] = append([]byte(nil), data...)
+}
+
+// scp runs "scp -t <path>", receiving a file, or "scp -f <path>", sending one
+func (s *Server) scp(channel ssh.Channel, command string) error {
+	fields := strings.Fields(command)
+	if len(fields) != 3 || fields[0] != "scp" || (fields[1] != "-t" && fields[1] != "-f") {
+		return fmt.Errorf("unsupported command %q", command)
+	}
+	path := strings.Trim(fields[2], "'")
+	r := bufio.NewReader(channel)
+	if fields[1] == "-f" {
+		data, ok := s.File(path)
+		if !ok {
+			fmt.Fprintf(channel, "\x01scp: %s: No such file or directory\n", path)
+			return errors.New("no such file")
+		}
+		if err := scpAck(r); err != nil {
+			return err
+		}
+		fmt.Fprintf(channel, "C0644 %d %s\n", len(data), path[strings.LastIndex(path, "/")+1:])
+		if err := scpAck(r); err != nil {
+			return err
+		}
+		channel.Write(append(data, 0))
+		return scpAck(r)
+	}
+	channel.Write([]byte{0})
+	header, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	fields = strings.Fields(header)
+	if len(fields) != 3 || !strings.HasPrefix(header, "C") {
+		return fmt.Errorf("unexpected header %q", header)
+	}
+	size, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return err
+	}
+	channel.Write([]byte{0})
+	data := make([]byte, size+1)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	s.SetFile(path, data[:size])
+	_, err = channel.Write([]byte{0})
+	return err
+}
+
+// sftp serves the requests of the sftp subsystem used to copy files, until the client closes the session
+func (s *Server) sftp(channel ssh.Channel) {
+	type open struct {
+		path   string
+		data   []byte
+		writes bool
+	}
+	handles := map[string]*open{}
+	next := 0
+	for {
+		typ, id, payload, err := sftpReceive(channel)
+		if err != nil {
+			return
+		}
+		if typ == 1 {
+			// init, answered with version 3
+			sftpSend(channel, 2, ssh.Marshal(struct{ Version uint32 }{3}))
+			continue
+		}
+		reply := func(typ byte, response interface{}) {
+			packet := make([]byte, 4)
+			binary.BigEndian.PutUint32(packet, id)
+			sftpSend(channel, typ, append(packet, ssh.Marshal(response)...))
+		}
+		status := func(code uint32, message string) {
+			reply(101, struct {
+				Code              uint32
+				Message, Language string
+			}{code, message, ""})
+		}
+		var handle struct {
+			Handle string
+			Rest   []byte `ssh:"rest"`
+		}
+		switch typ {
+		case 3:
+			var req struct {
+				Path  string
+				Flags uint32
+				Rest  []byte `ssh:"rest"`
+			}
+			if ssh.Unmarshal(payload, &req) != nil {
+				status(4, "bad message")
+				continue
+			}
+			f := &open{path: req.Path, writes: req.Flags&0x02 != 0}
+			if !f.writes {
+				data, ok := s.File(req.Path)
+				if !ok {
+					status(2, "No such file")
+					continue
+				}
+				f.data = data
+			}
+			next++
+			h := strconv.Itoa(next)
+			handles[h] = f
+			reply(102, struct{ Handle string }{h})
+		case 4, 5, 6, 8:
+			if ssh.Unmarshal(payload, &handle) != nil || handles[handle.Handle] == nil {
+				status(4, "bad handle")
+				continue
+			}
+			f := handles[handle.Handle]
+			switch typ {
+			case 4:
+				if f.writes {
+					s.SetFile(f.path, f.data)
+				}
+				delete(handles, handle.Handle)
+				status(0, "")
+			case 5:
+				var req struct {
+					Offset uint64
+					Length uint32
+				}
+				if ssh.Unmarshal(handle.Rest, &req) != nil {
+					status(4, "bad message")
+				} else if req.Offset >= uint64(len(f.data)) {
+					status(1, "EOF")
+				} else {
+					end := req.Offset + uint64(req.Length)
+					if end > uint64(len(f.data)) {
+						end = uint64(len(f.data))
+					}
+					reply(103, struct{ Data []byte }{f.data[req.Offset:end]})
+				}
+			case 6:
+				var req struct {
+					Offset uint64
+					Data   []byte
+				}
+				if ssh.Unmarshal(handle.Rest, &req) != nil || req.Offset != uint64(len(f.data)) {
+					status(4, "writes must be in order")
+					continue
+				}
+				f.data = append(f.data, req.Data...)
+				status(0, "")
+			case 8:
+				reply(105, struct {
+					Flags uint32
+					Size  uint64
+				}{1, uint64(len(f.data))})
+			}
+		default:
+			status(8, "unsupported")
+		}
+	}
+}
+
+func sftpReceive(r io.Reader) (typ byte, id uint32, payload []byte, err error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, nil, err
+	}
+	packet := make([]byte, binary.BigEndian.Uint32(header))
+	if _, err := io.ReadFull(r, packet); err != nil {
+		return 0, 0, nil, err
+	}
+	if len(packet) < 5 {
+		return 0, 0, nil, errors.New("short packet")
+	}
+	return packet[0], binary.BigEndian.Uint32(packet[1:]), packet[5:], nil
+}
+
+func sftpSend(w io.Writer, typ byte, payload []byte) {
+	packet := make([]byte, 4)
+	binary.BigEndian.PutUint32(packet, uint32(1+len(payload)))
+	w.Write(append(append(packet, typ), payload...))
+}
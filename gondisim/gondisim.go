@@ -0,0 +1,176 @@
+// Package gondisim runs scripted fake network devices in process, so drivers and
+// interactions can be tested without hardware. Each fake emulates a platform's login
+// sequence, prompts, paging and canned command outputs over Telnet or SSH.
+package gondisim
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//go:embed fixtures
+var fixtures embed.FS
+
+// Platform describes how a fake device behaves.
+type Platform struct {
+	Name           string
+	Banner         string            // sent before the login prompt
+	LoginPrompt    string            // the telnet username prompt, ie "Username: "
+	PasswordPrompt string            // the telnet password prompt
+	Prompt         string            // the unprivileged prompt, ie "access1>"
+	EnablePrompt   string            // the privileged prompt, ie "access1#"
+	EnableCommand  string            // the command that enters privileged mode, empty if there is none
+	StartEnabled   bool              // log in directly to the privileged prompt
+	Pager          string            // the paging prompt, ie " --More-- "
+	PageLength     int               // lines per page while paging is on, 0 never pages
+	PagingOff      []string          // commands that turn paging off
+	InvalidInput   string            // the response to unknown commands
+	Outputs        map[string]string // canned outputs by command
+}
+
+var platforms = map[string]Platform{
+	"casa": {
+		Name:           "casa",
+		LoginPrompt:    "Login: ",
+		PasswordPrompt: "Password: ",
+		Prompt:         "cmts1> ",
+		EnablePrompt:   "cmts1# ",
+		EnableCommand:  "enable",
+		Pager:          "--More-- ",
+		PageLength:     24,
+		PagingOff:      []string{"page-off"},
+		InvalidInput:   "% Unknown command.",
+	},
+	"cisco_ios": {
+		Name:           "cisco_ios",
+		Banner:         "User Access Verification",
+		LoginPrompt:    "Username: ",
+		PasswordPrompt: "Password: ",
+		Prompt:         "access1>",
+		EnablePrompt:   "access1#",
+		EnableCommand:  "enable",
+		Pager:          " --More-- ",
+		PageLength:     24,
+		PagingOff:      []string{"terminal length 0"},
+		InvalidInput:   "% Invalid input detected at '^' marker.",
+	},
+	"cisco_xr": {
+		Name:           "cisco_xr",
+		Banner:         "User Access Verification",
+		LoginPrompt:    "Username: ",
+		PasswordPrompt: "Password: ",
+		Prompt:         "RP/0/RSP0/CPU0:core1#",
+		EnablePrompt:   "RP/0/RSP0/CPU0:core1#",
+		StartEnabled:   true,
+		Pager:          " --More-- ",
+		PageLength:     24,
+		PagingOff:      []string{"terminal length 0"},
+		InvalidInput:   "% Invalid input detected at '^' marker.",
+	},
+	"junos": {
+		Name:           "junos",
+		Banner:         "edge1 (ttyp0)",
+		LoginPrompt:    "login: ",
+		PasswordPrompt: "Password:",
+		Prompt:         "admin@edge1> ",
+		EnablePrompt:   "admin@edge1> ",
+		StartEnabled:   true,
+		Pager:          "---(more)---",
+		PageLength:     24,
+		PagingOff:      []string{"set cli screen-length 0"},
+		InvalidInput:   "unknown command.",
+	},
+	"foundry": {
+		Name:           "foundry",
+		LoginPrompt:    "Please Enter Login Name: ",
+		PasswordPrompt: "Please Enter Password: ",
+		Prompt:         "telnet@icx1>",
+		EnablePrompt:   "telnet@icx1#",
+		EnableCommand:  "enable",
+		Pager:          "--More--, next page: Space, next line: Return key, quit: Control-c",
+		PageLength:     24,
+		PagingOff:      []string{"skip-page-display"},
+		InvalidInput:   "Invalid input -> ",
+	},
+}
+
+// Platforms returns the names of the built in platforms, which match the transport driver names.
+func Platforms() []string {
+	names := make([]string, 0, len(platforms))
+	for name := range platforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns a copy of a built in platform, with its bundled fixtures loaded as outputs.
+func Lookup(name string) (Platform, error) {
+	p, ok := platforms[name]
+	if !ok {
+		return p, fmt.Errorf("Unknown simulator platform %q, the available platforms are: %s", name,
+			strings.Join(Platforms(), ", "))
+	}
+	p.Outputs = make(map[string]string)
+	dir := path.Join("fixtures", name)
+	entries, err := fs.ReadDir(fixtures, dir)
+	if err != nil {
+		// platforms without bundled fixtures
+		return p, nil
+	}
+	for _, e := range entries {
+		data, err := fs.ReadFile(fixtures, path.Join(dir, e.Name()))
+		if err != nil {
+			return p, err
+		}
+		p.Outputs[fixtureCommand(e.Name())] = string(data)
+	}
+	return p, nil
+}
+
+// Output returns the bundled fixture output of the command on the named built in platform, ie the
+// running config of "show running-config".
+func Output(platform, command string) (string, error) {
+	p, err := Lookup(platform)
+	if err != nil {
+		return "", err
+	}
+	output, ok := p.Outputs[command]
+	if !ok {
+		return "", fmt.Errorf("The simulator platform %s has no output for %q.", platform, command)
+	}
+	return output, nil
+}
+
+// LoadFixtures adds the fixture files in dir to the platform's outputs. The command is taken
+// from the file name, with underscores for spaces: "show_ip_route.txt" is "show ip route".
+func (p *Platform) LoadFixtures(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("Unable to read fixtures: %s", err)
+	}
+	if p.Outputs == nil {
+		p.Outputs = make(map[string]string)
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return fmt.Errorf("Unable to read fixture %s: %s", e.Name(), err)
+		}
+		p.Outputs[fixtureCommand(e.Name())] = string(data)
+	}
+	return nil
+}
+
+func fixtureCommand(file string) string {
+	return strings.Replace(strings.TrimSuffix(file, path.Ext(file)), "_", " ", -1)
+}
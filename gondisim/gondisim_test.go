@@ -0,0 +1,156 @@
+package gondisim
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readUntil reads from the connection until the text is seen, returning everything read.
+func readUntil(t *testing.T, r *bufio.Reader, text string) string {
+	var buf strings.Builder
+	deadline := time.Now().Add(time.Duration(5) * time.Second)
+	for !strings.HasSuffix(buf.String(), text) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %q, read %q", text, buf.String())
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			t.Fatalf("reading %q: %s, read %q", text, err, buf.String())
+		}
+		buf.WriteByte(b)
+	}
+	return buf.String()
+}
+
+func login(t *testing.T, s *Server) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", net.JoinHostPort(s.Host(), strconv.Itoa(s.Port())))
+	assert.NoError(t, err)
+	r := bufio.NewReader(conn)
+	readUntil(t, r, s.Platform.LoginPrompt)
+	// telnet negotiation from the client is ignored
+	conn.Write([]byte{iac, will, 31, iac, sb, 31, 0, 80, 0, 24, iac, se})
+	conn.Write([]byte("admin\r\n"))
+	readUntil(t, r, s.Platform.PasswordPrompt)
+	conn.Write([]byte("admin\r\x00"))
+	readUntil(t, r, s.Platform.Prompt)
+	return conn, r
+}
+
+func TestLookup(t *testing.T) {
+	for _, name := range Platforms() {
+		p, err := Lookup(name)
+		assert.NoError(t, err)
+		assert.Contains(t, p.Outputs, "show version", name)
+	}
+	_, err := Lookup("carrier_pigeon")
+	assert.Error(t, err)
+
+	output, err := Output("cisco_ios", "show version")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "System serial number            : FOC2045X1AB")
+	_, err = Output("cisco_ios", "show bogus")
+	assert.EqualError(t, err, `The simulator platform cisco_ios has no output for "show bogus".`)
+	_, err = Output("carrier_pigeon", "show version")
+	assert.Error(t, err)
+}
+
+func TestTelnet_LoginAndCommands(t *testing.T) {
+	s, err := NewTelnet("cisco_ios")
+	assert.NoError(t, err)
+	defer s.Close()
+
+	conn, r := login(t, s)
+	defer conn.Close()
+
+	conn.Write([]byte("terminal length 0\r"))
+	readUntil(t, r, "access1>")
+	conn.Write([]byte("show version\r"))
+	out := readUntil(t, r, "access1>")
+	assert.Contains(t, out, "System serial number            : FOC2045X1AB\r\n")
+
+	conn.Write([]byte("show bogus\r"))
+	out = readUntil(t, r, "access1>")
+	assert.Contains(t, out, "% Invalid input detected")
+
+	conn.Write([]byte("enable\r"))
+	readUntil(t, r, "Password: ")
+	conn.Write([]byte("enable\r"))
+	readUntil(t, r, "access1#")
+
+	assert.Equal(t, []string{"terminal length 0", "show version", "show bogus", "enable"}, s.Commands())
+}
+
+func TestTelnet_BadLogin(t *testing.T) {
+	s, err := NewTelnet("casa")
+	assert.NoError(t, err)
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(s.Host(), strconv.Itoa(s.Port())))
+	assert.NoError(t, err)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	readUntil(t, r, "Login: ")
+	conn.Write([]byte("admin\r"))
+	readUntil(t, r, "Password: ")
+	conn.Write([]byte("wrong\r"))
+	readUntil(t, r, "% Login invalid\r\n\r\nLogin: ")
+}
+
+func TestTelnet_Paging(t *testing.T) {
+	p, err := Lookup("casa")
+	assert.NoError(t, err)
+	p.PageLength = 2
+	p.Outputs["show lines"] = "one\ntwo\nthree\nfour\nfive\n"
+	s := New(p)
+	assert.NoError(t, s.StartTelnet())
+	defer s.Close()
+
+	conn, r := login(t, s)
+	defer conn.Close()
+
+	conn.Write([]byte("show lines\r"))
+	assert.Equal(t, "one\r\ntwo\r\n--More-- ", readUntil(t, r, "--More-- "))
+	conn.Write([]byte(" \r"))
+	assert.Equal(t, "\r\nthree\r\nfour\r\n--More-- ", readUntil(t, r, "--More-- "))
+	conn.Write([]byte(" "))
+	assert.Equal(t, "\r\nfive\r\ncmts1> ", readUntil(t, r, "cmts1> "))
+
+	// paging off prints everything at once
+	conn.Write([]byte("page-off\r"))
+	readUntil(t, r, "cmts1> ")
+	conn.Write([]byte("show lines\r"))
+	assert.Equal(t, "one\r\ntwo\r\nthree\r\nfour\r\nfive\r\ncmts1> ", readUntil(t, r, "cmts1> "))
+}
+
+func TestHandler(t *testing.T) {
+	s, err := NewTelnet("cisco_ios", WithOutputs(map[string]string{"show lines": "one\ntwo\n"}),
+		WithHandler(func(command string, term Terminal) bool {
+			if command != "copy running-config tftp:" {
+				return false
+			}
+			host, err := term.Ask("Address or name of remote host []? ")
+			if err != nil {
+				return true
+			}
+			term.Print("copied to " + host)
+			return true
+		}))
+	assert.NoError(t, err)
+	defer s.Close()
+
+	conn, r := login(t, s)
+	defer conn.Close()
+	conn.Write([]byte("copy running-config tftp:\r"))
+	readUntil(t, r, "[]? ")
+	conn.Write([]byte("10.0.0.9\r"))
+	assert.Contains(t, readUntil(t, r, "access1>"), "copied to 10.0.0.9")
+	// the other commands still have their outputs
+	conn.Write([]byte("show lines\r"))
+	assert.Contains(t, readUntil(t, r, "access1>"), "one\r\ntwo\r\n")
+}
@@ -0,0 +1,383 @@
+package gondisim
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Handler answers a command before the canned outputs are consulted. It can ask
+// follow up questions on the terminal, and returns false if it does not handle the command.
+type Handler func(command string, term Terminal) (handled bool)
+
+// Server is a fake device listening on an ephemeral port of the loopback interface.
+type Server struct {
+	Platform       Platform
+	Username       string
+	Password       string
+	EnablePassword string
+	Handler        Handler
+	SFTP           bool // serve the sftp subsystem over SSH, which some devices lack
+
+	listener net.Listener
+	hostKey  ssh.Signer
+	mut      sync.Mutex
+	commands []string
+	conns    map[io.Closer]bool
+	closed   bool
+	wg       sync.WaitGroup
+	files    map[string][]byte
+	loggedIn bool // a console session was left logged in
+	width    int  // the terminal size last requested over SSH
+	height   int
+}
+
+// New creates a fake device for the platform, with the credentials admin/admin and the enable password "enable".
+func New(platform Platform) *Server {
+	return &Server{
+		Platform:       platform,
+		Username:       "admin",
+		Password:       "admin",
+		EnablePassword: "enable",
+		SFTP:           true,
+		conns:          make(map[io.Closer]bool),
+	}
+}
+
+// Option changes a fake device started by NewTelnet or NewSSH, before it starts listening.
+type Option func(s *Server)
+
+// WithOutputs adds the canned outputs to those of the platform, replacing the outputs of the same commands.
+func WithOutputs(outputs map[string]string) Option {
+	return func(s *Server) {
+		for command, output := range outputs {
+			s.Platform.Outputs[command] = output
+		}
+	}
+}
+
+// WithHandler answers the commands with the handler before the canned outputs.
+func WithHandler(handler Handler) Option {
+	return func(s *Server) {
+		s.Handler = handler
+	}
+}
+
+// WithSFTP serves, or doesn't serve, the sftp subsystem over SSH.
+func WithSFTP(enabled bool) Option {
+	return func(s *Server) {
+		s.SFTP = enabled
+	}
+}
+
+// NewTelnet starts a fake Telnet device for the named built in platform.
+func NewTelnet(platform string, options ...Option) (*Server, error) {
+	s, err := create(platform, options)
+	if err != nil {
+		return nil, err
+	}
+	return s, s.StartTelnet()
+}
+
+// NewSSH starts a fake SSH device for the named built in platform.
+func NewSSH(platform string, options ...Option) (*Server, error) {
+	s, err := create(platform, options)
+	if err != nil {
+		return nil, err
+	}
+	return s, s.StartSSH()
+}
+
+// create creates a fake device for the named built in platform, with the options applied
+func create(platform string, options []Option) (*Server, error) {
+	p, err := Lookup(platform)
+	if err != nil {
+		return nil, err
+	}
+	s := New(p)
+	for _, option := range options {
+		option(s)
+	}
+	return s, nil
+}
+
+func (s *Server) listen() error {
+	if s.listener != nil {
+		return errors.New("The simulator is already listening.")
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	s.listener = l
+	return nil
+}
+
+// StartTelnet accepts Telnet sessions until the server is closed.
+func (s *Server) StartTelnet() error {
+	if err := s.listen(); err != nil {
+		return err
+	}
+	s.serve(func(conn net.Conn) {
+		defer conn.Close()
+		newSession(s, newTelnetReader(conn), conn).telnet()
+	})
+	return nil
+}
+
+// StartConsole accepts Telnet sessions that behave like a console server port: nothing is shown
+// until a return is received, and a session left logged in stays logged in for the next connection.
+func (s *Server) StartConsole() error {
+	if err := s.listen(); err != nil {
+		return err
+	}
+	s.serve(func(conn net.Conn) {
+		defer conn.Close()
+		newSession(s, newTelnetReader(conn), conn).console()
+	})
+	return nil
+}
+
+// StartSSH accepts SSH sessions until the server is closed. Clients must trust HostKey.
+func (s *Server) StartSSH() error {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	if s.hostKey, err = ssh.NewSignerFromKey(private); err != nil {
+		return err
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if c.User() == s.Username && string(password) == s.Password {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("password rejected for %s", c.User())
+		},
+	}
+	config.AddHostKey(s.hostKey)
+	if err := s.listen(); err != nil {
+		return err
+	}
+	s.serve(func(conn net.Conn) {
+		defer conn.Close()
+		s.serveSSH(conn, config)
+	})
+	return nil
+}
+
+func (s *Server) serve(handle func(conn net.Conn)) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := s.listener.Accept()
+			if err != nil {
+				return
+			}
+			if !s.track(conn) {
+				conn.Close()
+				return
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				defer s.untrack(conn)
+				handle(conn)
+			}()
+		}
+	}()
+}
+
+func (s *Server) track(c io.Closer) bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[c] = true
+	return true
+}
+
+func (s *Server) untrack(c io.Closer) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	delete(s.conns, c)
+}
+
+func (s *Server) serveSSH(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go s.serveChannel(channel, requests)
+	}
+}
+
+func (s *Server) serveChannel(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	for req := range requests {
+		switch req.Type {
+		case "pty-req":
+			var pty struct {
+				Term                         string
+				Columns, Rows, Width, Height uint32
+				Modes                        string
+			}
+			if ssh.Unmarshal(req.Payload, &pty) == nil {
+				s.resize(pty.Columns, pty.Rows)
+			}
+			req.Reply(true, nil)
+		case "window-change":
+			var size struct{ Columns, Rows, Width, Height uint32 }
+			if ssh.Unmarshal(req.Payload, &size) == nil {
+				s.resize(size.Columns, size.Rows)
+			}
+			req.Reply(true, nil)
+		case "env":
+			req.Reply(true, nil)
+		case "exec":
+			var exec struct{ Command string }
+			if ssh.Unmarshal(req.Payload, &exec) != nil || !strings.HasPrefix(exec.Command, "scp ") {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			go func() {
+				status := uint32(0)
+				if err := s.scp(channel, exec.Command); err != nil {
+					fmt.Fprintf(channel.Stderr(), "scp: %s\n", err)
+					status = 1
+				}
+				channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+				channel.Close()
+			}()
+		case "subsystem":
+			var subsystem struct{ Name string }
+			if !s.SFTP || ssh.Unmarshal(req.Payload, &subsystem) != nil || subsystem.Name != "sftp" {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			go func() {
+				s.sftp(channel)
+				channel.Close()
+			}()
+		case "shell":
+			req.Reply(true, nil)
+			go func() {
+				newSession(s, newByteReader(channel), channel).shell()
+				channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				channel.Close()
+			}()
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// Host returns the address the server is listening on.
+func (s *Server) Host() string {
+	return s.listener.Addr().(*net.TCPAddr).IP.String()
+}
+
+// Port returns the ephemeral port the server is listening on.
+func (s *Server) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// HostKey returns the public host key of an SSH server.
+func (s *Server) HostKey() ssh.PublicKey {
+	if s.hostKey == nil {
+		return nil
+	}
+	return s.hostKey.PublicKey()
+}
+
+// Fingerprint returns the SHA256 fingerprint of the SSH host key, for pinning.
+func (s *Server) Fingerprint() string {
+	if s.hostKey == nil {
+		return ""
+	}
+	return ssh.FingerprintSHA256(s.hostKey.PublicKey())
+}
+
+// Commands returns every command received after login, in order.
+func (s *Server) Commands() []string {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+func (s *Server) record(command string) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.commands = append(s.commands, command)
+}
+
+// WindowSize returns the terminal size, in characters, last requested by an SSH client.
+func (s *Server) WindowSize() (width, height int) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.width, s.height
+}
+
+func (s *Server) resize(width, height uint32) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.width, s.height = int(width), int(height)
+}
+
+func (s *Server) consoleLoggedIn() bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.loggedIn
+}
+
+func (s *Server) setConsoleLoggedIn(loggedIn bool) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.loggedIn = loggedIn
+}
+
+// Drop disconnects every open session, as if the device had rebooted, while still accepting new ones.
+func (s *Server) Drop() {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+// Close stops listening, drops every session and waits for them to finish.
+func (s *Server) Close() error {
+	s.mut.Lock()
+	s.closed = true
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mut.Unlock()
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	s.wg.Wait()
+	return err
+}
@@ -0,0 +1,303 @@
+package gondisim
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// telnet command bytes
+const (
+	se   = 240
+	sb   = 250
+	will = 251
+	dont = 254
+	iac  = 255
+)
+
+// Terminal is the session a Handler answers on.
+type Terminal interface {
+	// Ask writes the question and returns the line typed in response.
+	Ask(question string) (answer string, err error)
+	// Print writes output, paging it like any other command output.
+	Print(output string)
+}
+
+type reader interface {
+	ReadByte() (byte, error)
+	Buffered() int
+	Peek(n int) ([]byte, error)
+}
+
+// telnetReader strips telnet option negotiation from the input
+type telnetReader struct {
+	*bufio.Reader
+}
+
+func newTelnetReader(r io.Reader) *telnetReader {
+	return &telnetReader{bufio.NewReader(r)}
+}
+
+func newByteReader(r io.Reader) *bufio.Reader {
+	return bufio.NewReader(r)
+}
+
+func (t *telnetReader) ReadByte() (byte, error) {
+	for {
+		b, err := t.Reader.ReadByte()
+		if err != nil || b != iac {
+			return b, err
+		}
+		cmd, err := t.Reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case cmd == iac:
+			return iac, nil
+		case cmd >= will && cmd <= dont:
+			if _, err := t.Reader.ReadByte(); err != nil {
+				return 0, err
+			}
+		case cmd == sb:
+			// skip the subnegotiation up to IAC SE
+			var prev byte
+			for {
+				c, err := t.Reader.ReadByte()
+				if err != nil {
+					return 0, err
+				}
+				if prev == iac && c == se {
+					break
+				}
+				prev = c
+			}
+		}
+	}
+}
+
+// session emulates the CLI of the server's platform on a single connection
+type session struct {
+	s       *Server
+	in      reader
+	out     io.Writer
+	enabled bool
+	paging  bool
+	skipLF  bool // a \r ended the last line, so skip a following \n or NUL
+	err     error
+}
+
+func newSession(s *Server, in reader, out io.Writer) *session {
+	return &session{s: s, in: in, out: out, paging: s.Platform.PageLength > 0}
+}
+
+// telnet runs the login sequence, then the shell.
+func (ss *session) telnet() {
+	p := ss.s.Platform
+	if p.Banner != "" {
+		ss.writeLine("")
+		ss.writeLine(p.Banner)
+		ss.writeLine("")
+	}
+	if ss.login() {
+		ss.shell()
+	}
+}
+
+// console waits for a return like a console port does, then logs in unless an earlier
+// session on the port was left logged in.
+func (ss *session) console() {
+	if _, err := ss.readLine(); err != nil {
+		return
+	}
+	if !ss.s.consoleLoggedIn() {
+		if !ss.login() {
+			return
+		}
+		ss.s.setConsoleLoggedIn(true)
+	}
+	ss.shell()
+	if ss.err == nil {
+		// the client logged out, rather than only dropping the connection
+		ss.s.setConsoleLoggedIn(false)
+	}
+}
+
+// login asks for the credentials, allowing three attempts.
+func (ss *session) login() bool {
+	p := ss.s.Platform
+	for attempt := 0; attempt < 3; attempt++ {
+		ss.write(p.LoginPrompt)
+		user, err := ss.readLine()
+		if err != nil {
+			return false
+		}
+		ss.write(p.PasswordPrompt)
+		password, err := ss.readLine()
+		if err != nil {
+			return false
+		}
+		ss.writeLine("")
+		if user == ss.s.Username && password == ss.s.Password {
+			return true
+		}
+		ss.writeLine("% Login invalid")
+		ss.writeLine("")
+	}
+	return false
+}
+
+// shell answers commands until the client exits or disconnects.
+func (ss *session) shell() {
+	ss.enabled = ss.s.Platform.StartEnabled
+	for ss.err == nil {
+		ss.write(ss.prompt())
+		line, err := ss.readLine()
+		if err != nil {
+			return
+		}
+		command := strings.TrimSpace(line)
+		if command == "" {
+			continue
+		}
+		ss.s.record(command)
+		if !ss.run(command) {
+			return
+		}
+	}
+}
+
+func (ss *session) prompt() string {
+	if ss.enabled {
+		return ss.s.Platform.EnablePrompt
+	}
+	return ss.s.Platform.Prompt
+}
+
+// run answers a single command, returning false when the session should end.
+func (ss *session) run(command string) bool {
+	p := ss.s.Platform
+	switch {
+	case command == "exit" || command == "quit" || command == "logout":
+		return false
+	case contains(p.PagingOff, command):
+		ss.paging = false
+		return true
+	case p.EnableCommand != "" && command == p.EnableCommand:
+		password, err := ss.Ask(p.PasswordPrompt)
+		if err != nil {
+			return false
+		}
+		ss.writeLine("")
+		if password == ss.s.EnablePassword {
+			ss.enabled = true
+		} else {
+			ss.writeLine("% Access denied")
+		}
+		return true
+	case command == "disable":
+		ss.enabled = p.StartEnabled
+		return true
+	}
+	if ss.s.Handler != nil && ss.s.Handler(command, ss) {
+		return ss.err == nil
+	}
+	if out, ok := p.Outputs[command]; ok {
+		ss.Print(out)
+		return ss.err == nil
+	}
+	ss.writeLine(p.InvalidInput)
+	return true
+}
+
+// Ask writes the question and returns the line typed in response.
+func (ss *session) Ask(question string) (string, error) {
+	ss.write(question)
+	return ss.readLine()
+}
+
+// Print writes the output a page at a time while paging is on.
+func (ss *session) Print(output string) {
+	output = strings.TrimRight(strings.Replace(output, "\r\n", "\n", -1), "\n")
+	if output == "" {
+		return
+	}
+	length := ss.s.Platform.PageLength
+	for i, line := range strings.Split(output, "\n") {
+		if ss.paging && length > 0 && i > 0 && i%length == 0 {
+			ss.write(ss.s.Platform.Pager)
+			key, err := ss.in.ReadByte()
+			if err != nil {
+				ss.err = err
+				return
+			}
+			ss.drainNewlines()
+			ss.writeLine("")
+			if key == 'q' || key == 3 {
+				return
+			}
+		}
+		ss.writeLine(line)
+	}
+}
+
+// drainNewlines discards line endings typed along with a pager key.
+func (ss *session) drainNewlines() {
+	for ss.in.Buffered() > 0 {
+		b, err := ss.in.Peek(1)
+		if err != nil || (b[0] != '\r' && b[0] != '\n') {
+			return
+		}
+		ss.in.ReadByte()
+	}
+}
+
+func (ss *session) readLine() (string, error) {
+	var buf []byte
+	for {
+		b, err := ss.in.ReadByte()
+		if err != nil {
+			ss.err = err
+			return "", err
+		}
+		if ss.skipLF {
+			ss.skipLF = false
+			if b == '\n' || b == 0 {
+				continue
+			}
+		}
+		switch b {
+		case '\r':
+			ss.skipLF = true
+			return string(buf), nil
+		case '\n':
+			return string(buf), nil
+		case 0x7f, 0x08:
+			if len(buf) > 0 {
+				buf = buf[:len(buf)-1]
+			}
+		default:
+			buf = append(buf, b)
+		}
+	}
+}
+
+func (ss *session) write(s string) {
+	if ss.err != nil {
+		return
+	}
+	_, ss.err = io.WriteString(ss.out, s)
+}
+
+func (ss *session) writeLine(s string) {
+	ss.write(s + "\r\n")
+}
+
+func contains(list []string, s string) bool {
+	for _, next := range list {
+		if next == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,355 @@
+package gondisim
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Fetch and Send are the file transfer clients of the simulated devices, so a Handler can answer a copy
+// command the way a device would, ie "copy tftp://10.0.0.5/router1.cfg running-config". They support
+// tftp, ftp, scp and http URLs.
+
+// transferTimeout bounds each exchange with the server
+var transferTimeout = time.Duration(5) * time.Second
+
+// Fetch downloads the file at the URL.
+func Fetch(rawurl string) ([]byte, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "tftp":
+		return tftpGet(u)
+	case "ftp":
+		var data []byte
+		err := ftpTransfer(u, "RETR", func(conn net.Conn) (err error) {
+			data, err = ioutil.ReadAll(conn)
+			return err
+		})
+		return data, err
+	case "scp":
+		return scpGet(u)
+	case "http":
+		resp, err := http.Get(u.String())
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("The server answered %s.", resp.Status)
+		}
+		return ioutil.ReadAll(resp.Body)
+	}
+	return nil, fmt.Errorf("Unsupported transfer %q.", u.Scheme)
+}
+
+// Send uploads the data to the URL.
+func Send(rawurl string, data []byte) error {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "tftp":
+		return tftpPut(u, data)
+	case "ftp":
+		return ftpTransfer(u, "STOR", func(conn net.Conn) error {
+			_, err := conn.Write(data)
+			return err
+		})
+	case "scp":
+		return scpPut(u, data)
+	case "http":
+		req, err := http.NewRequest(http.MethodPut, u.String(), bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("The server answered %s.", resp.Status)
+		}
+		return nil
+	}
+	return fmt.Errorf("Unsupported transfer %q.", u.Scheme)
+}
+
+// hostPort returns the address of the URL's host, with the default port of the protocol if it has none
+func hostPort(u *url.URL, port string) string {
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+const (
+	tftpRRQ uint16 = iota + 1
+	tftpWRQ
+	tftpDATA
+	tftpACK
+	tftpERROR
+)
+
+const tftpBlockSize = 512
+
+func tftpRequest(op uint16, file string) []byte {
+	packet := make([]byte, 2, 2+len(file)+7)
+	binary.BigEndian.PutUint16(packet, op)
+	return append(append(append(packet, file...), 0), "octet\x00"...)
+}
+
+// tftpReceive waits for the next packet, returning its opcode, block number and data
+func tftpReceive(conn net.PacketConn) (op, block uint16, data []byte, from net.Addr, err error) {
+	buf := make([]byte, 4+tftpBlockSize)
+	conn.SetReadDeadline(time.Now().Add(transferTimeout))
+	n, from, err := conn.ReadFrom(buf)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+	if n < 4 {
+		return 0, 0, nil, nil, errors.New("Received a short TFTP packet.")
+	}
+	op, block, data = binary.BigEndian.Uint16(buf), binary.BigEndian.Uint16(buf[2:]), buf[4:n]
+	if op == tftpERROR {
+		return op, block, nil, from, fmt.Errorf("%s", bytes.TrimRight(data, "\x00"))
+	}
+	return op, block, data, from, nil
+}
+
+func tftpGet(u *url.URL) ([]byte, error) {
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	server, err := net.ResolveUDPAddr("udp", hostPort(u, "69"))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteTo(tftpRequest(tftpRRQ, strings.TrimPrefix(u.Path, "/")), server); err != nil {
+		return nil, err
+	}
+	var data []byte
+	for expected := uint16(1); ; expected++ {
+		op, block, payload, from, err := tftpReceive(conn)
+		if err != nil {
+			return nil, err
+		}
+		if op != tftpDATA || block != expected {
+			return nil, fmt.Errorf("Expected TFTP block %d.", expected)
+		}
+		data = append(data, payload...)
+		ack := make([]byte, 4)
+		binary.BigEndian.PutUint16(ack, tftpACK)
+		binary.BigEndian.PutUint16(ack[2:], block)
+		conn.WriteTo(ack, from)
+		if len(payload) < tftpBlockSize {
+			return data, nil
+		}
+	}
+}
+
+func tftpPut(u *url.URL, data []byte) error {
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var to net.Addr
+	if to, err = net.ResolveUDPAddr("udp", hostPort(u, "69")); err != nil {
+		return err
+	}
+	packet := tftpRequest(tftpWRQ, strings.TrimPrefix(u.Path, "/"))
+	for block := uint16(0); ; block++ {
+		if _, err := conn.WriteTo(packet, to); err != nil {
+			return err
+		}
+		op, acked, _, from, err := tftpReceive(conn)
+		if err != nil {
+			return err
+		}
+		if op != tftpACK || acked != block {
+			return fmt.Errorf("Expected the TFTP ack of block %d.", block)
+		}
+		if block > 0 && len(packet)-4 < tftpBlockSize {
+			return nil
+		}
+		to = from
+		start := int(block) * tftpBlockSize
+		end := start + tftpBlockSize
+		if end > len(data) {
+			end = len(data)
+		}
+		packet = make([]byte, 4, 4+end-start)
+		binary.BigEndian.PutUint16(packet, tftpDATA)
+		binary.BigEndian.PutUint16(packet[2:], block+1)
+		packet = append(packet, data[start:end]...)
+	}
+}
+
+// ftpTransfer logs in, and runs the RETR or STOR of the URL's file over a passive data connection
+func ftpTransfer(u *url.URL, command string, transfer func(conn net.Conn) error) error {
+	conn, err := textproto.Dial("tcp", hostPort(u, "21"))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	password, _ := u.User.Password()
+	steps := []struct {
+		command string
+		code    int
+	}{
+		{"", 220},
+		{"USER " + u.User.Username(), 331},
+		{"PASS " + password, 230},
+		{"TYPE I", 200},
+	}
+	for _, step := range steps {
+		if step.command != "" {
+			conn.PrintfLine("%s", step.command)
+		}
+		if _, _, err := conn.ReadResponse(step.code); err != nil {
+			return err
+		}
+	}
+	conn.PrintfLine("EPSV")
+	_, message, err := conn.ReadResponse(229)
+	if err != nil {
+		return err
+	}
+	port := message[strings.Index(message, "|||")+3 : strings.LastIndex(message, "|")]
+	data, err := net.Dial("tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return err
+	}
+	conn.PrintfLine("%s %s", command, strings.TrimPrefix(u.Path, "/"))
+	if _, _, err := conn.ReadResponse(150); err != nil {
+		data.Close()
+		return err
+	}
+	err = transfer(data)
+	data.Close()
+	if err != nil {
+		return err
+	}
+	_, _, err = conn.ReadResponse(226)
+	conn.PrintfLine("QUIT")
+	return err
+}
+
+func scpDial(u *url.URL) (*ssh.Session, *ssh.Client, error) {
+	password, _ := u.User.Password()
+	client, err := ssh.Dial("tcp", hostPort(u, "22"), &ssh.ClientConfig{
+		User: u.User.Username(),
+		Auth: []ssh.AuthMethod{ssh.Password(password)},
+		// a simulated device trusts any server
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         transferTimeout,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+	return session, client, nil
+}
+
+// scpAck waits for the server to accept the last step
+func scpAck(r *bufio.Reader) error {
+	b, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if b != 0 {
+		message, _ := r.ReadString('\n')
+		return fmt.Errorf("The server refused the transfer: %s", strings.TrimSpace(message))
+	}
+	return nil
+}
+
+func scpGet(u *url.URL) ([]byte, error) {
+	session, client, err := scpDial(u)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	defer session.Close()
+	in, _ := session.StdinPipe()
+	out, _ := session.StdoutPipe()
+	if err := session.Start("scp -f " + strings.TrimPrefix(u.Path, "/")); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(out)
+	in.Write([]byte{0})
+	header, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(header, "\x01") || strings.HasPrefix(header, "\x02") {
+		return nil, fmt.Errorf("The server refused the transfer: %s", strings.TrimSpace(header[1:]))
+	}
+	var mode, name string
+	var size int64
+	if _, err := fmt.Sscanf(header, "C%s %d %s\n", &mode, &size, &name); err != nil {
+		return nil, fmt.Errorf("Unexpected scp header %q.", header)
+	}
+	in.Write([]byte{0})
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	if err := scpAck(r); err != nil {
+		return nil, err
+	}
+	in.Write([]byte{0})
+	in.Close()
+	return data, session.Wait()
+}
+
+func scpPut(u *url.URL, data []byte) error {
+	session, client, err := scpDial(u)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	defer session.Close()
+	in, _ := session.StdinPipe()
+	out, _ := session.StdoutPipe()
+	file := strings.TrimPrefix(u.Path, "/")
+	if err := session.Start("scp -t " + file); err != nil {
+		return err
+	}
+	r := bufio.NewReader(out)
+	name := file[strings.LastIndex(file, "/")+1:]
+	for _, send := range [][]byte{[]byte(fmt.Sprintf("C0644 %d %s\n", len(data), name)), append(data, 0)} {
+		if err := scpAck(r); err != nil {
+			return err
+		}
+		in.Write(send)
+	}
+	if err := scpAck(r); err != nil {
+		return err
+	}
+	in.Close()
+	return session.Wait()
+}
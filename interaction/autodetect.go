@@ -0,0 +1,28 @@
+package interaction
+
+import (
+	"context"
+
+	"github.com/morganhein/gondi/schema"
+)
+
+// autodetect uses the generic interactions until connected, then the ones of the detected platform
+type autodetect struct {
+	schema.Interaction
+	device schema.Device
+}
+
+func (a *autodetect) Connect(method schema.ConnectionMethod, options schema.ConnectOptions, args ...string) error {
+	return a.ConnectContext(context.Background(), method, options, args...)
+}
+
+func (a *autodetect) ConnectContext(ctx context.Context, method schema.ConnectionMethod, options schema.ConnectOptions,
+	args ...string) error {
+	if err := a.device.ConnectContext(ctx, method, options, args...); err != nil {
+		return err
+	}
+	if p, ok := a.device.(interface{ Platform() schema.DeviceType }); ok {
+		a.Interaction = Wrap(p.Platform(), a.device)
+	}
+	return nil
+}
@@ -1,62 +1,116 @@
 package interaction
 
 import (
+	"context"
 	"errors"
-	"fmt"
-	"strconv"
-	"strings"
 
 	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/textfsm"
 )
 
 type casa struct {
 	base
 }
 
-func (c *casa) Storage() (result int64, err error) {
+func (c *casa) Storage() (result string, err error) {
 	resp, err := c.WriteCapture("")
 	if err != nil {
-		return 0, err
+		return "", err
 	}
 	if len(resp) == 0 {
-		return 0, errors.New("Unable to read file structure data.")
+		return "", errors.New("Unable to read file structure data.")
 	}
 	return c.parseStorage(resp)
 }
 
-func (c *casa) parseStorage(input []string) (result int64, err error) {
-	size, err := c.retrieveStorage(input)
+func (c *casa) parseStorage(input []string) (result string, err error) {
+	return c.retrieveStorage(input)
+}
+
+func (c *casa) retrieveStorage(input []string) (result string, err error) {
+	t, err := textfsm.Load("casa_storage")
 	if err != nil {
-		return 0, nil
+		return "", err
 	}
-	switch size[len(size)-1] {
-	case "G":
+	records, err := t.ParseLines(input)
+	if err != nil {
+		return "", err
 	}
-
-	return 0, nil
+	if len(records) == 0 {
+		return "", errors.New("Unable to find storage information in returned data.")
+	}
+	return records[len(records)-1].String("AVAILABLE"), nil
 }
 
-func (c *casa) retrieveStorage(input []string) (result string, err error) {
-	l := input[len(input)-1]
-	if !strings.Contains(string(l), "%") {
-		return "", errors.New("Unable to find storage information in returned data.")
+// SaveConfig copies the running config to the server with "copy running-config <url>".
+func (c *casa) SaveConfig(options schema.TransferOptions, file string) (int64, error) {
+	target, err := transferURL(options, file)
+	if err != nil {
+		return 0, err
 	}
-	f := strings.Fields(string(l))
-	if len(f) != 6 {
-		return "", errors.New(fmt.Sprintf("Unable to parse storage information: %s", f))
+	if err := c.Enable(); err != nil {
+		return 0, err
 	}
-	return f[3], nil
+	return ciscoCopy(c.Device, options, "copy running-config "+target, iosCopied)
 }
 
-//calculateBytes turns a size string into bytes, converting from Mb and Gb
-func (c *casa) calculateBytes(size string, magnitude int) (result int64, err error) {
-	i, err := strconv.ParseFloat(size, 64)
+// LoadConfig merges the config on the server into the running config with "copy <url> running-config".
+func (c *casa) LoadConfig(options schema.TransferOptions, file string) (int64, error) {
+	source, err := transferURL(options, file)
 	if err != nil {
 		return 0, err
 	}
+	if err := c.Enable(); err != nil {
+		return 0, err
+	}
+	n, err := ciscoCopy(c.Device, options, "copy "+source+" running-config", iosCopied)
+	c.forget()
+	return n, err
+}
+
+// Facts gathers the facts of the device from "show version" and "show ip interface brief".
+func (c *casa) Facts() (facts schema.Facts, err error) {
+	version, err := parse(c.Device, "show version")
+	if err != nil {
+		return facts, err
+	}
+	interfaces, err := parse(c.Device, "show ip interface brief")
+	if err != nil {
+		return facts, err
+	}
+	return schema.Facts{
+		Hostname:   first(version, "HOSTNAME"),
+		Vendor:     vendorCasa,
+		Model:      first(version, "PRODUCT"),
+		OSVersion:  first(version, "VERSION"),
+		Serial:     first(version, "SERIAL"),
+		Uptime:     uptime(first(version, "UPTIME")),
+		Interfaces: column(interfaces, "INTERFACE"),
+	}, nil
+}
+
+// ShowConfig shows the running config with "show running-config", which needs privileged mode.
+func (c *casa) ShowConfig(cached bool) (response string, err error) {
+	return c.ShowConfigContext(context.Background(), cached)
+}
 
+// ShowConfigContext is ShowConfig, but stops waiting for the device as soon as ctx is cancelled.
+func (c *casa) ShowConfigContext(ctx context.Context, cached bool) (response string, err error) {
+	if err := c.enable(ctx); err != nil {
+		return "", err
+	}
+	return c.showConfig(ctx, cached, "show running-config")
 }
 
-func (c *casa) LoadConfig(schema.TransferOptions, string) error {
-	return nil
+// ShowStartupConfig shows the startup config with "show startup-config", which needs privileged mode.
+func (c *casa) ShowStartupConfig() (response string, err error) {
+	return c.ShowStartupConfigContext(context.Background())
+}
+
+// ShowStartupConfigContext is ShowStartupConfig, but stops waiting for the device as soon as ctx is cancelled.
+func (c *casa) ShowStartupConfigContext(ctx context.Context) (response string, err error) {
+	if err := c.enable(ctx); err != nil {
+		return "", err
+	}
+	return c.show(ctx, "show startup-config")
 }
@@ -16,3 +16,9 @@ func TestCasa_Storage(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "3.0G", res)
 }
+
+func TestCasa_StorageMissing(t *testing.T) {
+	c := &casa{}
+	_, err := c.parseStorage([]string{"total 482944", "-rw-r--r-- 1 croot root 0 Jul  5  2016 tmp-IbLeB0"})
+	assert.EqualError(t, err, "Unable to find storage information in returned data.")
+}
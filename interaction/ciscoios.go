@@ -0,0 +1,87 @@
+package interaction
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/morganhein/gondi/schema"
+)
+
+type ciscoios struct {
+	base
+}
+
+// iosCopied is the end of a successful copy, ie "2134 bytes copied in 0.512 secs (4168 bytes/sec)"
+var iosCopied = regexp.MustCompile(`(\d+) bytes copied`)
+
+// SaveConfig copies the running config to the server with "copy running-config <url>".
+func (c *ciscoios) SaveConfig(options schema.TransferOptions, file string) (int64, error) {
+	target, err := transferURL(options, file)
+	if err != nil {
+		return 0, err
+	}
+	if err := c.Enable(); err != nil {
+		return 0, err
+	}
+	return ciscoCopy(c.Device, options, "copy running-config "+target, iosCopied)
+}
+
+// LoadConfig merges the config on the server into the running config with "copy <url> running-config".
+func (c *ciscoios) LoadConfig(options schema.TransferOptions, file string) (int64, error) {
+	source, err := transferURL(options, file)
+	if err != nil {
+		return 0, err
+	}
+	if err := c.Enable(); err != nil {
+		return 0, err
+	}
+	n, err := ciscoCopy(c.Device, options, "copy "+source+" running-config", iosCopied)
+	c.forget()
+	return n, err
+}
+
+func (c *ciscoios) Facts() (facts schema.Facts, err error) {
+	version, err := parse(c.Device, "show version")
+	if err != nil {
+		return facts, err
+	}
+	interfaces, err := parse(c.Device, "show ip interface brief")
+	if err != nil {
+		return facts, err
+	}
+	return schema.Facts{
+		Hostname:   first(version, "HOSTNAME"),
+		Vendor:     vendorCisco,
+		Model:      first(version, "HARDWARE"),
+		OSVersion:  first(version, "VERSION"),
+		Serial:     first(version, "SERIAL"),
+		Uptime:     uptime(first(version, "UPTIME")),
+		Interfaces: column(interfaces, "INTERFACE"),
+	}, nil
+}
+
+// ShowConfig shows the running config with "show running-config", which needs privileged mode.
+func (c *ciscoios) ShowConfig(cached bool) (response string, err error) {
+	return c.ShowConfigContext(context.Background(), cached)
+}
+
+// ShowConfigContext is ShowConfig, but stops waiting for the device as soon as ctx is cancelled.
+func (c *ciscoios) ShowConfigContext(ctx context.Context, cached bool) (response string, err error) {
+	if err := c.enable(ctx); err != nil {
+		return "", err
+	}
+	return c.showConfig(ctx, cached, "show running-config")
+}
+
+// ShowStartupConfig shows the startup config with "show startup-config", which needs privileged mode.
+func (c *ciscoios) ShowStartupConfig() (response string, err error) {
+	return c.ShowStartupConfigContext(context.Background())
+}
+
+// ShowStartupConfigContext is ShowStartupConfig, but stops waiting for the device as soon as ctx is cancelled.
+func (c *ciscoios) ShowStartupConfigContext(ctx context.Context) (response string, err error) {
+	if err := c.enable(ctx); err != nil {
+		return "", err
+	}
+	return c.show(ctx, "show startup-config")
+}
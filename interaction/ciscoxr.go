@@ -1,8 +1,10 @@
 package interaction
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/morganhein/gondi/schema"
@@ -31,14 +33,82 @@ func (c *ciscoxr) Storage() (result string, err error) {
 	return f[3], nil
 }
 
-func (c *ciscoxr) LoadConfig(schema.TransferOptions, string) error {
-	return nil
+var (
+	// xrSaved ends a save, which reports the bytes copied after building the config, ie "[OK]"
+	xrSaved = regexp.MustCompile(`(\d+) bytes copied|\[OK\]`)
+	// xrLoaded ends a load, which is committed once parsed, ie "2134 bytes parsed in 1 sec"
+	xrLoaded = regexp.MustCompile(`(\d+) bytes parsed|[Cc]ommitted`)
+)
+
+// LoadConfig merges the config on the server into the running config with "copy <url> running-config",
+// which commits it.
+func (c *ciscoxr) LoadConfig(options schema.TransferOptions, file string) (int64, error) {
+	source, err := transferURL(options, file)
+	if err != nil {
+		return 0, err
+	}
+	n, err := ciscoCopy(c.Device, options, "copy "+source+" running-config", xrLoaded)
+	c.forget()
+	return n, err
 }
 
-func (c *ciscoxr) SaveConfig(schema.TransferOptions, string) error {
-	return nil
+// SaveConfig copies the running config to the server with "copy running-config <url>".
+func (c *ciscoxr) SaveConfig(options schema.TransferOptions, file string) (int64, error) {
+	target, err := transferURL(options, file)
+	if err != nil {
+		return 0, err
+	}
+	return ciscoCopy(c.Device, options, "copy running-config "+target, xrSaved)
 }
 
+// ShowConfig shows the running config with "show running-config".
 func (c *ciscoxr) ShowConfig(cached bool) (response string, err error) {
-	return "", nil
+	return c.ShowConfigContext(context.Background(), cached)
+}
+
+// ShowConfigContext is ShowConfig, but stops waiting for the device as soon as ctx is cancelled.
+func (c *ciscoxr) ShowConfigContext(ctx context.Context, cached bool) (response string, err error) {
+	return c.showConfig(ctx, cached, "show running-config")
+}
+
+// ShowStartupConfig returns ErrNoStartupConfig, since IOS XR saves the running config as it is committed.
+func (c *ciscoxr) ShowStartupConfig() (response string, err error) {
+	return "", ErrNoStartupConfig
+}
+
+// ShowStartupConfigContext returns ErrNoStartupConfig, like ShowStartupConfig.
+func (c *ciscoxr) ShowStartupConfigContext(ctx context.Context) (response string, err error) {
+	return "", ErrNoStartupConfig
+}
+
+func (c *ciscoxr) Facts() (facts schema.Facts, err error) {
+	version, err := parse(c.Device, "show version")
+	if err != nil {
+		return facts, err
+	}
+	inventory, err := parse(c.Device, "show inventory")
+	if err != nil {
+		return facts, err
+	}
+	interfaces, err := parse(c.Device, "show ipv4 interface brief")
+	if err != nil {
+		return facts, err
+	}
+	facts = schema.Facts{
+		Hostname:   first(version, "HOSTNAME"),
+		Vendor:     vendorCisco,
+		Model:      first(version, "HARDWARE"),
+		OSVersion:  first(version, "VERSION"),
+		Uptime:     uptime(first(version, "UPTIME")),
+		Interfaces: column(interfaces, "INTERFACE"),
+	}
+	// the chassis is the rack, rather than the first module listed
+	for _, r := range inventory {
+		if strings.HasPrefix(r.String("NAME"), "Rack ") || strings.Contains(r.String("DESCR"), "Chassis") {
+			facts.Model = r.String("PID")
+			facts.Serial = r.String("SN")
+			break
+		}
+	}
+	return facts, nil
 }
@@ -1,21 +1,16 @@
 package interaction
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"regexp"
+	"strings"
+	"sync"
 
 	"github.com/morganhein/gondi/logger"
 	"github.com/morganhein/gondi/schema"
-)
-
-const (
-	Cisco schema.DeviceType = iota
-	CiscoXE
-	CiscoXR
-	Casa
-	Juniper
-	Adva
-	IronFoundry
+	"github.com/morganhein/gondi/transport"
 )
 
 var log schema.Logger
@@ -24,54 +19,122 @@ func init() {
 	log = logger.Log
 }
 
-func New(deviceType schema.DeviceType) schema.Interaction {
-	log := logger.Log
-	switch deviceType {
-	case CiscoXR:
-		log.Debug("Creating a new Cisco device.")
-		d := &ciscoxr{}
-		err := d.Initialize()
-		if err != nil {
-			return nil
-		}
-		return d
-	default:
-		log.Debug("Unknown device requested, making a base device.")
-		d := &base{}
-		err := d.Initialize()
-		if err != nil {
-			return nil
-		}
-		return d
+// ConfigReplacer is implemented by the platforms that can replace their whole configuration with a config
+// on a server, instead of merging it in like LoadConfig, ie Junos with "load override".
+type ConfigReplacer interface {
+	ReplaceConfig(options schema.TransferOptions, file string) (transferred int64, err error)
+}
+
+// Factory wraps a transport device with the interactions for its platform.
+type Factory func(device schema.Device) schema.Interaction
+
+var registry = struct {
+	mut     sync.RWMutex
+	drivers map[string]Factory
+}{drivers: map[string]Factory{
+	string(transport.Casa):    func(d schema.Device) schema.Interaction { return &casa{newBase(d)} },
+	string(transport.Cisco):   func(d schema.Device) schema.Interaction { return &ciscoios{newBase(d)} },
+	string(transport.CiscoXE): func(d schema.Device) schema.Interaction { return &ciscoios{newBase(d)} },
+	string(transport.CiscoXR): func(d schema.Device) schema.Interaction { return &ciscoxr{newBase(d)} },
+	string(transport.Foundry): func(d schema.Device) schema.Interaction { return &foundry{newBase(d)} },
+	string(transport.Juniper): func(d schema.Device) schema.Interaction { return &juniper{newBase(d)} },
+	string(transport.Autodetect): func(d schema.Device) schema.Interaction {
+		b := newBase(d)
+		return &autodetect{Interaction: &b, device: d}
+	},
+}}
+
+// RegisterDriver registers the interactions for a platform. The platform also needs a
+// transport driver, registered with transport.RegisterDriver.
+func RegisterDriver(name string, factory Factory) error {
+	if factory == nil {
+		return errors.New("Unable to register a nil interaction factory.")
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return errors.New("Unable to register an interaction driver without a name.")
+	}
+	registry.mut.Lock()
+	defer registry.mut.Unlock()
+	if _, ok := registry.drivers[name]; ok {
+		return fmt.Errorf("An interaction driver is already registered for the platform %q.", name)
+	}
+	registry.drivers[name] = factory
+	return nil
+}
+
+// New creates the transport device for the platform and wraps it with the platform's interactions.
+func New(platform schema.DeviceType) (schema.Interaction, error) {
+	d, err := transport.New(platform)
+	if err != nil {
+		return nil, err
 	}
+	return Wrap(platform, d), nil
 }
 
+// Wrap adds the platform's interactions to an existing device. Platforms without
+// their own interaction driver get the generic CLI interactions.
+func Wrap(platform schema.DeviceType, device schema.Device) schema.Interaction {
+	registry.mut.RLock()
+	factory, ok := registry.drivers[strings.ToLower(strings.TrimSpace(string(platform)))]
+	registry.mut.RUnlock()
+	if !ok {
+		log.Debugf("No interaction driver for %s, using the generic interactions.", platform)
+		b := newBase(device)
+		return &b
+	}
+	return factory(device)
+}
+
+// ErrNoStartupConfig is returned by the platforms that save their running config as it is committed.
+var ErrNoStartupConfig = errors.New("The platform has no startup config.")
+
 type base struct {
 	schema.Device
 	enablePw  string
 	loginUser string
 	loginPw   string
+	cache     *configCache
+}
+
+// configCache keeps the last running config shown, for ShowConfig(true)
+type configCache struct {
+	mut    sync.Mutex
+	config string
+}
+
+func newBase(device schema.Device) base {
+	return base{Device: device, cache: &configCache{}}
 }
 
 func (b base) Enable() (err error) {
+	return b.enable(context.Background())
+}
+
+// enable enters privileged mode, waiting on the device for as long as ctx allows
+func (b base) enable(ctx context.Context) (err error) {
 	//Check if already enabled.
-	if b.Enabled() {
+	if b.enabled(ctx) {
 		return nil
 	}
 	pw, _ := regexp.Compile("[pP]assword:? *?")
 	// try to enable, expebting the password
-	_, err = b.WriteExpect("enable", pw)
+	_, err = b.expect(ctx, "enable", pw)
 	if err != nil {
 		log.Warningf("Unable to enter privileged mode on device: %s", err)
 		return err
 	}
 	// send the password to login
-	_, err = b.WriteCapture(b.enablePw)
+	enablePw := b.enablePw
+	if enablePw == "" {
+		enablePw = b.Options().EnablePassword
+	}
+	_, err = b.capture(ctx, enablePw)
 	if err != nil {
 		log.Warningf("Unable to enter privileged mode on device. Entering the password failed: %s", err)
 		return err
 	}
-	enabled := b.Enabled()
+	enabled := b.enabled(ctx)
 	if !enabled {
 		return errors.New("Unable to enter privileged mode. Error unknown.")
 	}
@@ -79,17 +142,25 @@ func (b base) Enable() (err error) {
 }
 
 func (b base) Enabled() bool {
+	return b.enabled(context.Background())
+}
+
+func (b base) enabled(ctx context.Context) bool {
 	// send a blank enter to detect if the prompt ends in a # character
-	resp, err := b.WriteCapture("")
+	resp, err := b.capture(ctx, "")
 	if err != nil {
 		return false
 	}
+	// Prefer the enable prompt of the platform's driver definition
+	if p, ok := b.Device.(transport.Prompter); ok && len(resp) > 0 {
+		return p.EnablePrompt().MatchString(resp[len(resp)-1])
+	}
 	// Iterate over all the returned lines.
 	// We may receive more than a single line if there are alerts or
 	// other information sent at the time of testing the prompt.
 	// This can send false positives if any of the lines end in a #pound symbol.
 	for _, line := range resp {
-		if string(line[len(line)-1]) == "#" {
+		if len(line) > 0 && string(line[len(line)-1]) == "#" {
 			log.Debugf("Enabled response: %s, last character: %s", line, string(line[len(line)-1]))
 			return true
 		}
@@ -97,20 +168,95 @@ func (b base) Enabled() bool {
 	return false
 }
 
-func (b base) LoadConfig(schema.TransferOptions, string) error {
-	return nil
+// LoadConfig is not supported by the generic interactions, which don't know the platform's copy command.
+func (b base) LoadConfig(schema.TransferOptions, string) (int64, error) {
+	return 0, ErrNoTransfer
 }
 
-func (b base) SaveConfig(schema.TransferOptions, string) error {
-	return nil
+// SaveConfig is not supported by the generic interactions, which don't know the platform's copy command.
+func (b base) SaveConfig(schema.TransferOptions, string) (int64, error) {
+	return 0, ErrNoTransfer
 }
 
 func (b base) Storage() (result string, err error) {
 	panic("implement me")
 }
 
+// ShowConfig shows the running config with "show running-config", or returns the one last shown if cached.
 func (b base) ShowConfig(cached bool) (response string, err error) {
-	return "", nil
+	return b.ShowConfigContext(context.Background(), cached)
+}
+
+// ShowConfigContext is ShowConfig, but stops waiting for the device as soon as ctx is cancelled.
+func (b base) ShowConfigContext(ctx context.Context, cached bool) (response string, err error) {
+	return b.showConfig(ctx, cached, "show running-config")
+}
+
+// ShowStartupConfig shows the startup config with "show startup-config".
+func (b base) ShowStartupConfig() (response string, err error) {
+	return b.ShowStartupConfigContext(context.Background())
+}
+
+// ShowStartupConfigContext is ShowStartupConfig, but stops waiting for the device as soon as ctx is cancelled.
+func (b base) ShowStartupConfigContext(ctx context.Context) (response string, err error) {
+	return b.show(ctx, "show startup-config")
+}
+
+// showConfig shows the running config with the command, using the cache if asked to
+func (b base) showConfig(ctx context.Context, cached bool, command string) (string, error) {
+	if b.cache != nil {
+		b.cache.mut.Lock()
+		defer b.cache.mut.Unlock()
+		if cached && b.cache.config != "" {
+			return b.cache.config, nil
+		}
+	}
+	config, err := b.show(ctx, command)
+	if err == nil && b.cache != nil {
+		b.cache.config = config
+	}
+	return config, err
+}
+
+// forget drops the cached running config, once it has changed
+func (b base) forget() {
+	if b.cache != nil {
+		b.cache.mut.Lock()
+		b.cache.config = ""
+		b.cache.mut.Unlock()
+	}
+}
+
+// show returns the output of the command without the prompt that ends it, as a single string
+func (b base) show(ctx context.Context, command string) (string, error) {
+	result, err := b.capture(ctx, command)
+	if err != nil {
+		return "", err
+	}
+	if len(result) > 0 {
+		result = result[:len(result)-1]
+	}
+	if len(result) == 0 {
+		return "", fmt.Errorf("The device returned nothing for %q.", command)
+	}
+	return strings.Join(result, "\n") + "\n", nil
+}
+
+// expect is WriteExpect, but if ctx can be cancelled, waits on the device only for as long as it allows
+func (b base) expect(ctx context.Context, command string, expectation *regexp.Regexp) ([]string, error) {
+	if ctx.Done() == nil {
+		return b.WriteExpect(command, expectation)
+	}
+	return b.WriteExpectContext(ctx, command, expectation)
+}
+
+// capture is WriteCapture, but if ctx can be cancelled, waits on the device only for as long as it allows
+func (b base) capture(ctx context.Context, command string) ([]string, error) {
+	p, ok := b.Device.(transport.Prompter)
+	if ctx.Done() == nil || !ok {
+		return b.WriteCapture(command)
+	}
+	return b.WriteExpectContext(ctx, command, p.Prompt())
 }
 
 func (b base) Configure() (err error) {
@@ -137,6 +283,10 @@ func (b base) InterfaceDown(identifier string) (err error) {
 	panic("implement me")
 }
 
+func (b base) Facts() (facts schema.Facts, err error) {
+	return facts, ErrNoFacts
+}
+
 func (b base) Ping(ip string, tries, timeout int) (result string, err error) {
 	panic("implement me")
 }
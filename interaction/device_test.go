@@ -1 +1,38 @@
 package interaction
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	d, err := New(transport.Casa)
+	assert.NoError(t, err)
+	assert.IsType(t, &casa{}, d)
+
+	d, err = New(transport.CiscoXR)
+	assert.NoError(t, err)
+	assert.IsType(t, &ciscoxr{}, d)
+
+	// known transport platforms without their own interactions use the generic ones
+	d, err = New(transport.Generic)
+	assert.NoError(t, err)
+	assert.IsType(t, &base{}, d)
+
+	_, err = New("carrier_pigeon")
+	assert.True(t, errors.Is(err, transport.ErrUnknownPlatform))
+}
+
+func TestRegisterDriver(t *testing.T) {
+	assert.NoError(t, RegisterDriver("in_house", func(d schema.Device) schema.Interaction {
+		return &casa{base{Device: d}}
+	}))
+	dev, err := transport.New(transport.Generic)
+	assert.NoError(t, err)
+	assert.IsType(t, &casa{}, Wrap("in_house", dev))
+	assert.Error(t, RegisterDriver("casa", func(d schema.Device) schema.Interaction { return &base{Device: d} }))
+}
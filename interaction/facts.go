@@ -0,0 +1,116 @@
+package interaction
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/textfsm"
+	"github.com/morganhein/gondi/transport"
+)
+
+// The vendors reported in the facts
+const (
+	vendorCasa    = "Casa"
+	vendorCisco   = "Cisco"
+	vendorFoundry = "Foundry"
+	vendorJuniper = "Juniper"
+)
+
+// ErrNoFacts is returned by the platforms that don't gather facts.
+var ErrNoFacts = errors.New("Gathering facts is not supported on this platform.")
+
+// parse sends the command, and parses its output with the platform's embedded template
+func parse(device schema.Device, command string) ([]textfsm.Record, error) {
+	p, ok := device.(transport.Parser)
+	if !ok {
+		return nil, errors.New("The device is unable to parse output.")
+	}
+	return p.WriteParse(command, nil)
+}
+
+// first returns the named value of the first record, or its first item if it is a list
+func first(records []textfsm.Record, name string) string {
+	if len(records) == 0 {
+		return ""
+	}
+	if list := records[0].List(name); len(list) > 0 {
+		return list[0]
+	}
+	return records[0].String(name)
+}
+
+// column returns the named value of every record
+func column(records []textfsm.Record, name string) []string {
+	values := make([]string, 0, len(records))
+	for _, r := range records {
+		values = append(values, r.String(name))
+	}
+	return values
+}
+
+var (
+	uptimeWords   = regexp.MustCompile(`(\d+)\s*(year|week|day|hour|minute|second)s?(\(s\))?`)
+	uptimeCompact = regexp.MustCompile(`^(?:(\d+)w)?(?:(\d+)d)?\s*(?:(\d+):(\d+)(?::(\d+))?)?$`)
+)
+
+var uptimeUnits = map[string]time.Duration{
+	"year":   time.Duration(365*24) * time.Hour,
+	"week":   time.Duration(7*24) * time.Hour,
+	"day":    time.Duration(24) * time.Hour,
+	"hour":   time.Hour,
+	"minute": time.Minute,
+	"second": time.Second,
+}
+
+// parseUptime reads an uptime like "1 year, 5 weeks, 2 hours", "7 day(s) 2 hour(s)" or Junos' "12w0d 01:02"
+func parseUptime(text string) (time.Duration, error) {
+	text = strings.TrimSpace(text)
+	var uptime time.Duration
+	if matches := uptimeWords.FindAllStringSubmatch(text, -1); len(matches) > 0 {
+		for _, m := range matches {
+			n, _ := strconv.Atoi(m[1])
+			uptime += time.Duration(n) * uptimeUnits[m[2]]
+		}
+		return uptime, nil
+	}
+	m := uptimeCompact.FindStringSubmatch(text)
+	if text == "" || m == nil {
+		return 0, errors.New("Unable to parse the uptime: " + text)
+	}
+	for i, unit := range []time.Duration{time.Duration(7*24) * time.Hour, time.Duration(24) * time.Hour, time.Hour,
+		time.Minute, time.Second} {
+		n, _ := strconv.Atoi(m[i+1])
+		uptime += time.Duration(n) * unit
+	}
+	return uptime, nil
+}
+
+// uptime parses the uptime, logging rather than failing if it can't, since the other facts are still useful
+func uptime(text string) time.Duration {
+	if text == "" {
+		return 0
+	}
+	d, err := parseUptime(text)
+	if err != nil {
+		log.Warning(err)
+	}
+	return d
+}
+
+var promptHost = regexp.MustCompile(`^(?:\S+@)?([^\s>#]+)\s*[>#]\s*$`)
+
+// hostname returns the hostname shown in the prompt that ends the captured output, ie "telnet@icx1>"
+func hostname(result []string) string {
+	if len(result) == 0 {
+		return ""
+	}
+	m := promptHost.FindStringSubmatch(result[len(result)-1])
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
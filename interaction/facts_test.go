@@ -0,0 +1,147 @@
+package interaction
+
+import (
+	"testing"
+	"time"
+
+	"github.com/morganhein/gondi/gondisim"
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+// routerVersion is the "show version" of an IOS router, which has no "Model number" or "System serial number"
+const routerVersion = `Cisco IOS XE Software, Version 16.09.04
+Cisco IOS Software [Fuji], ISR Software (X86_64_LINUX_IOSD-UNIVERSALK9-M), Version 16.9.4, RELEASE SOFTWARE (fc2)
+Technical Support: http://www.cisco.com/techsupport
+Copyright (c) 1986-2019 by Cisco Systems, Inc.
+Compiled Thu 22-Aug-19 18:09 by mcpre
+
+ROM: IOS-XE ROMMON
+
+branch1 uptime is 1 year, 2 weeks, 3 days, 5 hours, 40 minutes
+Uptime for this control processor is 1 year, 2 weeks, 3 days, 5 hours, 42 minutes
+System returned to ROM by PowerOn
+System image file is "bootflash:isr4300-universalk9.16.09.04.SPA.bin"
+Last reload reason: PowerOn
+
+cisco ISR4331/K9 (1RU) processor with 1795999K/6147K bytes of memory.
+Processor board ID FDO21520TGH
+3 Gigabit Ethernet interfaces
+32768K bytes of non-volatile configuration memory.
+
+Configuration register is 0x2102`
+
+func TestFacts(t *testing.T) {
+	day := time.Duration(24) * time.Hour
+	tests := []struct {
+		platform schema.DeviceType
+		outputs  map[string]string // replacing the bundled fixtures
+		facts    schema.Facts
+	}{
+		{transport.Cisco, nil, schema.Facts{
+			Hostname: "access1", Vendor: "Cisco", Model: "WS-C2960X-48FPD-L", OSVersion: "15.2(7)E4",
+			Serial: "FOC2045X1AB", Uptime: 87*day + time.Duration(4)*time.Hour + time.Duration(22)*time.Minute,
+			Interfaces: []string{"Vlan1", "Vlan10", "GigabitEthernet1/0/1", "GigabitEthernet1/0/2", "GigabitEthernet1/0/3"},
+		}},
+		{transport.Cisco, map[string]string{"show version": routerVersion}, schema.Facts{
+			Hostname: "branch1", Vendor: "Cisco", Model: "ISR4331/K9", OSVersion: "16.9.4", Serial: "FDO21520TGH",
+			Uptime:     382*day + time.Duration(5)*time.Hour + time.Duration(40)*time.Minute,
+			Interfaces: []string{"Vlan1", "Vlan10", "GigabitEthernet1/0/1", "GigabitEthernet1/0/2", "GigabitEthernet1/0/3"},
+		}},
+		{transport.CiscoXR, nil, schema.Facts{
+			Hostname: "core1", Vendor: "Cisco", Model: "ASR-9006-AC-V2", OSVersion: "6.1.4", Serial: "FOX2105P2CD",
+			Uptime: 402*day + time.Duration(3)*time.Hour + time.Duration(11)*time.Minute,
+			Interfaces: []string{"Loopback0", "MgmtEth0/RSP0/CPU0/0", "TenGigE0/0/0/0", "TenGigE0/0/0/1",
+				"HundredGigE0/1/0/0"},
+		}},
+		{transport.Juniper, nil, schema.Facts{
+			Hostname: "edge1", Vendor: "Juniper", Model: "MX204", OSVersion: "19.4R3-S2.2", Serial: "DS123",
+			Uptime:     84*day + time.Duration(1)*time.Hour + time.Duration(2)*time.Minute,
+			Interfaces: []string{"et-0/0/0", "et-0/0/1", "xe-0/1/0", "lo0", "fxp0"},
+		}},
+		{transport.Foundry, nil, schema.Facts{
+			Hostname: "icx1", Vendor: "Foundry", Model: "ICX6450-24", OSVersion: "08.0.30hT311", Serial: "BZS3234K0AB",
+			Uptime:     7*day + time.Duration(2)*time.Hour + time.Duration(11)*time.Minute + time.Duration(5)*time.Second,
+			Interfaces: []string{"1/1/1", "1/1/2", "1/1/3", "1/2/1", "mgmt1"},
+		}},
+		{transport.Casa, nil, schema.Facts{
+			Hostname: "cmts1", Vendor: "Casa", Model: "C10G CMTS", OSVersion: "7.2.1", Serial: "CASA10G0012345",
+			Uptime:     47*day + time.Duration(3)*time.Hour + time.Duration(12)*time.Minute + time.Duration(9)*time.Second,
+			Interfaces: []string{"gige 0/0", "gige 0/1", "loopback 0", "ip-bundle 1", "docsis-mac 1"},
+		}},
+	}
+	for _, test := range tests {
+		sim, err := gondisim.NewTelnet(string(test.platform), gondisim.WithOutputs(test.outputs))
+		if !assert.NoError(t, err) {
+			continue
+		}
+		dev, err := New(test.platform)
+		assert.NoError(t, err)
+		err = dev.Connect(transport.Telnet, schema.ConnectOptions{
+			Host:     sim.Host(),
+			Port:     sim.Port(),
+			Username: sim.Username,
+			Password: sim.Password,
+		})
+		if assert.NoError(t, err, test.platform) {
+			facts, err := dev.Facts()
+			assert.NoError(t, err, test.platform)
+			assert.Equal(t, test.facts, facts, test.platform)
+			dev.Disconnect()
+		}
+		sim.Close()
+	}
+}
+
+func TestFacts_Autodetect(t *testing.T) {
+	sim, err := gondisim.NewTelnet(string(transport.Juniper))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer sim.Close()
+	dev, err := New(transport.Autodetect)
+	assert.NoError(t, err)
+	_, err = dev.Facts()
+	assert.Equal(t, ErrNoFacts, err)
+	err = dev.Connect(transport.Telnet, schema.ConnectOptions{
+		Host:     sim.Host(),
+		Port:     sim.Port(),
+		Username: sim.Username,
+		Password: sim.Password,
+	})
+	if assert.NoError(t, err) {
+		facts, err := dev.Facts()
+		assert.NoError(t, err)
+		assert.Equal(t, "Juniper", facts.Vendor)
+		assert.Equal(t, "MX204", facts.Model)
+		dev.Disconnect()
+	}
+}
+
+func TestFacts_Generic(t *testing.T) {
+	dev, err := New(transport.Generic)
+	assert.NoError(t, err)
+	_, err = dev.Facts()
+	assert.Equal(t, ErrNoFacts, err)
+}
+
+func TestParseUptime(t *testing.T) {
+	tests := []struct {
+		text   string
+		uptime time.Duration
+	}{
+		{"12 weeks, 3 days, 4 hours, 22 minutes", time.Duration(87*24+4)*time.Hour + time.Duration(22)*time.Minute},
+		{"1 year, 1 week", time.Duration(372*24) * time.Hour},
+		{"7 day(s) 2 hour(s) 11 minute(s) 5 second(s)", time.Duration(7*24+2)*time.Hour + time.Duration(665)*time.Second},
+		{"12w0d 01:02", time.Duration(84*24+1)*time.Hour + time.Duration(2)*time.Minute},
+		{"3d 00:00:30", time.Duration(72)*time.Hour + time.Duration(30)*time.Second},
+	}
+	for _, test := range tests {
+		uptime, err := parseUptime(test.text)
+		assert.NoError(t, err, test.text)
+		assert.Equal(t, test.uptime, uptime, test.text)
+	}
+	_, err := parseUptime("a while")
+	assert.EqualError(t, err, "Unable to parse the uptime: a while")
+}
@@ -0,0 +1,121 @@
+package interaction
+
+import (
+	"context"
+	"errors"
+	"regexp"
+
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/textfsm"
+	"github.com/morganhein/gondi/transport"
+)
+
+type foundry struct {
+	base
+}
+
+// foundryDone ends a copy, ie "TFTP to Flash Done."
+var foundryDone = regexp.MustCompile(`(?i)done\.? *$`)
+
+// SaveConfig copies the running config to the server with "copy running-config tftp <host> <file>".
+// Foundry only copies over TFTP, to the default port.
+func (f *foundry) SaveConfig(options schema.TransferOptions, file string) (int64, error) {
+	if err := foundryTransfer(options); err != nil {
+		return 0, err
+	}
+	if err := f.Enable(); err != nil {
+		return 0, err
+	}
+	return f.copy(options, "copy running-config tftp "+options.Host+" "+file)
+}
+
+// LoadConfig merges the config on the server into the running config with
+// "copy tftp running-config <host> <file>". Foundry only copies over TFTP, to the default port.
+func (f *foundry) LoadConfig(options schema.TransferOptions, file string) (int64, error) {
+	if err := foundryTransfer(options); err != nil {
+		return 0, err
+	}
+	if err := f.Enable(); err != nil {
+		return 0, err
+	}
+	n, err := f.copy(options, "copy tftp running-config "+options.Host+" "+file)
+	f.forget()
+	return n, err
+}
+
+// copy runs the copy, which doesn't report the bytes transferred
+func (f *foundry) copy(options schema.TransferOptions, command string) (int64, error) {
+	output, err := converse(f.Device, options, command)
+	if err != nil {
+		return 0, err
+	}
+	return copied(output, foundryDone)
+}
+
+func foundryTransfer(options schema.TransferOptions) error {
+	if options.Method != schema.TFTP {
+		return errors.New("Foundry devices only copy configs over TFTP.")
+	}
+	if options.Host == "" {
+		return errors.New("The transfer requires a host.")
+	}
+	if options.Port != 0 && options.Port != transferPorts[schema.TFTP] {
+		return errors.New("Foundry devices only copy configs to the default TFTP port.")
+	}
+	return nil
+}
+
+// Facts gathers the facts of the device. Foundry's show version lacks the hostname, so it is read from the prompt.
+func (f *foundry) Facts() (facts schema.Facts, err error) {
+	result, err := f.WriteCapture("show version")
+	if err != nil {
+		return facts, err
+	}
+	template, err := textfsm.Lookup(string(transport.Foundry), "show version")
+	if err != nil {
+		return facts, err
+	}
+	version, err := template.ParseLines(result[:len(result)-1])
+	if err != nil {
+		return facts, err
+	}
+	interfaces, err := parse(f.Device, "show interfaces brief")
+	if err != nil {
+		return facts, err
+	}
+	return schema.Facts{
+		Hostname:   hostname(result),
+		Vendor:     vendorFoundry,
+		Model:      first(version, "HARDWARE"),
+		OSVersion:  first(version, "VERSION"),
+		Serial:     first(version, "SERIAL"),
+		Uptime:     uptime(first(version, "UPTIME")),
+		Interfaces: column(interfaces, "PORT"),
+	}, nil
+}
+
+// ShowConfig shows the running config with "show running-config", which needs privileged mode.
+func (f *foundry) ShowConfig(cached bool) (response string, err error) {
+	return f.ShowConfigContext(context.Background(), cached)
+}
+
+// ShowConfigContext is ShowConfig, but stops waiting for the device as soon as ctx is cancelled.
+func (f *foundry) ShowConfigContext(ctx context.Context, cached bool) (response string, err error) {
+	if err := f.enable(ctx); err != nil {
+		return "", err
+	}
+	return f.showConfig(ctx, cached, "show running-config")
+}
+
+// ShowStartupConfig shows the startup config with "show configuration", which needs privileged mode.
+func (f *foundry) ShowStartupConfig() (response string, err error) {
+	return f.ShowStartupConfigContext(context.Background())
+}
+
+// ShowStartupConfigContext is ShowStartupConfig, but stops waiting for the device as soon as ctx is cancelled.
+func (f *foundry) ShowStartupConfigContext(ctx context.Context) (response string, err error) {
+	if err := f.enable(ctx); err != nil {
+		return "", err
+	}
+	return f.show(ctx, "show configuration")
+}
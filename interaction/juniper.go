@@ -0,0 +1,160 @@
+package interaction
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/morganhein/gondi/schema"
+)
+
+type juniper struct {
+	base
+}
+
+var (
+	// junosCopied ends a file copy, ie "router1.cfg 100% 2134 1.2MB/s 00:00", or "100% of 2134 B" over ftp
+	junosCopied = regexp.MustCompile(`100% +(?:of +)?(\d+)`)
+	junosSaved  = regexp.MustCompile(`^Wrote \d+ lines`)
+	junosLoaded = regexp.MustCompile(`load complete`)
+	junosCommit = regexp.MustCompile(`commit complete`)
+	// junosDiscard asks to throw away the changes when leaving configuration mode
+	junosDiscard = regexp.MustCompile(`\(yes\) *$`)
+)
+
+// staging is where the config is kept on the device while it is copied
+func staging(file string) string {
+	return "/var/tmp/gondi-" + path.Base(file)
+}
+
+// SaveConfig saves the config to a file on the device, and copies that to the server with "file copy".
+func (j *juniper) SaveConfig(options schema.TransferOptions, file string) (int64, error) {
+	target, err := transferURL(options, file)
+	if err != nil {
+		return 0, err
+	}
+	local := staging(file)
+	output, err := converse(j.Device, options, "show configuration | save "+local)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := copied(output, junosSaved); err != nil {
+		return 0, err
+	}
+	defer j.WriteCapture("file delete " + local)
+	return j.copy(options, local, target)
+}
+
+// LoadConfig copies the config on the server to the device with "file copy", and merges it into the
+// configuration using "load merge" and "commit and-quit", like the other platforms merge into the running config.
+func (j *juniper) LoadConfig(options schema.TransferOptions, file string) (int64, error) {
+	return j.load(options, file, "merge")
+}
+
+// ReplaceConfig copies the config on the server to the device like LoadConfig, but replaces the whole
+// configuration with it using "load override", removing every stanza the file doesn't have.
+func (j *juniper) ReplaceConfig(options schema.TransferOptions, file string) (int64, error) {
+	return j.load(options, file, "override")
+}
+
+// load copies the config to the device and loads it with "load <mode>", committing it if it loaded
+func (j *juniper) load(options schema.TransferOptions, file, mode string) (int64, error) {
+	source, err := transferURL(options, file)
+	if err != nil {
+		return 0, err
+	}
+	local := staging(file)
+	n, err := j.copy(options, source, local)
+	if err != nil {
+		return 0, err
+	}
+	defer j.WriteCapture("file delete " + local)
+	defer j.forget()
+	if _, err := j.WriteCapture("configure"); err != nil {
+		return 0, err
+	}
+	for _, step := range []struct {
+		command string
+		success *regexp.Regexp
+	}{
+		{"load " + mode + " " + local, junosLoaded},
+		{"commit and-quit", junosCommit},
+	} {
+		output, err := converse(j.Device, options, step.command)
+		if err == nil {
+			_, err = copied(output, step.success)
+		}
+		if err != nil {
+			// leave configuration mode without the changes
+			converse(j.Device, options, "exit configuration-mode", answer{question: junosDiscard, reply: "yes"})
+			return 0, fmt.Errorf("Unable to load the config: %s", err)
+		}
+	}
+	return n, nil
+}
+
+func (j *juniper) copy(options schema.TransferOptions, source, target string) (int64, error) {
+	output, err := converse(j.Device, options, "file copy "+source+" "+target,
+		answer{question: askPassword, reply: options.Password})
+	if err != nil {
+		return 0, err
+	}
+	return copied(output, junosCopied)
+}
+
+func (j *juniper) Facts() (facts schema.Facts, err error) {
+	version, err := parse(j.Device, "show version")
+	if err != nil {
+		return facts, err
+	}
+	chassis, err := parse(j.Device, "show chassis hardware")
+	if err != nil {
+		return facts, err
+	}
+	up, err := parse(j.Device, "show system uptime")
+	if err != nil {
+		return facts, err
+	}
+	terse, err := parse(j.Device, "show interfaces terse")
+	if err != nil {
+		return facts, err
+	}
+	facts = schema.Facts{
+		Hostname:   first(version, "HOSTNAME"),
+		Vendor:     vendorJuniper,
+		Model:      strings.ToUpper(first(version, "MODEL")),
+		OSVersion:  first(version, "VERSION"),
+		Serial:     first(chassis, "SERIAL"),
+		Uptime:     uptime(first(up, "UPTIME")),
+		Interfaces: []string{},
+	}
+	for _, name := range column(terse, "INTERFACE") {
+		// leave out the logical units, ie et-0/0/0.0
+		if !strings.Contains(name, ".") {
+			facts.Interfaces = append(facts.Interfaces, name)
+		}
+	}
+	return facts, nil
+}
+
+// ShowConfig shows the running config with "show configuration", in the brace style.
+func (j *juniper) ShowConfig(cached bool) (response string, err error) {
+	return j.ShowConfigContext(context.Background(), cached)
+}
+
+// ShowConfigContext is ShowConfig, but stops waiting for the device as soon as ctx is cancelled.
+func (j *juniper) ShowConfigContext(ctx context.Context, cached bool) (response string, err error) {
+	return j.showConfig(ctx, cached, "show configuration")
+}
+
+// ShowStartupConfig returns ErrNoStartupConfig, since Junos saves the running config as it is committed.
+func (j *juniper) ShowStartupConfig() (response string, err error) {
+	return "", ErrNoStartupConfig
+}
+
+// ShowStartupConfigContext returns ErrNoStartupConfig, like ShowStartupConfig.
+func (j *juniper) ShowStartupConfigContext(ctx context.Context) (response string, err error) {
+	return "", ErrNoStartupConfig
+}
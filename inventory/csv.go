@@ -0,0 +1,143 @@
+package inventory
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// columnAliases maps the other accepted names of the CSV columns to the field they fill
+var columnAliases = map[string]string{
+	"name":        "id",
+	"device_name": "id",
+	"type":        "platform",
+	"device_type": "platform",
+	"method":      "methods",
+	"group":       "groups",
+	"tag":         "tags",
+	"enable":      "enable_password",
+}
+
+// ReadCSV reads an inventory in CSV. The first row names the columns, which can be any of the
+// fields of a device in YAML, in any order. Columns named "var.<name>" set the device's variables,
+// and the lists, like methods, groups and tags, are separated by "|", ie "ssh|telnet".
+// Groups can't have defaults in CSV, so they only label their members. The name is only used in the errors.
+func ReadCSV(r io.Reader, name string) (*Inventory, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+	b := newBuilder(name)
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return b.result()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse the inventory %s: %s", name, err)
+	}
+	columns := make([]string, len(header))
+	for i, column := range header {
+		column = strings.ToLower(strings.Join(strings.Fields(column), "_"))
+		if alias, ok := columnAliases[column]; ok {
+			column = alias
+		}
+		if !contains(deviceFields, column) && !strings.HasPrefix(column, "var.") || column == "vars" {
+			b.fail(1, "Unknown column %q.", header[i])
+		}
+		columns[i] = column
+	}
+	if len(b.errs) > 0 {
+		return b.result()
+	}
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil {
+			if parseErr, ok := err.(*csv.ParseError); ok {
+				line = parseErr.Line
+				err = parseErr.Err
+			}
+			b.fail(line, "%s", err)
+			continue
+		}
+		if len(row) != len(columns) {
+			b.fail(line, "The row has %d columns, but the header has %d.", len(row), len(columns))
+			continue
+		}
+		if d, ok := b.readRow(columns, row, line); ok {
+			b.add(d)
+		}
+	}
+	return b.result()
+}
+
+func (b *builder) readRow(columns, row []string, line int) (d Device, ok bool) {
+	before := len(b.errs)
+	d = Device{Line: line, Vars: make(map[string]string)}
+	for i, value := range row {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		switch columns[i] {
+		case "id":
+			d.ID = value
+		case "host":
+			d.Host = value
+		case "console":
+			d.Console = value
+		case "platform":
+			d.Platform = platform(value)
+		case "port":
+			d.Port = b.parseInt(line, "port", value)
+		case "max_sessions":
+			d.MaxSessions = b.parseInt(line, "max_sessions", value)
+		case "methods":
+			d.Methods = b.parseMethods(line, split(value))
+		case "username":
+			d.Username = value
+		case "password":
+			d.Password = value
+		case "enable_password":
+			d.EnablePassword = value
+		case "host_key":
+			d.HostKey = b.parseHostKey(line, value)
+		case "host_key_fingerprint":
+			d.HostKeyFingerprint = value
+		case "known_hosts":
+			d.KnownHosts = value
+		case "groups":
+			d.Groups = split(value)
+		case "tags":
+			d.Tags = split(value)
+		default:
+			d.Vars[strings.TrimPrefix(columns[i], "var.")] = value
+		}
+	}
+	return d, len(b.errs) == before
+}
+
+func (b *builder) parseInt(line int, column, value string) int {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		b.fail(line, "The %s %q is not a number.", column, value)
+	}
+	return n
+}
+
+// split separates the items of a list column
+func split(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, "|") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,340 @@
+// Package inventory loads the devices to manage from YAML, JSON or CSV files.
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/morganhein/gondi"
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/transport"
+)
+
+// Device is a device of the inventory, with its groups' defaults already applied.
+type Device struct {
+	ID             string
+	Platform       schema.DeviceType
+	Host           string
+	Port           int
+	Console        string // the console server port, "host:port"
+	Methods        []schema.ConnectionMethod
+	Username       string
+	Password       string
+	EnablePassword string
+	// HostKey is how the SSH host key is checked: strict, pinned, tofu or insecure. Empty is
+	// strict, or pinned when the device has a HostKeyFingerprint
+	HostKey            string
+	HostKeyFingerprint string
+	KnownHosts         string // the known_hosts file of the strict and tofu modes, ~/.ssh/known_hosts if empty
+	MaxSessions        int
+	Groups             []string
+	Tags               []string
+	Vars               map[string]string // free form metadata, matched by selectors as labels
+	Line               int               // the line of the file the device was defined on
+}
+
+// Group holds the defaults of the devices that are members of it. A device's own values take
+// precedence, and a later group in the device's list takes precedence over an earlier one.
+type Group struct {
+	Name               string
+	Platform           schema.DeviceType
+	Port               int
+	Methods            []schema.ConnectionMethod
+	Username           string
+	Password           string
+	EnablePassword     string
+	HostKey            string
+	HostKeyFingerprint string
+	KnownHosts         string
+	Tags               []string
+	Vars               map[string]string // free form metadata, matched by selectors as labels
+}
+
+// Inventory is a loaded inventory file.
+type Inventory struct {
+	Devices []Device
+	Groups  map[string]Group
+}
+
+// Error is a problem with one entry of an inventory file.
+type Error struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Errors is every problem found in an inventory file.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Load reads the inventory file at path, choosing the format by its extension: .yaml, .yml, .json or .csv.
+// Invalid entries are left out and reported together as Errors, so the valid ones can still be used.
+func Load(path string) (*Inventory, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the inventory: %s", err)
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		return ReadYAML(f, path)
+	case ".csv":
+		return ReadCSV(f, path)
+	}
+	return nil, fmt.Errorf("Unknown inventory format %q, expected .yaml, .yml, .json or .csv.", filepath.Ext(path))
+}
+
+// Device returns the device with the id.
+func (inv *Inventory) Device(id string) (Device, bool) {
+	for _, d := range inv.Devices {
+		if d.ID == id {
+			return d, true
+		}
+	}
+	return Device{}, false
+}
+
+// Register adds every device to the manager.
+func (inv *Inventory) Register(m *gondi.Manager) error {
+	for _, d := range inv.Devices {
+		if err := m.Register(d.Config()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Config returns the manager configuration of the device.
+func (d Device) Config() gondi.DeviceConfig {
+	return gondi.DeviceConfig{
+		ID:          d.ID,
+		Platform:    d.Platform,
+		Methods:     d.Methods,
+		MaxSessions: d.MaxSessions,
+		Labels:      d.Vars,
+		Tags:        d.Tags,
+		Groups:      d.Groups,
+		Options: schema.ConnectOptions{
+			Host:           d.Host,
+			Port:           d.Port,
+			Console:        d.Console,
+			Username:       d.Username,
+			Password:       d.Password,
+			EnablePassword: d.EnablePassword,
+			HostKey:        d.hostKey(),
+		},
+	}
+}
+
+// hostKey returns the host key policy of the device, which has been validated
+func (d Device) hostKey() schema.HostKeyPolicy {
+	policy := schema.HostKeyPolicy{Fingerprint: d.HostKeyFingerprint, KnownHosts: d.KnownHosts}
+	switch {
+	case d.HostKey != "":
+		policy.Mode, _ = transport.ParseHostKeyMode(d.HostKey)
+	case d.HostKeyFingerprint != "":
+		policy.Mode = schema.HostKeyPinned
+	}
+	return policy
+}
+
+// resolve applies the group defaults to the device
+func (d *Device) resolve(groups map[string]Group) {
+	vars := make(map[string]string)
+	tags := []string{}
+	var merged Group
+	for _, name := range d.Groups {
+		g, ok := groups[name]
+		if !ok {
+			// groups without defaults only label their members
+			continue
+		}
+		if g.Platform != "" {
+			merged.Platform = g.Platform
+		}
+		if g.Port != 0 {
+			merged.Port = g.Port
+		}
+		if len(g.Methods) > 0 {
+			merged.Methods = g.Methods
+		}
+		merged.Username = first(g.Username, merged.Username)
+		merged.Password = first(g.Password, merged.Password)
+		merged.EnablePassword = first(g.EnablePassword, merged.EnablePassword)
+		merged.HostKey = first(g.HostKey, merged.HostKey)
+		merged.HostKeyFingerprint = first(g.HostKeyFingerprint, merged.HostKeyFingerprint)
+		merged.KnownHosts = first(g.KnownHosts, merged.KnownHosts)
+		tags = append(tags, g.Tags...)
+		for k, v := range g.Vars {
+			vars[k] = v
+		}
+	}
+	if d.Platform == "" {
+		d.Platform = merged.Platform
+	}
+	if d.Port == 0 {
+		d.Port = merged.Port
+	}
+	if len(d.Methods) == 0 {
+		d.Methods = merged.Methods
+	}
+	d.Username = first(d.Username, merged.Username)
+	d.Password = first(d.Password, merged.Password)
+	d.EnablePassword = first(d.EnablePassword, merged.EnablePassword)
+	d.HostKey = first(d.HostKey, merged.HostKey)
+	d.HostKeyFingerprint = first(d.HostKeyFingerprint, merged.HostKeyFingerprint)
+	d.KnownHosts = first(d.KnownHosts, merged.KnownHosts)
+	d.Tags = unique(append(tags, d.Tags...))
+	for k, v := range d.Vars {
+		vars[k] = v
+	}
+	d.Vars = vars
+}
+
+// validate checks a resolved device
+func (d Device) validate() error {
+	if d.ID == "" {
+		return errors.New("The device has no id.")
+	}
+	if d.Host == "" && d.Console == "" {
+		return fmt.Errorf("Device %s has no host.", d.ID)
+	}
+	if d.Platform == "" {
+		return fmt.Errorf("Device %s has no platform.", d.ID)
+	}
+	if !contains(transport.Drivers(), string(d.Platform)) {
+		return fmt.Errorf("Device %s has the unknown platform %q, expected one of %s.", d.ID, d.Platform,
+			strings.Join(transport.Drivers(), ", "))
+	}
+	if d.Port < 0 || d.Port > 65535 {
+		return fmt.Errorf("Device %s has the invalid port %d.", d.ID, d.Port)
+	}
+	if d.hostKey().Mode == schema.HostKeyPinned && d.HostKeyFingerprint == "" {
+		return fmt.Errorf("Device %s pins its host key, but has no host_key_fingerprint.", d.ID)
+	}
+	if d.MaxSessions < 0 {
+		return fmt.Errorf("Device %s has a negative max_sessions.", d.ID)
+	}
+	return nil
+}
+
+// builder collects the entries of a file, reporting each invalid one
+type builder struct {
+	file  string
+	inv   *Inventory
+	errs  Errors
+	lines map[string]int // the line each device id was first defined on
+}
+
+func newBuilder(file string) *builder {
+	return &builder{
+		file:  file,
+		inv:   &Inventory{Groups: make(map[string]Group)},
+		lines: make(map[string]int),
+	}
+}
+
+func (b *builder) fail(line int, format string, args ...interface{}) {
+	b.errs = append(b.errs, &Error{File: b.file, Line: line, Err: fmt.Errorf(format, args...)})
+}
+
+func (b *builder) add(d Device) {
+	d.resolve(b.inv.Groups)
+	if err := d.validate(); err != nil {
+		b.errs = append(b.errs, &Error{File: b.file, Line: d.Line, Err: err})
+		return
+	}
+	if line, ok := b.lines[d.ID]; ok {
+		b.fail(d.Line, "Device %s is already defined on line %d.", d.ID, line)
+		return
+	}
+	b.lines[d.ID] = d.Line
+	b.inv.Devices = append(b.inv.Devices, d)
+}
+
+// parseMethods parses the method names, reporting the invalid ones
+func (b *builder) parseMethods(line int, names []string) []schema.ConnectionMethod {
+	var methods []schema.ConnectionMethod
+	for _, name := range names {
+		method, err := transport.ParseMethod(name)
+		if err != nil {
+			b.fail(line, "%s", err)
+			continue
+		}
+		methods = append(methods, method)
+	}
+	return methods
+}
+
+func (b *builder) result() (*Inventory, error) {
+	if len(b.errs) > 0 {
+		sort.SliceStable(b.errs, func(i, j int) bool { return b.errs[i].Line < b.errs[j].Line })
+		return b.inv, b.errs
+	}
+	return b.inv, nil
+}
+
+// parseHostKey checks the host key mode of an entry, returning its name in lower case
+func (b *builder) parseHostKey(line int, name string) string {
+	if name == "" {
+		return ""
+	}
+	if _, err := transport.ParseHostKeyMode(name); err != nil {
+		b.fail(line, "%s", err)
+	}
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// platform normalizes the platform name of an entry, so that "Cisco_IOS " is the cisco_ios driver
+func platform(name string) schema.DeviceType {
+	return schema.DeviceType(strings.ToLower(strings.TrimSpace(name)))
+}
+
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func unique(values []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
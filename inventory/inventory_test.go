@@ -0,0 +1,219 @@
+package inventory
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/morganhein/gondi"
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad_Examples(t *testing.T) {
+	inv, err := Load("../devices.example.yaml")
+	assert.NoError(t, err)
+	if assert.Len(t, inv.Devices, 4) {
+		core2 := inv.Devices[1]
+		assert.Equal(t, "core2", core2.ID)
+		assert.Equal(t, transport.Cisco, core2.Platform)
+		assert.Equal(t, 2222, core2.Port)
+		assert.Equal(t, []schema.ConnectionMethod{transport.SSH, transport.Telnet}, core2.Methods)
+		assert.Equal(t, "admin", core2.Username)
+		assert.Equal(t, []string{"core"}, core2.Tags)
+		assert.Equal(t, map[string]string{"site": "dc1"}, core2.Vars)
+		assert.Equal(t, 25, core2.Line)
+		assert.Equal(t, schema.HostKeyPolicy{}, core2.Config().Options.HostKey)
+
+		edge1 := inv.Devices[3]
+		assert.Equal(t, []schema.ConnectionMethod{transport.Console}, edge1.Methods)
+		assert.Equal(t, "172.31.1.5:7001", edge1.Config().Options.Console)
+		assert.Equal(t, schema.HostKeyPolicy{Mode: schema.HostKeyTOFU, KnownHosts: "lab_known_hosts"},
+			edge1.Config().Options.HostKey)
+	}
+
+	inv, err = Load("../devices.example.csv")
+	assert.NoError(t, err)
+	if assert.Len(t, inv.Devices, 1) {
+		d := inv.Devices[0]
+		assert.Equal(t, "myDevice", d.ID)
+		assert.Equal(t, []string{"dc1", "lab"}, d.Tags)
+		assert.Equal(t, "enable_password", d.EnablePassword)
+		assert.Equal(t, 2, d.Line)
+	}
+
+	_, err = Load("devices.txt")
+	assert.Error(t, err)
+}
+
+func TestReadYAML_Groups(t *testing.T) {
+	inv, err := ReadYAML(strings.NewReader(`
+devices:
+  - id: sw1
+    host: 10.0.0.1
+    groups: [access, dc2]
+    username: local
+    vars: {rack: r1, site: override}
+groups:
+  access:
+    platform: " Cisco_IOS"
+    username: admin
+    password: secret
+    vars: {site: dc1, role: access}
+  dc2:
+    password: other
+    tags: dc2
+`), "test.yaml")
+	assert.NoError(t, err)
+	d, ok := inv.Device("sw1")
+	if assert.True(t, ok) {
+		assert.Equal(t, transport.Cisco, d.Platform)
+		assert.Equal(t, "local", d.Username)
+		assert.Equal(t, "other", d.Password)
+		assert.Equal(t, []string{"dc2"}, d.Tags)
+		assert.Equal(t, map[string]string{"rack": "r1", "site": "override", "role": "access"}, d.Vars)
+	}
+
+	g := gondi.NewG()
+	defer g.Shutdown()
+	assert.NoError(t, inv.Register(g))
+	ids, err := g.Select("group:access && site=override && tag:dc2 && platform=cisco_ios")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sw1"}, ids)
+}
+
+func TestReadYAML_HostKeys(t *testing.T) {
+	inv, err := ReadYAML(strings.NewReader(`
+groups:
+  lab:
+    host_key: TOFU
+    known_hosts: /etc/gondi/known_hosts
+devices:
+  - id: sw1
+    host: 10.0.0.1
+    platform: cisco_ios
+    groups: [lab]
+  - id: sw2
+    host: 10.0.0.2
+    platform: cisco_ios
+    host_key_fingerprint: SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8
+  - id: sw3
+    host: 10.0.0.3
+    platform: cisco_ios
+  - id: sw4
+    host: 10.0.0.4
+    platform: cisco_ios
+    host_key: pinned
+  - id: sw5
+    host: 10.0.0.5
+    platform: cisco_ios
+    host_key: trusting
+`), "test.yaml")
+	var errs Errors
+	if assert.True(t, errors.As(err, &errs)) && assert.Len(t, errs, 2) {
+		assert.Equal(t, "test.yaml:18: Device sw4 pins its host key, but has no host_key_fingerprint.", errs[0].Error())
+		assert.Equal(t, `test.yaml:22: Unknown host key mode "trusting", expected strict, pinned, tofu or insecure.`,
+			errs[1].Error())
+	}
+	if !assert.Len(t, inv.Devices, 3) {
+		return
+	}
+	assert.Equal(t, schema.HostKeyPolicy{Mode: schema.HostKeyTOFU, KnownHosts: "/etc/gondi/known_hosts"},
+		inv.Devices[0].Config().Options.HostKey)
+	// a fingerprint alone pins the key
+	assert.Equal(t, schema.HostKeyPolicy{Mode: schema.HostKeyPinned,
+		Fingerprint: "SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8"}, inv.Devices[1].Config().Options.HostKey)
+	assert.Equal(t, schema.HostKeyPolicy{}, inv.Devices[2].Config().Options.HostKey)
+
+	inv, err = ReadCSV(strings.NewReader("id,host,platform,host_key,known_hosts\nsw1,10.0.0.1,casa,insecure,\n"), "test.csv")
+	assert.NoError(t, err)
+	if assert.Len(t, inv.Devices, 1) {
+		assert.Equal(t, schema.HostKeyInsecure, inv.Devices[0].Config().Options.HostKey.Mode)
+	}
+}
+
+func TestReadYAML_JSON(t *testing.T) {
+	inv, err := ReadYAML(strings.NewReader(`{
+	"devices": [
+		{"id": "sw1", "host": "10.0.0.1", "platform": "JunOS", "port": 830, "methods": ["ssh"]}
+	]
+}`), "test.json")
+	assert.NoError(t, err)
+	if assert.Len(t, inv.Devices, 1) {
+		assert.Equal(t, transport.Juniper, inv.Devices[0].Platform)
+		assert.Equal(t, 830, inv.Devices[0].Port)
+		assert.Equal(t, 3, inv.Devices[0].Line)
+	}
+}
+
+func TestReadYAML_Errors(t *testing.T) {
+	inv, err := ReadYAML(strings.NewReader(`devices:
+  - id: ok
+    host: 10.0.0.1
+    platform: casa
+  - id: nohost
+    platform: casa
+  - id: badport
+    host: 10.0.0.2
+    platform: casa
+    port: twenty
+  - id: typo
+    hots: 10.0.0.3
+    platform: casa
+  - id: pigeon
+    host: 10.0.0.4
+    platform: carrier_pigeon
+  - id: badmethod
+    host: 10.0.0.5
+    platform: casa
+    methods: [ssh, smoke]
+  - id: ok
+    host: 10.0.0.6
+    platform: casa
+`), "test.yaml")
+	var errs Errors
+	if assert.True(t, errors.As(err, &errs)) && assert.Len(t, errs, 6) {
+		lines := []int{5, 10, 12, 14, 17, 21}
+		for i, line := range lines {
+			assert.Equal(t, line, errs[i].Line, errs[i].Error())
+		}
+		assert.Equal(t, "test.yaml:5: Device nohost has no host.", errs[0].Error())
+		assert.Contains(t, errs[2].Error(), `"hots"`)
+		assert.Contains(t, errs[5].Error(), "already defined on line 2")
+	}
+	// the valid devices are still loaded
+	if assert.Len(t, inv.Devices, 1) {
+		assert.Equal(t, "10.0.0.1", inv.Devices[0].Host)
+	}
+
+	_, err = ReadYAML(strings.NewReader("devices: [\n"), "test.yaml")
+	assert.Error(t, err)
+}
+
+func TestReadCSV(t *testing.T) {
+	inv, err := ReadCSV(strings.NewReader(`Device Name, Type, Host, Port, Method, Tags, var.Site
+sw1, CISCO_IOS, 10.0.0.1, 22, ssh|telnet, access|dc1, dc1
+
+sw2, cisco_ios, 10.0.0.2, abc, ssh, , dc1
+sw3, cisco_ios, 10.0.0.3, , pigeon, , dc1
+sw4, cisco_ios
+`), "test.csv")
+	assert.Len(t, inv.Devices, 1)
+	d := inv.Devices[0]
+	assert.Equal(t, "sw1", d.ID)
+	assert.Equal(t, transport.Cisco, d.Platform)
+	assert.Equal(t, []schema.ConnectionMethod{transport.SSH, transport.Telnet}, d.Methods)
+	assert.Equal(t, []string{"access", "dc1"}, d.Tags)
+	assert.Equal(t, map[string]string{"site": "dc1"}, d.Vars)
+
+	var errs Errors
+	if assert.True(t, errors.As(err, &errs)) && assert.Len(t, errs, 3) {
+		assert.Equal(t, `test.csv:4: The port "abc" is not a number.`, errs[0].Error())
+		assert.Equal(t, 5, errs[1].Line)
+		assert.Equal(t, 6, errs[2].Line)
+	}
+
+	_, err = ReadCSV(strings.NewReader("id,hostname\n"), "test.csv")
+	assert.EqualError(t, err, `test.csv:1: Unknown column "hostname".`)
+}
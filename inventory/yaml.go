@@ -0,0 +1,206 @@
+package inventory
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// entry holds the fields of a device or a group, as written in the file
+type entry struct {
+	ID                 string            `yaml:"id"`
+	Host               string            `yaml:"host"`
+	Console            string            `yaml:"console"`
+	Platform           string            `yaml:"platform"`
+	Port               int               `yaml:"port"`
+	Methods            list              `yaml:"methods"`
+	Username           string            `yaml:"username"`
+	Password           string            `yaml:"password"`
+	EnablePassword     string            `yaml:"enable_password"`
+	HostKey            string            `yaml:"host_key"`
+	HostKeyFingerprint string            `yaml:"host_key_fingerprint"`
+	KnownHosts         string            `yaml:"known_hosts"`
+	MaxSessions        int               `yaml:"max_sessions"`
+	Groups             list              `yaml:"groups"`
+	Tags               list              `yaml:"tags"`
+	Vars               map[string]string `yaml:"vars"`
+}
+
+var (
+	deviceFields = []string{"id", "host", "console", "platform", "port", "methods", "username", "password",
+		"enable_password", "host_key", "host_key_fingerprint", "known_hosts", "max_sessions", "groups", "tags", "vars"}
+	groupFields = []string{"platform", "port", "methods", "username", "password", "enable_password", "host_key",
+		"host_key_fingerprint", "known_hosts", "tags", "vars"}
+)
+
+// list is a sequence of strings, which can be written as a single string when it only has one
+type list []string
+
+func (l *list) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = list{node.Value}
+		return nil
+	}
+	var values []string
+	if err := node.Decode(&values); err != nil {
+		return err
+	}
+	*l = values
+	return nil
+}
+
+// ReadYAML reads an inventory in YAML, or JSON since it is a subset of YAML. The file has a list of
+// devices, and optionally a map of groups with the defaults of their members:
+//
+//	groups:
+//	  core:
+//	    platform: cisco_ios
+//	    username: admin
+//	devices:
+//	  - id: core1
+//	    host: 10.0.0.1
+//	    groups: [core]
+//
+// The name is only used in the errors.
+func ReadYAML(r io.Reader, name string) (*Inventory, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the inventory: %s", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("Unable to parse the inventory %s: %s", name, err)
+	}
+	b := newBuilder(name)
+	if len(doc.Content) == 0 {
+		// an empty file
+		return b.result()
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		b.fail(root.Line, "The inventory must be a map with groups and devices.")
+		return b.result()
+	}
+	var groups, devices *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		switch key.Value {
+		case "groups":
+			groups = value
+		case "devices":
+			devices = value
+		default:
+			b.fail(key.Line, "Unknown section %q, expected groups or devices.", key.Value)
+		}
+	}
+	// groups first, so devices can use groups defined after them
+	if groups != nil {
+		b.readGroups(groups)
+	}
+	if devices != nil {
+		b.readDevices(devices)
+	}
+	return b.result()
+}
+
+func (b *builder) readGroups(node *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		b.fail(node.Line, "The groups must be a map of group names to their defaults.")
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name := node.Content[i].Value
+		e, ok := b.readEntry(node.Content[i+1], groupFields, "Group "+name)
+		if !ok {
+			continue
+		}
+		before := len(b.errs)
+		g := Group{
+			Name:               name,
+			Platform:           platform(e.Platform),
+			Port:               e.Port,
+			Methods:            b.parseMethods(node.Content[i+1].Line, e.Methods),
+			Username:           e.Username,
+			Password:           e.Password,
+			EnablePassword:     e.EnablePassword,
+			HostKey:            b.parseHostKey(node.Content[i+1].Line, e.HostKey),
+			HostKeyFingerprint: e.HostKeyFingerprint,
+			KnownHosts:         e.KnownHosts,
+			Tags:               e.Tags,
+			Vars:               e.Vars,
+		}
+		if len(b.errs) == before {
+			b.inv.Groups[name] = g
+		}
+	}
+}
+
+func (b *builder) readDevices(node *yaml.Node) {
+	if node.Kind != yaml.SequenceNode {
+		b.fail(node.Line, "The devices must be a list.")
+		return
+	}
+	for _, item := range node.Content {
+		e, ok := b.readEntry(item, deviceFields, "The device")
+		if !ok {
+			continue
+		}
+		before := len(b.errs)
+		d := Device{
+			ID:                 e.ID,
+			Platform:           platform(e.Platform),
+			Host:               e.Host,
+			Port:               e.Port,
+			Console:            e.Console,
+			Methods:            b.parseMethods(item.Line, e.Methods),
+			Username:           e.Username,
+			Password:           e.Password,
+			EnablePassword:     e.EnablePassword,
+			HostKey:            b.parseHostKey(item.Line, e.HostKey),
+			HostKeyFingerprint: e.HostKeyFingerprint,
+			KnownHosts:         e.KnownHosts,
+			MaxSessions:        e.MaxSessions,
+			Groups:             e.Groups,
+			Tags:               e.Tags,
+			Vars:               e.Vars,
+			Line:               item.Line,
+		}
+		if len(b.errs) == before {
+			b.add(d)
+		}
+	}
+}
+
+// readEntry decodes a device or group, reporting unknown fields and values of the wrong type
+func (b *builder) readEntry(node *yaml.Node, fields []string, what string) (e entry, ok bool) {
+	if node.Kind != yaml.MappingNode {
+		b.fail(node.Line, "%s must be a map of fields.", what)
+		return e, false
+	}
+	ok = true
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		if !contains(fields, key.Value) {
+			b.fail(key.Line, "%s has the unknown field %q.", what, key.Value)
+			ok = false
+		}
+	}
+	if err := node.Decode(&e); err != nil {
+		if typeErr, isType := err.(*yaml.TypeError); isType {
+			for _, msg := range typeErr.Errors {
+				line, text := node.Line, msg
+				fmt.Sscanf(msg, "line %d:", &line)
+				if i := strings.Index(msg, ": "); i >= 0 {
+					text = msg[i+2:]
+				}
+				b.fail(line, "%s has an invalid value: %s", what, text)
+			}
+		} else {
+			b.fail(node.Line, "%s is invalid: %s", what, err)
+		}
+		return e, false
+	}
+	return e, ok
+}
@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/morganhein/gondi/schema"
@@ -21,3 +22,13 @@ func init() {
 
 	logging.SetBackend(backendFormatter)
 }
+
+// SetLevel shows the messages of the level and above only: critical, error, warning, notice, info or debug.
+func SetLevel(level string) error {
+	l, err := logging.LogLevel(level)
+	if err != nil {
+		return fmt.Errorf("Unknown log level %q, expected critical, error, warning, notice, info or debug.", level)
+	}
+	logging.SetLevel(l, "")
+	return nil
+}
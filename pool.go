@@ -0,0 +1,398 @@
+package gondi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/selector"
+	"github.com/morganhein/gondi/transport"
+)
+
+// State is the lifecycle state of a device, or of one of its sessions.
+type State int
+
+const (
+	// Closed devices have no open sessions. They connect on first use.
+	Closed State = iota
+	// Connecting devices are logging in.
+	Connecting
+	// Ready devices have a session waiting for commands.
+	Ready
+	// Busy devices are running commands on every session they are allowed.
+	Busy
+	// Failed devices could not connect. They try again on next use.
+	Failed
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Connecting:
+		return "connecting"
+	case Ready:
+		return "ready"
+	case Busy:
+		return "busy"
+	case Failed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// DeviceConfig describes how to reach a device managed by the pool.
+type DeviceConfig struct {
+	ID       string
+	Platform schema.DeviceType
+	// Methods are tried in order until one connects, the driver's supported methods if empty
+	Methods []schema.ConnectionMethod
+	// Ports overrides Options.Port for some of the methods, ie {transport.SSH: 2222}
+	Ports       map[schema.ConnectionMethod]int
+	Options     schema.ConnectOptions
+	MaxSessions int           // the number of concurrent sessions to the device, 1 if zero
+	IdleTimeout time.Duration // close sessions unused for this long, the manager's default if zero
+	// Labels, Tags and Groups are metadata for picking devices with Manager.Select
+	Labels map[string]string // ie {"site": "dc1"}
+	Tags   []string
+	Groups []string
+}
+
+// target describes the device to the selector. The labels can't override the built in fields.
+func (c DeviceConfig) target() selector.Target {
+	fields := make(map[string]string, len(c.Labels)+2)
+	for k, v := range c.Labels {
+		fields[k] = v
+	}
+	fields["platform"] = string(c.Platform)
+	fields["host"] = c.Options.Host
+	return selector.Target{ID: c.ID, Fields: fields, Tags: c.Tags, Groups: c.Groups}
+}
+
+// Attempt is a failed try at connecting with one of the device's methods.
+type Attempt struct {
+	Method schema.ConnectionMethod
+	Err    error
+}
+
+// ConnectError is returned when none of a device's connection methods succeeded.
+type ConnectError struct {
+	ID       string
+	Attempts []Attempt
+}
+
+func (e *ConnectError) Error() string {
+	reasons := make([]string, len(e.Attempts))
+	for i, a := range e.Attempts {
+		reasons[i] = fmt.Sprintf("%s: %s", transport.MethodName(a.Method), a.Err)
+	}
+	return fmt.Sprintf("Unable to connect to %s (%s)", e.ID, strings.Join(reasons, "; "))
+}
+
+// Unwrap returns the error of every attempt, for errors.Is and errors.As.
+func (e *ConnectError) Unwrap() []error {
+	errs := make([]error, len(e.Attempts))
+	for i, a := range e.Attempts {
+		errs[i] = a.Err
+	}
+	return errs
+}
+
+// session is a single connection to a device
+type session struct {
+	device   schema.Device
+	state    State
+	lastUsed time.Time
+}
+
+// pool holds the sessions of a single device
+type pool struct {
+	config   DeviceConfig
+	template schema.Device             // an unconnected driver, for the platform's prompts and methods
+	timeout  time.Duration             // the time allowed for each connection attempt
+	creds    schema.CredentialProvider // the manager's provider, for devices without their own
+	mut      sync.Mutex
+	sessions []*session
+	changed  chan struct{} // closed and replaced whenever a session is released or removed
+	err      error         // the last connection failure, cleared by the next success
+	closed   bool          // the device was unregistered
+}
+
+func newPool(config DeviceConfig, options ManagerOptions) (*pool, error) {
+	template, err := transport.New(config.Platform)
+	if err != nil {
+		return nil, err
+	}
+	if config.MaxSessions <= 0 {
+		config.MaxSessions = 1
+	}
+	return &pool{
+		config:   config,
+		template: template,
+		timeout:  options.ConnectTimeout,
+		creds:    options.Credentials,
+		changed:  make(chan struct{}),
+	}, nil
+}
+
+// notify wakes the callers waiting for a session. The pool must be locked.
+func (p *pool) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// state summarizes the states of the sessions
+func (p *pool) state() State {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	if len(p.sessions) == 0 {
+		if p.err != nil {
+			return Failed
+		}
+		return Closed
+	}
+	state := Busy
+	for _, s := range p.sessions {
+		switch s.state {
+		case Connecting:
+			return Connecting
+		case Ready:
+			state = Ready
+		}
+	}
+	return state
+}
+
+// acquire returns a session that is reserved for the caller until released. A ready session is
+// used if there is one, otherwise a new one is connected, up to MaxSessions. Once the limit is
+// reached, the caller waits for a session to be released.
+func (p *pool) acquire(ctx context.Context) (*session, error) {
+	for {
+		p.mut.Lock()
+		if p.closed {
+			p.mut.Unlock()
+			return nil, errors.New("The device was removed from the manager.")
+		}
+		for _, s := range p.sessions {
+			if s.state == Ready {
+				s.state = Busy
+				p.mut.Unlock()
+				return s, nil
+			}
+		}
+		if len(p.sessions) < p.config.MaxSessions {
+			s := &session{state: Connecting}
+			p.sessions = append(p.sessions, s)
+			p.mut.Unlock()
+			if err := p.connect(ctx, s); err != nil {
+				return nil, err
+			}
+			return s, nil
+		}
+		changed := p.changed
+		p.mut.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// connect logs the new session in, leaving it busy for the caller
+func (p *pool) connect(ctx context.Context, s *session) error {
+	p.mut.Lock()
+	config := p.config
+	p.mut.Unlock()
+	device, method, err := p.dial(ctx, config)
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	if err != nil {
+		p.err = err
+		p.remove(s)
+		return err
+	}
+	if s.state == Closed {
+		// the device was disconnected in the meantime
+		go device.Disconnect()
+		return transport.ErrNotConnected
+	}
+	// record the method that worked, reported by Options
+	p.config.Options.Method = method
+	p.err = nil
+	s.device = device
+	s.state = Busy
+	return nil
+}
+
+// dial tries each of the device's methods in turn, returning the device connected with the first that succeeds.
+func (p *pool) dial(ctx context.Context, config DeviceConfig) (schema.Device, schema.ConnectionMethod, error) {
+	supported := p.template.SupportedMethods()
+	methods := config.Methods
+	if len(methods) == 0 {
+		methods = supported
+	}
+	connectErr := &ConnectError{ID: config.ID}
+	for _, method := range methods {
+		if !contains(supported, method) {
+			connectErr.Attempts = append(connectErr.Attempts, Attempt{method,
+				fmt.Errorf("The %s driver does not support it.", config.Platform)})
+			continue
+		}
+		options := config.Options
+		if port, ok := config.Ports[method]; ok {
+			options.Port = port
+		}
+		if options.Credentials == nil {
+			options.Credentials = p.creds
+		}
+		if options.CredentialKey == "" {
+			options.CredentialKey = config.ID
+		}
+		device, err := p.attempt(ctx, config.Platform, method, options)
+		if err == nil {
+			return device, method, nil
+		}
+		connectErr.Attempts = append(connectErr.Attempts, Attempt{method, err})
+		if ctx.Err() != nil {
+			// the caller gave up, so don't try the remaining methods
+			break
+		}
+	}
+	return nil, 0, connectErr
+}
+
+// attempt connects a new driver with a single method
+func (p *pool) attempt(ctx context.Context, platform schema.DeviceType, method schema.ConnectionMethod,
+	options schema.ConnectOptions) (schema.Device, error) {
+	device, err := transport.New(platform)
+	if err != nil {
+		return nil, err
+	}
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	if err := device.ConnectContext(ctx, method, options); err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+func contains(methods []schema.ConnectionMethod, method schema.ConnectionMethod) bool {
+	for _, next := range methods {
+		if next == method {
+			return true
+		}
+	}
+	return false
+}
+
+// release returns a session to the pool after use.
+func (p *pool) release(s *session) {
+	p.put(s, true)
+}
+
+// finish returns a session to the pool once a command on it has ended with err. A command cut short by
+// its context leaves its output still arriving, which the next command would read instead of its own,
+// so that session is dropped.
+func (p *pool) finish(s *session, err error) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		p.drop(s)
+		return
+	}
+	p.release(s)
+}
+
+// put returns a session to the pool, marking it as used unless it was only health checked.
+func (p *pool) put(s *session, used bool) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	if s.state != Busy {
+		return
+	}
+	s.state = Ready
+	if used {
+		s.lastUsed = time.Now()
+	}
+	p.notify()
+}
+
+// remove forgets a session. The pool must be locked.
+func (p *pool) remove(s *session) {
+	for i, next := range p.sessions {
+		if next == s {
+			p.sessions = append(p.sessions[:i], p.sessions[i+1:]...)
+			break
+		}
+	}
+	s.state = Closed
+	p.notify()
+}
+
+// drop disconnects a session that is no longer usable.
+func (p *pool) drop(s *session) {
+	p.mut.Lock()
+	p.remove(s)
+	p.mut.Unlock()
+	if s.device != nil {
+		s.device.Disconnect()
+	}
+}
+
+// disconnect closes every session, stopping running commands with transport.ErrNotConnected.
+// It returns true if any session was open.
+func (p *pool) disconnect() bool {
+	p.mut.Lock()
+	sessions := p.sessions
+	p.sessions = nil
+	p.err = nil
+	for _, s := range sessions {
+		s.state = Closed
+	}
+	p.notify()
+	p.mut.Unlock()
+	for _, s := range sessions {
+		if s.device != nil {
+			s.device.Disconnect()
+		}
+	}
+	return len(sessions) > 0
+}
+
+// idle reserves the ready sessions that haven't been used since before the cutoff, for closing or a health check.
+func (p *pool) idle(cutoff time.Time) (expired, alive []*session) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	for _, s := range p.sessions {
+		if s.state != Ready {
+			continue
+		}
+		s.state = Busy
+		if s.lastUsed.Before(cutoff) {
+			expired = append(expired, s)
+		} else {
+			alive = append(alive, s)
+		}
+	}
+	return expired, alive
+}
+
+// healthy checks that the session still answers with a prompt.
+func healthy(d schema.Device, timeout time.Duration) bool {
+	if c, ok := d.(interface{ Connected() bool }); ok && !c.Connected() {
+		return false
+	}
+	p, ok := d.(transport.Prompter)
+	if !ok {
+		return true
+	}
+	// an empty command sends a bare return, which only redisplays the prompt
+	_, err := d.WriteExpectTimeout("", p.Prompt(), timeout)
+	return err == nil
+}
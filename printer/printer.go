@@ -1,3 +1,171 @@
+// Package printer writes the commands that change the config of a device into the one desired, so that
+// the intent can be pushed instead of a hand written change script.
 package printer
 
-//printer will be used to write config files for deployment
+import (
+	"regexp"
+	"strings"
+
+	"github.com/morganhein/gondi/configtree"
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/transport"
+)
+
+// Repeated matches the statements of indented configs that can be entered more than once, so that entering
+// a new value adds to the old one instead of replacing it, ie "ntp server 10.0.0.1".
+var Repeated = []*regexp.Regexp{
+	regexp.MustCompile(`^ntp (server|peer) `),
+	regexp.MustCompile(`^logging (host )?\d`),
+	regexp.MustCompile(`^ip (route|name-server|helper-address) `),
+	regexp.MustCompile(`^ip(v4)? address .* secondary$`),
+	regexp.MustCompile(`^ipv6 address `),
+	regexp.MustCompile(`^snmp-server (host|community) `),
+	regexp.MustCompile(`^access-list `),
+	regexp.MustCompile(`^(\d+ )?(permit|deny|remark) `),
+}
+
+// Remediate returns the commands that change the running config of the platform into the desired one, in the
+// order they are entered in configuration mode. Entering and leaving configuration mode, and committing, is
+// left to the caller.
+func Remediate(platform schema.DeviceType, running, desired string) ([]string, error) {
+	changes, err := configtree.Compare(platform, running, desired)
+	if err != nil {
+		return nil, err
+	}
+	return Commands(platform, changes), nil
+}
+
+// Commands returns the commands that make the changes to a config of the platform. Junos configs are changed
+// by "delete" and "set" statements, and all others like IOS, by entering the statements in their stanzas and
+// prefixing those removed with "no".
+func Commands(platform schema.DeviceType, changes configtree.Changes) []string {
+	if platform == transport.Juniper {
+		return junos(changes)
+	}
+	return ios(changes)
+}
+
+// commands are the commands entered into an indented config, with the stanzas they were entered in
+type commands struct {
+	list    []string
+	context []string
+}
+
+// at enters the command in the stanzas of the path, leaving with "exit" the stanzas it isn't in
+func (c *commands) at(path []string, command string) {
+	common := 0
+	for common < len(c.context) && common < len(path) && c.context[common] == path[common] {
+		common++
+	}
+	for i := len(c.context); i > common; i-- {
+		c.list = append(c.list, "exit")
+	}
+	c.list = append(c.list, path[common:]...)
+	c.list = append(c.list, command)
+	c.context = path
+}
+
+// add enters the statement, and those below it in its stanza
+func (c *commands) add(path []string, n *configtree.Node) {
+	c.at(path, n.Line)
+	if strings.HasPrefix(n.Line, "banner ") {
+		// the lines of a banner are its text, up to the delimiter
+		for _, line := range n.Children {
+			c.list = append(c.list, line.Line)
+		}
+		return
+	}
+	if len(n.Children) == 0 {
+		return
+	}
+	inner := append(path[:len(path):len(path)], n.Line)
+	c.context = inner
+	for _, child := range n.Children {
+		c.add(inner, child)
+	}
+}
+
+// ios returns the commands making the changes to an indented config. A changed statement is entered over
+// the old one, which the device replaces, unless the statement is Repeated and has to be removed first.
+func ios(changes configtree.Changes) []string {
+	c := &commands{}
+	for _, change := range changes {
+		switch change.Type {
+		case configtree.Removed:
+			c.at(change.Path, negate(change.From.Line))
+		case configtree.Changed:
+			if repeated(change.From.Line) {
+				c.at(change.Path, negate(change.From.Line))
+			}
+			c.add(change.Path, change.To)
+		case configtree.Added:
+			c.add(change.Path, change.To)
+		}
+	}
+	return c.list
+}
+
+// negate returns the command removing the statement: "no" and the statement, or for a statement that is
+// itself negated, "default" and what it negated
+func negate(line string) string {
+	if strings.HasPrefix(line, "no ") {
+		return "default " + strings.TrimPrefix(line, "no ")
+	}
+	if strings.HasPrefix(line, "banner ") {
+		// without its delimiter and text
+		return "no " + strings.Join(strings.Fields(line)[:2], " ")
+	}
+	return "no " + line
+}
+
+// repeated returns true if the statement is Repeated
+func repeated(line string) bool {
+	for _, r := range Repeated {
+		if r.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// junos returns the statements making the changes to a Junos config: the deletes, and then the sets
+func junos(changes configtree.Changes) []string {
+	var deletes, sets []string
+	for _, change := range changes {
+		if change.From != nil {
+			path, _ := statement(change.Path, change.From.Line)
+			deletes = append(deletes, "delete "+strings.Join(path, " "))
+		}
+		if change.To != nil {
+			sets = append(sets, set(change.Path, change.To)...)
+		}
+	}
+	return append(deletes, sets...)
+}
+
+// set returns the statements setting the statement and those below it, deactivating those that are inactive
+func set(path []string, n *configtree.Node) []string {
+	here, inactive := statement(path, n.Line)
+	var statements []string
+	if len(n.Children) == 0 {
+		statements = append(statements, "set "+strings.Join(here, " "))
+	}
+	for _, child := range n.Children {
+		statements = append(statements, set(append(path[:len(path):len(path)], n.Line), child)...)
+	}
+	if inactive {
+		statements = append(statements, "deactivate "+strings.Join(here, " "))
+	}
+	return statements
+}
+
+// statement returns the words of the statement at the path, without "inactive:" annotations, and whether
+// the statement itself is inactive
+func statement(path []string, line string) ([]string, bool) {
+	words := make([]string, 0, len(path)+1)
+	for _, p := range path {
+		words = append(words, strings.TrimPrefix(p, "inactive: "))
+	}
+	inactive := strings.HasPrefix(line, "inactive: ")
+	return append(words, strings.TrimPrefix(line, "inactive: ")), inactive
+}
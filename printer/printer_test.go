@@ -0,0 +1,131 @@
+package printer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/morganhein/gondi/gondisim"
+	"github.com/morganhein/gondi/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemediate_IOS(t *testing.T) {
+	running, err := gondisim.Output("cisco_ios", "show running-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	desired := strings.NewReplacer(
+		"hostname access1\n", "hostname access2\n",
+		" description desk 2-14\n", " description desk 2-16\n",
+		"interface GigabitEthernet1/0/3\n shutdown\n", "interface GigabitEthernet1/0/3\n description spare\n",
+		"vlan 20\n name voice\n!\n", "",
+		" switchport voice vlan 20\n", "",
+		"interface Vlan1\n no ip address\n", "interface Vlan1\n",
+		"ntp server 10.0.0.1\n", "ntp server 10.0.0.2\n",
+		"line vty 5 15\n", "banner motd ^C\nAuthorised access only\n^C\nline vty 5 15\n",
+	).Replace(running)
+	// the order of the statements doesn't matter
+	desired = strings.Replace(desired, "ip ssh version 2\n", "", 1) + "ip ssh version 2\n"
+
+	commands, err := Remediate(transport.Cisco, running, desired)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"hostname access2",
+		"no vlan 20",
+		"interface GigabitEthernet1/0/2",
+		"description desk 2-16",
+		"no switchport voice vlan 20",
+		"exit",
+		"interface GigabitEthernet1/0/3",
+		"no shutdown",
+		"description spare",
+		"exit",
+		"interface Vlan1",
+		"default ip address",
+		"exit",
+		"no ntp server 10.0.0.1",
+		"ntp server 10.0.0.2",
+		"banner motd ^C",
+		"Authorised access only",
+		"^C",
+	}, commands)
+
+	commands, err = Remediate(transport.Cisco, running, running)
+	assert.NoError(t, err)
+	assert.Empty(t, commands)
+}
+
+func TestRemediate_Lists(t *testing.T) {
+	running := "hostname access1\nusername alice privilege 15 secret 5 abc\nvlan 20\ninterface Gi1\n" +
+		"interface Gi2\n description uplink\n"
+	desired := "hostname access2\nusername bob privilege 15 secret 5 abc\nvlan 30\ninterface Gi3\n" +
+		"interface Gi2\n description to dist1\n"
+	commands, err := Remediate(transport.Cisco, running, desired)
+	assert.NoError(t, err)
+	// the entries replaced are removed, while the settings are entered over the old value
+	assert.Equal(t, []string{
+		"hostname access2",
+		"no username alice privilege 15 secret 5 abc",
+		"no vlan 20",
+		"no interface Gi1",
+		"interface Gi2",
+		"description to dist1",
+		"exit",
+		"username bob privilege 15 secret 5 abc",
+		"vlan 30",
+		"interface Gi3",
+	}, commands)
+}
+
+func TestRemediate_Nested(t *testing.T) {
+	running, err := gondisim.Output(string(transport.CiscoXR), "show running-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	desired := strings.Replace(running, "  0.0.0.0/0 10.0.0.1\n", "  0.0.0.0/0 10.0.0.1\n  10.2.0.0/16 10.1.0.2\n", 1)
+	desired = strings.Replace(desired, "ssh server v2\n", "router ospf 1\n area 0\n  interface TenGigE0/0/0/0\n   cost 10\n", 1)
+	desired = strings.Replace(desired, "interface TenGigE0/0/0/1\n shutdown\n!\n", "", 1)
+
+	commands, err := Remediate(transport.CiscoXR, running, desired)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"no interface TenGigE0/0/0/1",
+		"router static",
+		"address-family ipv4 unicast",
+		"10.2.0.0/16 10.1.0.2",
+		"exit",
+		"exit",
+		"no ssh server v2",
+		"router ospf 1",
+		"area 0",
+		"interface TenGigE0/0/0/0",
+		"cost 10",
+	}, commands)
+}
+
+func TestRemediate_Junos(t *testing.T) {
+	running, err := gondisim.Output(string(transport.Juniper), "show configuration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	desired := strings.NewReplacer(
+		`"to core1"`, `"to core2"`,
+		"    xe-0/0/1 {\n        disable;\n    }\n", "    inactive: xe-0/0/2 {\n        unit 0 {\n            family inet;\n        }\n    }\n",
+		"    ntp {\n", "    ntp {\n        server 10.0.0.2;\n",
+		"        netconf {\n            ssh;\n        }\n", "",
+	).Replace(running)
+	commands, err := Remediate(transport.Juniper, running, desired)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"delete system services netconf",
+		`delete interfaces xe-0/0/0 description "to core1"`,
+		"delete interfaces xe-0/0/1",
+		"set system ntp server 10.0.0.2",
+		`set interfaces xe-0/0/0 description "to core2"`,
+		"set interfaces xe-0/0/2 unit 0 family inet",
+		"deactivate interfaces xe-0/0/2",
+	}, commands)
+
+	_, err = Remediate(transport.Juniper, running, "system {\n")
+	assert.EqualError(t, err, `The config ends inside "system".`)
+}
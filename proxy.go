@@ -0,0 +1,170 @@
+package gondi
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/textfsm"
+	"github.com/morganhein/gondi/transport"
+)
+
+// pooled is the device returned by GetDevice. Every command borrows a session from the pool.
+type pooled struct {
+	pool *pool
+}
+
+// run borrows a session for a single call
+func (d *pooled) run(ctx context.Context, call func(device schema.Device) error) error {
+	s, err := d.pool.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	err = call(s.device)
+	d.pool.finish(s, err)
+	return err
+}
+
+func (d *pooled) Initialize() error {
+	return nil
+}
+
+func (d *pooled) SupportedMethods() []schema.ConnectionMethod {
+	return d.pool.template.SupportedMethods()
+}
+
+func (d *pooled) Connect(method schema.ConnectionMethod, options schema.ConnectOptions, args ...string) error {
+	return d.ConnectContext(context.Background(), method, options, args...)
+}
+
+// ConnectContext replaces the device's connection details, and connects a session straight away.
+func (d *pooled) ConnectContext(ctx context.Context, method schema.ConnectionMethod, options schema.ConnectOptions,
+	args ...string) error {
+	d.pool.disconnect()
+	d.pool.mut.Lock()
+	d.pool.config.Methods = []schema.ConnectionMethod{method}
+	d.pool.config.Options = options
+	d.pool.mut.Unlock()
+	return d.run(ctx, func(schema.Device) error { return nil })
+}
+
+// Disconnect closes every session of the device. It connects again on next use.
+func (d *pooled) Disconnect() bool {
+	return d.pool.disconnect()
+}
+
+func (d *pooled) Expect(expectation *regexp.Regexp, timeout time.Duration) (result []string, err error) {
+	err = d.run(context.Background(), func(device schema.Device) (err error) {
+		result, err = device.Expect(expectation, timeout)
+		return err
+	})
+	return result, err
+}
+
+func (d *pooled) ExpectContext(ctx context.Context, expectation *regexp.Regexp) (result []string, err error) {
+	err = d.run(ctx, func(device schema.Device) (err error) {
+		result, err = device.ExpectContext(ctx, expectation)
+		return err
+	})
+	return result, err
+}
+
+func (d *pooled) Write(command string, newline bool) (sent int, err error) {
+	err = d.run(context.Background(), func(device schema.Device) (err error) {
+		sent, err = device.Write(command, newline)
+		return err
+	})
+	return sent, err
+}
+
+func (d *pooled) WriteExpect(command string, expectation *regexp.Regexp) (result []string, err error) {
+	err = d.run(context.Background(), func(device schema.Device) (err error) {
+		result, err = device.WriteExpect(command, expectation)
+		return err
+	})
+	return result, err
+}
+
+func (d *pooled) WriteCapture(command string) (result []string, err error) {
+	err = d.run(context.Background(), func(device schema.Device) (err error) {
+		result, err = device.WriteCapture(command)
+		return err
+	})
+	return result, err
+}
+
+// WriteParse sends the command, and parses its output with the template, or the platform's embedded
+// template for the command if it is nil.
+func (d *pooled) WriteParse(command string, template *textfsm.Template) (records []textfsm.Record, err error) {
+	return d.WriteParseContext(context.Background(), command, template)
+}
+
+func (d *pooled) WriteParseContext(ctx context.Context, command string, template *textfsm.Template) (records []textfsm.Record, err error) {
+	err = d.run(ctx, func(device schema.Device) (err error) {
+		p, ok := device.(transport.Parser)
+		if !ok {
+			return errors.New("The device is unable to parse output.")
+		}
+		records, err = p.WriteParseContext(ctx, command, template)
+		return err
+	})
+	return records, err
+}
+
+func (d *pooled) WriteExpectTimeout(command string, expectation *regexp.Regexp, timeout time.Duration) (result []string, err error) {
+	err = d.run(context.Background(), func(device schema.Device) (err error) {
+		result, err = device.WriteExpectTimeout(command, expectation, timeout)
+		return err
+	})
+	return result, err
+}
+
+func (d *pooled) WriteExpectContext(ctx context.Context, command string, expectation *regexp.Regexp) (result []string, err error) {
+	err = d.run(ctx, func(device schema.Device) (err error) {
+		result, err = device.WriteExpectContext(ctx, command, expectation)
+		return err
+	})
+	return result, err
+}
+
+func (d *pooled) Upload(local, remote string, progress schema.Progress) error {
+	return d.run(context.Background(), func(device schema.Device) error {
+		return device.Upload(local, remote, progress)
+	})
+}
+
+func (d *pooled) Download(remote, local string, progress schema.Progress) error {
+	return d.run(context.Background(), func(device schema.Device) error {
+		return device.Download(remote, local, progress)
+	})
+}
+
+func (d *pooled) Options() schema.ConnectOptions {
+	d.pool.mut.Lock()
+	defer d.pool.mut.Unlock()
+	return d.pool.config.Options
+}
+
+// prompter returns the platform's prompts, or the generic ones for drivers without a definition
+func (d *pooled) prompter() transport.Prompter {
+	if p, ok := d.pool.template.(transport.Prompter); ok {
+		return p
+	}
+	generic, _ := transport.New(transport.Generic)
+	return generic.(transport.Prompter)
+}
+
+// Prompt, EnablePrompt and ConfigPrompt make the pooled device a transport.Prompter, like the drivers
+func (d *pooled) Prompt() *regexp.Regexp {
+	return d.prompter().Prompt()
+}
+
+func (d *pooled) EnablePrompt() *regexp.Regexp {
+	return d.prompter().EnablePrompt()
+}
+
+func (d *pooled) ConfigPrompt() *regexp.Regexp {
+	return d.prompter().ConfigPrompt()
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"io"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,10 +15,19 @@ import (
 var log schema.Logger
 
 type Publisher struct {
-	device schema.Device
-	input  chan schema.MessageEvent
-	s      map[int]chan schema.MessageEvent
-	mut    sync.RWMutex
+	device   schema.Device
+	input    chan schema.MessageEvent
+	s        map[int]subscription
+	mut      sync.RWMutex
+	redactor *strings.Replacer // hides the device's secrets, nil if there are none
+}
+
+// subscription is a listener of a single device. It receives every message, so the device
+// never misses output, and done unblocks the publisher once the listener unsubscribes.
+type subscription struct {
+	events chan schema.MessageEvent
+	done   chan struct{}
+	raw    bool // the device's own listener, which sees the secrets the device really sent
 }
 
 type subscriber struct {
@@ -41,14 +51,24 @@ func New(device schema.Device, input chan schema.MessageEvent) *Publisher {
 	return &Publisher{
 		device: device,
 		input:  input,
-		s:      make(map[int]chan schema.MessageEvent, 2),
+		s:      make(map[int]subscription, 2),
 		mut:    sync.RWMutex{},
 	}
 }
 
-// Subscribe adds another listener to this pubsub, messages to be passed via the channel
+// Subscribe adds another listener to this pubsub, messages to be passed via the channel with the secrets hidden.
 // The id of this subscription is returned, which may be used to unsubscribe
 func (p *Publisher) Subscribe(s chan schema.MessageEvent) (id int) {
+	return p.subscribe(s, false)
+}
+
+// SubscribeRaw adds a listener that gets the messages as the device sent them, secrets included. It is
+// for the device's own listeners, which match and capture the output; observers use Subscribe.
+func (p *Publisher) SubscribeRaw(s chan schema.MessageEvent) (id int) {
+	return p.subscribe(s, true)
+}
+
+func (p *Publisher) subscribe(s chan schema.MessageEvent, raw bool) (id int) {
 	p.mut.Lock()
 	defer p.mut.Unlock()
 	next := 0
@@ -57,7 +77,7 @@ func (p *Publisher) Subscribe(s chan schema.MessageEvent) (id int) {
 	if len(keys) > 0 {
 		//sort them
 		i := 0
-		for k := range sub.s {
+		for k := range p.s {
 			keys[i] = k
 			i++
 		}
@@ -67,7 +87,7 @@ func (p *Publisher) Subscribe(s chan schema.MessageEvent) (id int) {
 		next = keys[len(keys)-1] + 1
 	}
 	//Add the sub to the map with the next id in order
-	p.s[next] = s
+	p.s[next] = subscription{events: s, done: make(chan struct{}), raw: raw}
 	log.Debug("Subscribing from id", next)
 	return next
 }
@@ -76,27 +96,56 @@ func (p *Publisher) Unsubscribe(id int) {
 	log.Debug("Unsubscribing from id", id)
 	p.mut.Lock()
 	defer p.mut.Unlock()
-	if _, ok := p.s[id]; ok {
+	if s, ok := p.s[id]; ok {
+		close(s.done)
 		delete(p.s, id)
 	}
 }
 
+// Redact hides the secrets in every message published to observers from now on, and in the logs, replacing
+// the secrets given before. Empty secrets are ignored.
+func (p *Publisher) Redact(secrets ...string) {
+	var pairs []string
+	for _, secret := range secrets {
+		if secret != "" {
+			pairs = append(pairs, secret, schema.Redact(secret))
+		}
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.redactor = nil
+	if len(pairs) > 0 {
+		p.redactor = strings.NewReplacer(pairs...)
+	}
+}
+
+// Redacted returns the message with the secrets hidden.
+func (p *Publisher) Redacted(message string) string {
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	if p.redactor == nil {
+		return message
+	}
+	return p.redactor.Replace(message)
+}
+
 // Attach creates the listeners for stdout and stderr,
 // and begins the publisher to distribute the messages to all subs.
-func (p *Publisher) Attach(stdout, stderr io.Reader, shutdown chan bool, wg sync.WaitGroup) {
+// It returns once shutdown is signalled, marking wg as done; the caller must add to wg beforehand.
+func (p *Publisher) Attach(stdout, stderr io.Reader, shutdown chan bool, wg *sync.WaitGroup) {
 	//log.Info()("Device attached to publisher.")
-	wg.Add(1)
 	defer wg.Done()
 	qstdout := make(chan bool, 1)
 	qstderr := make(chan bool, 1)
 	if stdout != nil {
-		go attachReader(p.device, stdout, schema.Stdout, p.input, qstdout)
+		go p.attachReader(stdout, schema.Stdout, qstdout)
 	}
 	if stderr != nil {
-		go attachReader(p.device, stderr, schema.Stderr, p.input, qstderr)
+		go p.attachReader(stderr, schema.Stderr, qstderr)
 	}
 	loopCancel := make(chan bool, 1)
-	loopWg := sync.WaitGroup{}
+	loopWg := &sync.WaitGroup{}
+	loopWg.Add(1)
 	go p.start(loopCancel, loopWg)
 
 	// wait for shutdown signal
@@ -106,65 +155,120 @@ func (p *Publisher) Attach(stdout, stderr io.Reader, shutdown chan bool, wg sync
 	qstdout <- true
 	qstderr <- true
 
-	wg.Wait()
+	loopWg.Wait()
 	log.Debug("Device un-attached.")
 }
 
-func (p *Publisher) start(shutdown chan bool, wg sync.WaitGroup) {
-	wg.Add(1)
+func (p *Publisher) start(shutdown chan bool, wg *sync.WaitGroup) {
 	defer wg.Done()
 	for {
 		select {
 		case <-shutdown:
 			return
 		case line := <-p.input:
-			// Send to the locally subscribed listeners (probably just the device)
+			redacted := line
+			redacted.Message = p.Redacted(line.Message)
+			// Send to the externally subscribed listeners first, so they have every line
+			// the device has seen by the time a command returns
+			sub.mut.RLock()
+			for _, s := range sub.s {
+				send(s, redacted)
+			}
+			sub.mut.RUnlock()
+			// Send to the locally subscribed listeners (probably just the device), waiting
+			// for each of them unless it unsubscribes in the meantime
 			p.mut.RLock()
+			local := make([]subscription, 0, len(p.s))
 			for _, s := range p.s {
-				if len(s) < 20 {
-					s <- line
-				}
+				local = append(local, s)
 			}
 			p.mut.RUnlock()
-			sub.mut.RLock()
-			// Send to the externally subscribed listeners
-			for _, s := range sub.s {
-				if len(s) < 20 {
-					s <- line
+			for _, s := range local {
+				e := redacted
+				if s.raw {
+					e = line
+				}
+				select {
+				case s.events <- e:
+				case <-s.done:
 				}
 			}
-			sub.mut.RUnlock()
-		default:
-			time.Sleep(time.Duration(30) * time.Millisecond)
 		}
 	}
 }
 
-func attachReader(device schema.Device, r io.Reader, t schema.EventType, output chan schema.MessageEvent, stop chan bool) {
+// send passes the event on to an external listener without blocking, dropping it if the listener's buffer is full.
+func send(s chan schema.MessageEvent, e schema.MessageEvent) {
+	select {
+	case s <- e:
+	default:
+	}
+}
+
+// Publish sends a message from the device itself, ie a command written to stdin, to all subscribers.
+func (p *Publisher) Publish(message string, t schema.EventType) {
+	p.input <- schema.MessageEvent{
+		Source:  p.device,
+		Message: message,
+		Dir:     t,
+		Time:    time.Now(),
+	}
+}
+
+// attachReader publishes the lines read from r until stopped
+func (p *Publisher) attachReader(r io.Reader, t schema.EventType, stop chan bool) {
 	scanner := bufio.NewScanner(r)
+	lastCR := false  // a \r ended the last line, so a leading \n only completes that line ending
+	partial := false // the last token wasn't ended by a line ending
 	onNewline := func(data []byte, atEOF bool) (advance int, token []byte, err error) {
-
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		if lastCR && data[0] == '\n' {
+			lastCR = false
+			return 1, nil, nil
+		}
+		lastCR = false
+		partial = false
 		for i := 0; i < len(data); i++ {
-			if data[i] == '\n' || data[i] == '\r' {
+			if data[i] == '\n' {
+				return i + 1, data[:i], nil
+			}
+			if data[i] == '\r' {
+				if i+1 < len(data) && data[i+1] == '\n' {
+					return i + 2, data[:i], nil
+				}
+				lastCR = true
 				return i + 1, data[:i], nil
 			}
 		}
+		partial = true
 		return len(data), data, nil
 	}
 	scanner.Split(onNewline)
 	for {
 		if ok := scanner.Scan(); ok {
-			line := scanner.Text()
 			e := schema.MessageEvent{
-				Source:  device,
-				Message: line,
+				Source:  p.device,
+				Message: scanner.Text(),
 				Dir:     t,
 				Time:    time.Now(),
+				Partial: partial,
+			}
+			select {
+			case p.input <- e:
+			case <-stop:
+				log.Debug("Reader loop closing.")
+				return
 			}
-			output <- e
-			log.Debug("Pubsub sent: ", e.Message)
+			log.Debug("Pubsub sent: ", p.Redacted(e.Message))
 		} else {
-			log.Warning("Scanning stopped, this error means a memory leak may be occurring.")
+			if err := scanner.Err(); err != nil {
+				log.Warning("Scanning stopped: ", err)
+			} else {
+				log.Debug("Reached the end of the stream.")
+			}
+			return
 		}
 		select {
 		case <-stop:
@@ -199,3 +303,10 @@ func Subscribe(s chan schema.MessageEvent) (id int) {
 	sub.s[next] = s
 	return next
 }
+
+// Unsubscribe removes a listener added with Subscribe. No more messages are sent to it once this returns.
+func Unsubscribe(id int) {
+	sub.mut.Lock()
+	defer sub.mut.Unlock()
+	delete(sub.s, id)
+}
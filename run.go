@@ -0,0 +1,157 @@
+package gondi
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/transport"
+)
+
+// Job is the work RunAll does on each device.
+type Job struct {
+	// Command describes the job in the results, ie the command that was sent
+	Command string
+	// Run is given a session of the device, reserved until it returns. DeviceID(ctx) is the device's id
+	Run func(ctx context.Context, device schema.Device) (output []string, err error)
+}
+
+type deviceKey struct{}
+
+// DeviceID returns the id of the device a job is running on, from the context given to Job.Run.
+func DeviceID(ctx context.Context) string {
+	id, _ := ctx.Value(deviceKey{}).(string)
+	return id
+}
+
+// Command returns a job that sends the command to each device, and captures its output up to the prompt.
+func Command(command string) Job {
+	return Job{
+		Command: command,
+		Run: func(ctx context.Context, device schema.Device) ([]string, error) {
+			if p, ok := device.(transport.Prompter); ok {
+				return device.WriteExpectContext(ctx, command, p.Prompt())
+			}
+			return device.WriteCapture(command)
+		},
+	}
+}
+
+// RunOptions tune RunAll. Zero values use the defaults.
+type RunOptions struct {
+	Workers int           // the number of devices worked on at once, 10 by default
+	Timeout time.Duration // the time allowed for each device, including connecting to it; unlimited if zero
+	// Progress is called after each device finishes, with the number of devices finished so far.
+	// Calls are never concurrent.
+	Progress func(result Result, done, total int)
+}
+
+// Result is the outcome of a job on one device.
+type Result struct {
+	DeviceID string
+	Command  string
+	Output   []string
+	Err      error
+	Start    time.Time
+	End      time.Time
+}
+
+// Duration returns how long the device took, including waiting for a session.
+func (r Result) Duration() time.Duration {
+	return r.End.Sub(r.Start)
+}
+
+// Report gathers the results of RunAll, in the order the devices were given.
+type Report struct {
+	Results []Result
+	Start   time.Time
+	End     time.Time
+}
+
+// Failed returns the results of the devices where the job failed.
+func (r *Report) Failed() []Result {
+	var failed []Result
+	for _, result := range r.Results {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Succeeded returns the number of devices where the job succeeded.
+func (r *Report) Succeeded() int {
+	return len(r.Results) - len(r.Failed())
+}
+
+// RunAll runs the job on every device in ids, or on every registered device if ids is empty, using
+// a bounded number of workers. A device failing doesn't stop the others; its error is recorded in
+// its result instead. Cancelling ctx fails the devices that haven't finished yet.
+func (m *Manager) RunAll(ctx context.Context, ids []string, job Job, options RunOptions) *Report {
+	if len(ids) == 0 {
+		ids = m.Devices()
+	}
+	if options.Workers <= 0 {
+		options.Workers = 10
+	}
+	report := &Report{Results: make([]Result, len(ids)), Start: time.Now()}
+
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	mut := sync.Mutex{}
+	done := 0
+	for w := 0; w < options.Workers && w < len(ids); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				result := m.run(ctx, ids[i], job, options.Timeout)
+				mut.Lock()
+				report.Results[i] = result
+				done++
+				if options.Progress != nil {
+					options.Progress(result, done, len(ids))
+				}
+				mut.Unlock()
+			}
+		}()
+	}
+	for i := range ids {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	report.End = time.Now()
+	return report
+}
+
+// run does the job on a single device
+func (m *Manager) run(ctx context.Context, id string, job Job, timeout time.Duration) Result {
+	result := Result{DeviceID: id, Command: job.Command, Start: time.Now()}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	p, err := m.pool(id)
+	var s *session
+	if err == nil {
+		s, err = p.acquire(ctx)
+	}
+	if err != nil {
+		m.log.Warningf("Unable to run %q on %s: %s", job.Command, id, err)
+		result.Err = err
+		result.End = time.Now()
+		return result
+	}
+	result.Output, result.Err = job.Run(context.WithValue(ctx, deviceKey{}, id), s.device)
+	// the job may not say it was cut short, ie when it wraps the error as text
+	aborted := result.Err
+	if aborted != nil && ctx.Err() != nil {
+		aborted = ctx.Err()
+	}
+	p.finish(s, aborted)
+	result.End = time.Now()
+	return result
+}
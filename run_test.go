@@ -0,0 +1,136 @@
+package gondi
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/morganhein/gondi/gondisim"
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunAll(t *testing.T) {
+	sim := startSim(t)
+	defer sim.Close()
+	g := NewG()
+	defer g.Shutdown()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	for i := 1; i <= 4; i++ {
+		assert.NoError(t, g.Register(simConfig(fmt.Sprintf("sw%d", i), sim)))
+	}
+	assert.NoError(t, g.Register(DeviceConfig{
+		ID:       "gone",
+		Platform: transport.Cisco,
+		Methods:  []schema.ConnectionMethod{transport.Telnet},
+		Options:  schema.ConnectOptions{Host: "127.0.0.1", Port: port},
+	}))
+
+	var progress []int
+	report := g.RunAll(context.Background(), []string{"sw1", "gone", "sw2", "sw3", "sw4"}, Command("show slow"),
+		RunOptions{
+			Workers: 2,
+			Progress: func(result Result, done, total int) {
+				assert.Equal(t, 5, total)
+				progress = append(progress, done)
+			},
+		})
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, progress)
+	assert.Len(t, report.Results, 5)
+	assert.Equal(t, 4, report.Succeeded())
+	if assert.Len(t, report.Failed(), 1) {
+		assert.Equal(t, "gone", report.Failed()[0].DeviceID)
+	}
+	for i, id := range []string{"sw1", "gone", "sw2", "sw3", "sw4"} {
+		result := report.Results[i]
+		assert.Equal(t, id, result.DeviceID)
+		assert.Equal(t, "show slow", result.Command)
+		assert.False(t, result.End.Before(result.Start))
+		if id != "gone" {
+			assert.NoError(t, result.Err)
+			assert.Equal(t, []string{"done", "access1>"}, result.Output)
+		}
+	}
+}
+
+func TestRunAll_Workers(t *testing.T) {
+	p, err := gondisim.Lookup("cisco_ios")
+	assert.NoError(t, err)
+	sim := gondisim.New(p)
+	mut := sync.Mutex{}
+	running, most := 0, 0
+	sim.Handler = func(command string, term gondisim.Terminal) bool {
+		if !strings.HasPrefix(command, "show slow") {
+			return false
+		}
+		mut.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		mut.Unlock()
+		time.Sleep(time.Duration(100) * time.Millisecond)
+		mut.Lock()
+		running--
+		mut.Unlock()
+		term.Print("done")
+		return true
+	}
+	assert.NoError(t, sim.StartTelnet())
+	defer sim.Close()
+	g := NewG()
+	defer g.Shutdown()
+	for i := 1; i <= 6; i++ {
+		assert.NoError(t, g.Register(simConfig(fmt.Sprintf("sw%d", i), sim)))
+	}
+
+	// every registered device is used when no ids are given
+	report := g.RunAll(context.Background(), nil, Command("show slow"), RunOptions{Workers: 3})
+	assert.Equal(t, 6, report.Succeeded())
+	mut.Lock()
+	assert.Equal(t, 3, most)
+	mut.Unlock()
+}
+
+func TestRunAll_Timeout(t *testing.T) {
+	sim := startSim(t)
+	defer sim.Close()
+	g := NewG()
+	defer g.Shutdown()
+	assert.NoError(t, g.Register(simConfig("sw1", sim)))
+	dev, _ := g.GetDevice("sw1")
+	// connect first, so only the command can run out of time
+	_, err := dev.WriteCapture("show version")
+	assert.NoError(t, err)
+
+	report := g.RunAll(context.Background(), nil, Command("show slow"),
+		RunOptions{Timeout: time.Duration(50) * time.Millisecond})
+	if assert.Len(t, report.Failed(), 1) {
+		assert.Equal(t, context.DeadlineExceeded, report.Results[0].Err)
+	}
+	// the session of the aborted command is dropped, so its late output isn't read by the next job
+	report = g.RunAll(context.Background(), nil, Command("show version"), RunOptions{})
+	if assert.NoError(t, report.Results[0].Err) && assert.NotEmpty(t, report.Results[0].Output) {
+		assert.NotEqual(t, "done", report.Results[0].Output[0])
+		assert.Contains(t, strings.Join(report.Results[0].Output, "\n"), "Cisco IOS Software")
+	}
+
+	// a job can be any function of the session
+	report = g.RunAll(context.Background(), []string{"sw1"}, Job{
+		Command: "platform",
+		Run: func(ctx context.Context, device schema.Device) ([]string, error) {
+			return []string{string(device.(interface{ Platform() schema.DeviceType }).Platform())}, nil
+		},
+	}, RunOptions{})
+	assert.NoError(t, report.Results[0].Err)
+	assert.Equal(t, []string{"cisco_ios"}, report.Results[0].Output)
+}
@@ -1,19 +1,24 @@
 package schema
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"regexp"
 	"time"
 )
 
 type EventType int
-type DeviceType int
+type DeviceType string // the platform name of a registered driver, ie "cisco_ios" or "junos"
 type ConnectionMethod int
 type TransferMethod int
+type HostKeyMode int
 
 const (
 	SCP TransferMethod = iota
 	FTP
 	TFTP
+	HTTP
 )
 
 const (
@@ -22,11 +27,25 @@ const (
 	Stdout EventType = iota
 )
 
+const (
+	// HostKeyStrict only accepts host keys already present in the known_hosts file.
+	HostKeyStrict HostKeyMode = iota
+	// HostKeyPinned only accepts the host key matching the pinned fingerprint.
+	HostKeyPinned
+	// HostKeyTOFU trusts and stores the host key on first use, and strictly checks it afterwards.
+	HostKeyTOFU
+	// HostKeyInsecure accepts any host key. Only use this for lab devices.
+	HostKeyInsecure
+)
+
 type MessageEvent struct {
 	Source  Device
 	Message string
 	Dir     EventType
 	Time    time.Time
+	// Partial is set when the device has not ended the line yet, ie for a prompt, so the
+	// rest of the line may follow in the next message.
+	Partial bool
 }
 
 type ConnectOptions struct {
@@ -36,7 +55,72 @@ type ConnectOptions struct {
 	Password       string
 	EnablePassword string
 	Cert           string
-	Method         ConnectionMethod // the method that this connection was successful with? not sure
+	Method         ConnectionMethod // the method that this connection was successful with
+	HostKey        HostKeyPolicy
+	Console        string // the console server port of the device, "host:port", for the console method
+	// Credentials looks up the username and passwords when connecting, replacing the ones above
+	Credentials CredentialProvider
+	// CredentialKey identifies the device to the credential provider, the Host if empty
+	CredentialKey string
+}
+
+// String describes the options without their passwords, so they are safe to log.
+func (o ConnectOptions) String() string {
+	return fmt.Sprintf("{Host:%s Port:%d Console:%s Username:%s Password:%s EnablePassword:%s Cert:%s Method:%d}",
+		o.Host, o.Port, o.Console, o.Username, Redact(o.Password), Redact(o.EnablePassword), o.Cert, o.Method)
+}
+
+// GoString is String, so %#v doesn't reveal the passwords either.
+func (o ConnectOptions) GoString() string {
+	return o.String()
+}
+
+// Credentials are the secrets used to log in to a device.
+type Credentials struct {
+	Username       string
+	Password       string
+	EnablePassword string
+}
+
+// String describes the credentials without their passwords, so they are safe to log.
+func (c Credentials) String() string {
+	return fmt.Sprintf("{Username:%s Password:%s EnablePassword:%s}", c.Username, Redact(c.Password),
+		Redact(c.EnablePassword))
+}
+
+// GoString is String, so %#v doesn't reveal the passwords either.
+func (c Credentials) GoString() string {
+	return c.String()
+}
+
+// Redact returns the text shown in place of a secret: nothing if it is empty, stars otherwise.
+func Redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "********"
+}
+
+// ErrNoCredentials is returned by credential providers that have no credentials for the device,
+// which then connects with the credentials of its connect options.
+var ErrNoCredentials = errors.New("No credentials found for the device.")
+
+// CredentialProvider looks up the credentials of a device when it connects, so passwords don't
+// have to be kept in inventory files or in memory between connections.
+type CredentialProvider interface {
+	// Credentials returns the credentials for the device with the key, the device's id or host.
+	// Empty fields keep the values already in the connect options, and so does ErrNoCredentials.
+	Credentials(ctx context.Context, key string) (Credentials, error)
+}
+
+// HostKeyPolicy decides which SSH host keys are trusted for a device.
+// The zero value strictly checks against the user's ~/.ssh/known_hosts file.
+type HostKeyPolicy struct {
+	Mode HostKeyMode
+	// KnownHosts is the OpenSSH known_hosts file used by the Strict and TOFU modes
+	KnownHosts string
+	// Fingerprint is the pinned key fingerprint, ie "SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8"
+	Fingerprint string
 }
 
 type TransferOptions struct {
@@ -48,6 +132,10 @@ type TransferOptions struct {
 	Method   TransferMethod
 }
 
+// Progress is called as a file is copied, with the bytes copied so far and the size of the file, or -1 if the
+// size is unknown.
+type Progress func(copied, total int64)
+
 type Device interface {
 	//Initialize sets up the device. Must be called prior to using the device
 	Initialize() error
@@ -55,21 +143,34 @@ type Device interface {
 	SupportedMethods() []ConnectionMethod
 	//Connect tries to connect using the devices connection options, and optional arguments
 	Connect(method ConnectionMethod, options ConnectOptions, args ...string) error
+	//ConnectContext is Connect, but aborts the dial and login as soon as ctx is cancelled, returning ctx.Err()
+	ConnectContext(ctx context.Context, method ConnectionMethod, options ConnectOptions, args ...string) error
 	//Disconnect closes the sessions and removes all references to it in the devices module
 	Disconnect() bool
 	//Expect waits for timeout duration and tries to match expectation.
 	Expect(expectation *regexp.Regexp, timeout time.Duration) (result []string, err error)
+	//ExpectContext waits for the expectation using the device's default timeout, or until ctx is cancelled
+	ExpectContext(ctx context.Context, expectation *regexp.Regexp) (result []string, err error)
 	//Write sends the command on the wire, optionally with a return character at the end
 	Write(command string, newline bool) (sent int, err error)
-	//WriteExpect writes to the device, waits for the expectation, and returns the captured text
+	//WriteExpect writes to the device, waits for the expectation, and returns the captured text. An empty
+	//command sends a bare return, ie to redisplay the prompt; use Expect to wait without sending anything
 	WriteExpect(command string, expectation *regexp.Regexp) (result []string, err error)
 	//WriteCapture is a shortcut for WriteExpect(command, device.prompt)
 	WriteCapture(command string) (result []string, err error)
 	//WriteExpectTimeout writes the command to the device, waiting timeout duration for the expectation to match,
 	//returning the captured text between command and expectation, or an error if incomplete
 	WriteExpectTimeout(command string, expectation *regexp.Regexp, timeout time.Duration) (result []string, err error)
+	//WriteExpectContext is WriteExpect, but stops waiting as soon as ctx is cancelled, returning ctx.Err()
+	WriteExpectContext(ctx context.Context, command string, expectation *regexp.Regexp) (result []string, err error)
 	//Options returns the connection options used for this device
 	Options() ConnectOptions
+	//Upload copies the local file to the remote path on the device over SFTP, or SCP if the device lacks SFTP.
+	//A nil progress is not called
+	Upload(local, remote string, progress Progress) error
+	//Download copies the remote file on the device to the local path over SFTP, or SCP if the device lacks SFTP.
+	//A nil progress is not called
+	Download(remote, local string, progress Progress) error
 }
 
 type Logger interface {
@@ -83,6 +184,18 @@ type Logger interface {
 	Criticalf(format string, args ...interface{})
 }
 
+// Facts describe a device, as gathered from its show commands.
+type Facts struct {
+	Hostname  string        `json:"hostname"`
+	Vendor    string        `json:"vendor"`
+	Model     string        `json:"model"`
+	OSVersion string        `json:"os_version"`
+	Serial    string        `json:"serial"`
+	Uptime    time.Duration `json:"uptime"`
+	// Interfaces are the names of the interfaces, leaving out the logical units of Junos
+	Interfaces []string `json:"interfaces"`
+}
+
 type Interaction interface {
 	Device
 	//Enable tries to enter "enable mode" on the device.
@@ -95,14 +208,23 @@ type Interaction interface {
 	//The Cached flag determines whether to retrieve a new version of the config, or
 	//to use a previously and current (probably) config
 	ShowConfig(cached bool) (response string, err error)
-	//SaveConfig saves the local config to a remote server
-	SaveConfig(options TransferOptions, file string) (err error)
-	//LoadConfig retrieves a config from a remote server and loads it
-	LoadConfig(options TransferOptions, file string) (err error)
+	//ShowStartupConfig shows the configuration the device boots with. Platforms that save the running
+	//configuration as it is committed have none, and return an error
+	ShowStartupConfig() (response string, err error)
+	//ShowConfigContext is ShowConfig, but stops waiting for the device as soon as ctx is cancelled
+	ShowConfigContext(ctx context.Context, cached bool) (response string, err error)
+	//ShowStartupConfigContext is ShowStartupConfig, but stops waiting for the device as soon as ctx is cancelled
+	ShowStartupConfigContext(ctx context.Context) (response string, err error)
+	//SaveConfig copies the running config to the file on a remote server, returning the bytes the device reported sending
+	SaveConfig(options TransferOptions, file string) (transferred int64, err error)
+	//LoadConfig retrieves a config from a remote server and loads it, returning the bytes the device reported receiving
+	LoadConfig(options TransferOptions, file string) (transferred int64, err error)
 	//Mem returns long term storage memory usage
 	Storage() (result string, err error)
 	//Ping sends a ping to the destination IP
 	Ping(ip string, tries, timeout int) (result string, err error)
+	//Facts gathers the hostname, model, versions, uptime and interfaces of the device
+	Facts() (facts Facts, err error)
 
 	//Possible other methods
 	//AddVlan tries to add the specified VLAN
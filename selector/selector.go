@@ -0,0 +1,355 @@
+// Package selector picks devices with expressions on their id, fields, tags and groups, ie
+//
+//	site=dc1 && platform=junos && !tag:maintenance
+//	core* || (group:access && rack!=r1*)
+//
+// A term is one of:
+//
+//	key=value   the device's field or label matches the value
+//	key!=value  the device's field or label doesn't match the value, or is missing
+//	tag:value   one of the device's tags matches the value
+//	group:value one of the device's groups matches the value
+//	value       the device's id matches the value
+//
+// Values are glob patterns, where * matches any text, ? a single character and [abc] a class
+// of characters. Values with spaces or operator characters can be quoted with ' or ".
+// Terms are combined with ! (not), && (and), || (or) and parentheses, in that order of precedence.
+package selector
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Target is what an expression is matched against.
+type Target struct {
+	ID     string
+	Fields map[string]string // the built in fields like platform and host, and the labels
+	Tags   []string
+	Groups []string
+}
+
+// Selector is a parsed expression.
+type Selector struct {
+	expr string
+	root node
+}
+
+// Parse parses an expression. An empty expression, or "*", matches every device.
+func Parse(expr string) (*Selector, error) {
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return &Selector{expr: expr, root: all{}}, nil
+	}
+	p := &parser{expr: expr, tokens: tokens}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, p.unexpected()
+	}
+	return &Selector{expr: expr, root: root}, nil
+}
+
+// MustParse is Parse, but panics if the expression is invalid.
+func MustParse(expr string) *Selector {
+	s, err := Parse(expr)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Match returns true if the target is selected.
+func (s *Selector) Match(t Target) bool {
+	return s.root.match(t)
+}
+
+func (s *Selector) String() string {
+	return s.expr
+}
+
+type node interface {
+	match(t Target) bool
+}
+
+type all struct{}
+
+func (all) match(Target) bool { return true }
+
+type not struct{ node node }
+
+func (n not) match(t Target) bool { return !n.node.match(t) }
+
+type and struct{ left, right node }
+
+func (n and) match(t Target) bool { return n.left.match(t) && n.right.match(t) }
+
+type or struct{ left, right node }
+
+func (n or) match(t Target) bool { return n.left.match(t) || n.right.match(t) }
+
+// field compares a field or label
+type field struct {
+	key     string
+	pattern *regexp.Regexp
+	negate  bool
+}
+
+func (n field) match(t Target) bool {
+	value, ok := t.Fields[n.key]
+	if n.key == "id" {
+		value, ok = t.ID, true
+	}
+	matched := ok && n.pattern.MatchString(value)
+	return matched != n.negate
+}
+
+// member matches one of the target's tags or groups
+type member struct {
+	groups  bool
+	pattern *regexp.Regexp
+}
+
+func (n member) match(t Target) bool {
+	values := t.Tags
+	if n.groups {
+		values = t.Groups
+	}
+	for _, v := range values {
+		if n.pattern.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+type tokenKind int
+
+const (
+	word tokenKind = iota
+	equals
+	notEquals
+	bang
+	andOp
+	orOp
+	open
+	closeParen
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	pos   int
+	quote bool
+}
+
+func lex(expr string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(expr[i:], "&&"):
+			tokens = append(tokens, token{kind: andOp, text: "&&", pos: i})
+			i += 2
+		case strings.HasPrefix(expr[i:], "||"):
+			tokens = append(tokens, token{kind: orOp, text: "||", pos: i})
+			i += 2
+		case strings.HasPrefix(expr[i:], "!="):
+			tokens = append(tokens, token{kind: notEquals, text: "!=", pos: i})
+			i += 2
+		case strings.HasPrefix(expr[i:], "=="):
+			tokens = append(tokens, token{kind: equals, text: "==", pos: i})
+			i += 2
+		case c == '=':
+			tokens = append(tokens, token{kind: equals, text: "=", pos: i})
+			i++
+		case c == '!':
+			tokens = append(tokens, token{kind: bang, text: "!", pos: i})
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: open, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: closeParen, text: ")", pos: i})
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("Unterminated quote at position %d of the selector %q.", i+1, expr)
+			}
+			tokens = append(tokens, token{kind: word, text: expr[i+1 : i+1+end], pos: i, quote: true})
+			i += end + 2
+		case c == '&' || c == '|':
+			return nil, fmt.Errorf("Unexpected %q at position %d of the selector %q, did you mean %q?", c, i+1,
+				expr, strings.Repeat(string(c), 2))
+		default:
+			start := i
+			for i < len(expr) && !strings.ContainsRune(" \t\r\n=!()&|\"'", rune(expr[i])) {
+				// a character class can hold operator characters, ie [!0-9]
+				if end := strings.IndexByte(expr[i:], ']'); expr[i] == '[' && end > 0 {
+					i += end
+				}
+				i++
+			}
+			tokens = append(tokens, token{kind: word, text: expr[start:i], pos: start})
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	expr   string
+	tokens []token
+	next   int
+}
+
+func (p *parser) done() bool {
+	return p.next >= len(p.tokens)
+}
+
+func (p *parser) peek(kind tokenKind) bool {
+	return !p.done() && p.tokens[p.next].kind == kind
+}
+
+func (p *parser) unexpected() error {
+	if p.done() {
+		return fmt.Errorf("Unexpected end of the selector %q.", p.expr)
+	}
+	t := p.tokens[p.next]
+	return fmt.Errorf("Unexpected %q at position %d of the selector %q.", t.text, t.pos+1, p.expr)
+}
+
+func (p *parser) or() (node, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek(orOp) {
+		p.next++
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = or{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek(andOp) {
+		p.next++
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = and{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (node, error) {
+	if p.peek(bang) {
+		p.next++
+		n, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return not{n}, nil
+	}
+	if p.peek(open) {
+		p.next++
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peek(closeParen) {
+			return nil, p.unexpected()
+		}
+		p.next++
+		return n, nil
+	}
+	return p.term()
+}
+
+func (p *parser) term() (node, error) {
+	if !p.peek(word) {
+		return nil, p.unexpected()
+	}
+	t := p.tokens[p.next]
+	p.next++
+	if p.peek(equals) || p.peek(notEquals) {
+		negate := p.tokens[p.next].kind == notEquals
+		p.next++
+		if !p.peek(word) {
+			return nil, p.unexpected()
+		}
+		value := p.tokens[p.next]
+		p.next++
+		pattern, err := p.glob(value)
+		return field{key: t.text, pattern: pattern, negate: negate}, err
+	}
+	if !t.quote {
+		if i := strings.IndexByte(t.text, ':'); i > 0 {
+			switch kind := t.text[:i]; kind {
+			case "tag", "group":
+				t.text, t.pos = t.text[i+1:], t.pos+i+1
+				pattern, err := p.glob(t)
+				return member{groups: kind == "group", pattern: pattern}, err
+			}
+		}
+	}
+	if t.text == "*" && !t.quote {
+		return all{}, nil
+	}
+	pattern, err := p.glob(t)
+	return field{key: "id", pattern: pattern}, err
+}
+
+func (p *parser) glob(t token) (*regexp.Regexp, error) {
+	pattern, err := glob(t.text)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid pattern %q at position %d of the selector %q.", t.text, t.pos+1, p.expr)
+	}
+	return pattern, nil
+}
+
+// glob compiles a glob pattern into a regular expression matching the whole value
+func glob(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '[':
+			if end := strings.IndexByte(pattern[i:], ']'); end > 1 {
+				class := pattern[i+1 : i+end]
+				if class[0] == '!' {
+					class = "^" + class[1:]
+				}
+				b.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+				i += end
+				continue
+			}
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
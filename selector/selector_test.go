@@ -0,0 +1,81 @@
+package selector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var targets = []Target{
+	{ID: "core1", Fields: map[string]string{"platform": "junos", "site": "dc1"}, Tags: []string{"core"},
+		Groups: []string{"backbone"}},
+	{ID: "core2", Fields: map[string]string{"platform": "junos", "site": "dc2"},
+		Tags: []string{"core", "maintenance"}},
+	{ID: "access1", Fields: map[string]string{"platform": "cisco_ios", "site": "dc1", "rack": "r12"},
+		Groups: []string{"access"}},
+	{ID: "access 2", Fields: map[string]string{"platform": "cisco_ios"}},
+}
+
+func selected(t *testing.T, expr string) []string {
+	s, err := Parse(expr)
+	if !assert.NoError(t, err, expr) {
+		return nil
+	}
+	ids := []string{}
+	for _, target := range targets {
+		if s.Match(target) {
+			ids = append(ids, target.ID)
+		}
+	}
+	return ids
+}
+
+func TestMatch(t *testing.T) {
+	cases := map[string][]string{
+		"":                              {"core1", "core2", "access1", "access 2"},
+		"*":                             {"core1", "core2", "access1", "access 2"},
+		"core1":                         {"core1"},
+		"core*":                         {"core1", "core2"},
+		"core?":                         {"core1", "core2"},
+		"core[!1]":                      {"core2"},
+		"'access 2'":                    {"access 2"},
+		"id=access*":                    {"access1", "access 2"},
+		"site=dc1":                      {"core1", "access1"},
+		"site==dc1":                     {"core1", "access1"},
+		"site!=dc1":                     {"core2", "access 2"},
+		"tag:core":                      {"core1", "core2"},
+		"group:back*":                   {"core1"},
+		"!tag:maintenance":              {"core1", "access1", "access 2"},
+		"platform=junos && !tag:maint*": {"core1"},
+		"site=dc2 || rack=r1*":          {"core2", "access1"},
+		"site=dc1 && platform=junos || group:access": {"core1", "access1"},
+		"site=dc1 && (platform=junos || rack=r12)":   {"core1", "access1"},
+		"!(site=dc1 || site=dc2)":                    {"access 2"},
+		"!!core1":                                    {"core1"},
+		`rack="r12"`:                                 {"access1"},
+		"missing=*":                                  {},
+	}
+	for expr, expected := range cases {
+		assert.Equal(t, expected, selected(t, expr), expr)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, expr := range []string{
+		"site=",
+		"site=dc1 &&",
+		"(site=dc1",
+		"site=dc1)",
+		"site=dc1 & platform=junos",
+		"'core1",
+		"&& core1",
+		"core1 core2",
+		"core[z-a]",
+	} {
+		_, err := Parse(expr)
+		assert.Error(t, err, expr)
+	}
+	_, err := Parse("site=dc1 && && x")
+	assert.EqualError(t, err, `Unexpected "&&" at position 13 of the selector "site=dc1 && && x".`)
+	assert.Panics(t, func() { MustParse("(") })
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package shell
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyResize signals on the channel when the terminal window is resized, until stop is called
+func notifyResize() (resized <-chan os.Signal, stop func()) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGWINCH)
+	return c, func() { signal.Stop(c) }
+}
@@ -0,0 +1,9 @@
+package shell
+
+import "os"
+
+// notifyResize never signals, since Windows consoles have no resize signal. The size is only sent
+// when attaching.
+func notifyResize() (resized <-chan os.Signal, stop func()) {
+	return nil, func() {}
+}
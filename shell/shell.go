@@ -0,0 +1,237 @@
+// Package shell attaches the local terminal to a device session, like an interactive ssh or telnet
+// client: keystrokes are passed through to the device, and its output is written back.
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/morganhein/gondi/logger"
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/transcript"
+	"golang.org/x/term"
+)
+
+var log schema.Logger
+
+func init() {
+	log = logger.Log
+}
+
+// Device is a connected session the terminal can be attached to. The transport drivers implement it.
+type Device interface {
+	schema.Device
+	Subscribe(events chan schema.MessageEvent) (id int)
+	Unsubscribe(id int)
+}
+
+// resizer is implemented by the devices whose terminal can be resized
+type resizer interface {
+	Resize(width, height int) error
+}
+
+// Options configure an attached terminal.
+type Options struct {
+	// In and Out default to os.Stdin and os.Stdout. When they are a terminal, it is put in raw
+	// mode while attached, and its size is forwarded to the device.
+	In  io.Reader
+	Out io.Writer
+	// Record writes a transcript of the session, if set.
+	Record io.Writer
+}
+
+// Attach passes the keystrokes read from the terminal to the device, and writes its output back, until
+// ~. is typed at the start of a line, the input ends, or ctx is done. Typing ~~ sends a single ~.
+//
+// The device must not run other commands while attached, since they would read its output.
+func Attach(ctx context.Context, device Device, options Options) error {
+	if options.In == nil {
+		options.In = os.Stdin
+	}
+	if options.Out == nil {
+		options.Out = os.Stdout
+	}
+	if options.Record != nil {
+		recorder, err := transcript.NewRecorder(options.Record, device)
+		if err != nil {
+			return err
+		}
+		defer recorder.Close()
+	}
+
+	a := &attached{device: device, out: options.Out, newline: "\n"}
+	var resized <-chan os.Signal
+	if fd, ok := terminal(options.In); ok {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return fmt.Errorf("Unable to set up the terminal: %s", err)
+		}
+		defer term.Restore(fd, state)
+		// the terminal no longer moves to the start of the line by itself
+		a.newline = "\r\n"
+		size := fd
+		if out, ok := terminal(options.Out); ok {
+			size = out
+		}
+		a.size = func() (int, int, error) {
+			return term.GetSize(size)
+		}
+		var stop func()
+		resized, stop = notifyResize()
+		defer stop()
+		a.resize()
+	}
+
+	events := make(chan schema.MessageEvent, 64)
+	id := device.Subscribe(events)
+	defer device.Unsubscribe(id)
+	stop := make(chan struct{})
+	output := make(chan struct{})
+	go a.output(events, stop, output)
+	defer func() {
+		close(stop)
+		<-output
+	}()
+
+	input := make(chan []byte)
+	inputErr := make(chan error, 1)
+	// The read can't be interrupted, so the reader is left behind once detached, until the next keystroke.
+	go read(options.In, input, inputErr, stop)
+
+	// redisplay the prompt, which was shown before we subscribed
+	if _, err := device.Write("", true); err != nil {
+		return err
+	}
+	var esc escape
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-inputErr:
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("Unable to read the terminal: %s", err)
+		case <-resized:
+			a.resize()
+		case data := <-input:
+			send, detach := esc.filter(data)
+			if len(send) > 0 {
+				if _, err := device.Write(string(send), false); err != nil {
+					return err
+				}
+			}
+			if detach {
+				return nil
+			}
+		}
+	}
+}
+
+// attached is a terminal attached to a device
+type attached struct {
+	device  Device
+	out     io.Writer
+	newline string                   // ends the lines written to out
+	size    func() (int, int, error) // the size of the terminal, nil unless it is one
+}
+
+// output writes the output of the device until stop is closed, then closes done
+func (a *attached) output(events chan schema.MessageEvent, stop, done chan struct{}) {
+	defer close(done)
+	for {
+		select {
+		case e := <-events:
+			if e.Dir == schema.Stdin {
+				continue
+			}
+			line := e.Message
+			if !e.Partial {
+				line += a.newline
+			}
+			if _, err := io.WriteString(a.out, line); err != nil {
+				log.Warning("Unable to write the output of the device: ", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// resize sends the size of the terminal to the device
+func (a *attached) resize() {
+	r, ok := a.device.(resizer)
+	if !ok || a.size == nil {
+		return
+	}
+	width, height, err := a.size()
+	if err != nil {
+		log.Debug("Unable to get the size of the terminal: ", err)
+		return
+	}
+	if err := r.Resize(width, height); err != nil {
+		log.Debug("Unable to resize the terminal of the device: ", err)
+	}
+}
+
+// read passes on what is read from r until it fails, or stop is closed
+func read(r io.Reader, input chan []byte, inputErr chan error, stop chan struct{}) {
+	buf := make([]byte, 1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			select {
+			case input <- append([]byte(nil), buf[:n]...):
+			case <-stop:
+				return
+			}
+		}
+		if err != nil {
+			inputErr <- err
+			return
+		}
+	}
+}
+
+// terminal returns the file descriptor of f, if it is a terminal
+func terminal(f interface{}) (int, bool) {
+	file, ok := f.(*os.File)
+	if !ok || !term.IsTerminal(int(file.Fd())) {
+		return 0, false
+	}
+	return int(file.Fd()), true
+}
+
+// escape finds the escape sequence in the keystrokes: a ~ typed at the start of a line, followed by
+// a . to detach, or another ~ to send a single one.
+type escape struct {
+	midLine bool // something other than a line ending was typed since the last one
+	tilde   bool // a ~ was typed at the start of a line, and held back
+}
+
+// filter returns the keystrokes to send on to the device, and whether to detach.
+func (e *escape) filter(data []byte) (send []byte, detach bool) {
+	for _, c := range data {
+		if e.tilde {
+			e.tilde = false
+			switch c {
+			case '.':
+				return send, true
+			case '~':
+				send = append(send, '~')
+				e.midLine = true
+				continue
+			}
+			send = append(send, '~')
+		} else if c == '~' && !e.midLine {
+			e.tilde = true
+			continue
+		}
+		send = append(send, c)
+		e.midLine = c != '\r' && c != '\n'
+	}
+	return send, false
+}
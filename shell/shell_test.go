@@ -0,0 +1,135 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/morganhein/gondi/gondisim"
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+// syncBuffer is a bytes.Buffer safe to read while the terminal writes to it
+type syncBuffer struct {
+	mut sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return b.buf.String()
+}
+
+func connect(t *testing.T) (*gondisim.Server, Device) {
+	sim, err := gondisim.NewSSH("cisco_ios")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev, err := transport.New(transport.Cisco)
+	assert.NoError(t, err)
+	err = dev.Connect(transport.SSH, schema.ConnectOptions{
+		Host:     sim.Host(),
+		Port:     sim.Port(),
+		Username: sim.Username,
+		Password: sim.Password,
+		HostKey:  schema.HostKeyPolicy{Mode: schema.HostKeyPinned, Fingerprint: sim.Fingerprint()},
+	})
+	if err != nil {
+		sim.Close()
+		t.Fatal(err)
+	}
+	return sim, dev.(Device)
+}
+
+func TestAttach(t *testing.T) {
+	sim, dev := connect(t)
+	defer sim.Close()
+	defer dev.Disconnect()
+
+	in, typed := io.Pipe()
+	defer in.Close()
+	var out syncBuffer
+	var record bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		done <- Attach(context.Background(), dev, Options{In: in, Out: &out, Record: &record})
+	}()
+
+	io.WriteString(typed, "show ver")
+	io.WriteString(typed, "sion\n")
+	assert.Eventually(t, func() bool {
+		return strings.Contains(out.String(), "Cisco IOS Software")
+	}, time.Duration(5)*time.Second, time.Duration(10)*time.Millisecond)
+	io.WriteString(typed, "~.")
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Duration(5) * time.Second):
+		t.Fatal("The terminal did not detach.")
+	}
+	assert.Equal(t, []string{"terminal length 0", "show version"}, sim.Commands())
+	assert.Contains(t, out.String(), "access1>")
+	assert.Contains(t, record.String(), "Cisco IOS Software")
+
+	// the device is still usable once detached
+	_, err := dev.WriteCapture("show version")
+	assert.NoError(t, err)
+}
+
+func TestAttach_Cancel(t *testing.T) {
+	sim, dev := connect(t)
+	defer sim.Close()
+	defer dev.Disconnect()
+
+	in, typed := io.Pipe()
+	defer typed.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(50)*time.Millisecond)
+	defer cancel()
+	err := Attach(ctx, dev, Options{In: in, Out: io.Discard})
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		typed  []string
+		sent   string
+		detach bool
+	}{
+		{[]string{"show version\r"}, "show version\r", false},
+		{[]string{"~."}, "", true},
+		{[]string{"~", "."}, "", true},
+		{[]string{"exit\r~.more"}, "exit\r", true},
+		{[]string{"a~."}, "a~.", false},
+		{[]string{"~~."}, "~.", false},
+		{[]string{"~x"}, "~x", false},
+		{[]string{"\n~", "~", "\r~."}, "\n~\r", true},
+	}
+	for _, test := range tests {
+		var e escape
+		var sent []byte
+		detach := false
+		for _, typed := range test.typed {
+			send, d := e.filter([]byte(typed))
+			sent = append(sent, send...)
+			if d {
+				detach = true
+				break
+			}
+		}
+		assert.Equal(t, test.sent, string(sent), "%q", test.typed)
+		assert.Equal(t, test.detach, detach, "%q", test.typed)
+	}
+}
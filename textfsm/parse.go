@@ -0,0 +1,172 @@
+package textfsm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError is returned when a rule with the Error action matches the output.
+type ParseError struct {
+	Rule    int    // the line of the rule in the template
+	Line    string // the line of output it matched
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("The template rejected the output at %q, rule line %d: %s", e.Line, e.Rule, e.Message)
+	}
+	return fmt.Sprintf("The template rejected the output at %q, rule line %d.", e.Line, e.Rule)
+}
+
+// fsm is a single run of a template
+type fsm struct {
+	t       *Template
+	current []interface{} // the values of the record being built: nil until set, a string, or a []string
+	records []Record
+}
+
+// ParseText runs the template over the text, returning the records it found.
+func (t *Template) ParseText(text string) ([]Record, error) {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	return t.ParseLines(strings.Split(strings.TrimSuffix(text, "\n"), "\n"))
+}
+
+// ParseLines runs the template over the lines of output, ie the result of WriteCapture without the prompt.
+func (t *Template) ParseLines(lines []string) ([]Record, error) {
+	f := &fsm{t: t, current: make([]interface{}, len(t.values))}
+	state := stateStart
+	for _, line := range lines {
+		next, err := f.line(state, line)
+		if err != nil {
+			return nil, err
+		}
+		state = next
+		if state == stateEnd {
+			return f.records, nil
+		}
+		if state == stateEOF {
+			break
+		}
+	}
+	// the implicit EOF state records the last values, unless the template declares its own
+	if _, ok := t.states[stateEOF]; !ok {
+		f.record()
+	}
+	if f.records == nil {
+		f.records = []Record{}
+	}
+	return f.records, nil
+}
+
+// line applies the rules of the state to a line of output, returning the state for the next line
+func (f *fsm) line(state, line string) (string, error) {
+	for _, r := range f.t.states[state] {
+		match := r.re.FindStringSubmatchIndex(line)
+		if match == nil {
+			continue
+		}
+		for i, name := range r.re.SubexpNames() {
+			index, ok := f.t.index[name]
+			if !ok || match[2*i] < 0 {
+				continue
+			}
+			f.assign(index, line[match[2*i]:match[2*i+1]])
+		}
+		if r.lineOp == lineError {
+			return state, &ParseError{Rule: r.line, Line: line, Message: r.message}
+		}
+		switch r.recordOp {
+		case recordRecord:
+			f.record()
+		case recordClear:
+			f.clear(false)
+		case recordClearAll:
+			f.clear(true)
+		}
+		if r.lineOp == lineContinue {
+			continue
+		}
+		if r.state != "" {
+			return r.state, nil
+		}
+		return state, nil
+	}
+	return state, nil
+}
+
+// assign sets the value, filling it up into the earlier records if it has the Fillup option
+func (f *fsm) assign(index int, s string) {
+	v := f.t.values[index]
+	if v.options[optList] {
+		list, _ := f.current[index].([]string)
+		f.current[index] = append(list, s)
+		return
+	}
+	f.current[index] = s
+	if v.options[optFillup] && s != "" {
+		for i := len(f.records) - 1; i >= 0; i-- {
+			if f.records[i].String(v.name) != "" {
+				break
+			}
+			f.records[i][v.name] = s
+		}
+	}
+}
+
+// record appends the current values as a record, unless a Required value is empty or nothing was set,
+// then clears them
+func (f *fsm) record() {
+	empty := true
+	for i, v := range f.t.values {
+		switch current := f.current[i].(type) {
+		case string:
+			empty = false
+			if current == "" && v.options[optRequired] {
+				f.clear(false)
+				return
+			}
+		case []string:
+			if len(current) > 0 {
+				empty = false
+			} else if v.options[optRequired] {
+				f.clear(false)
+				return
+			}
+		default:
+			if v.options[optRequired] {
+				f.clear(false)
+				return
+			}
+		}
+	}
+	if empty {
+		return
+	}
+	rec := make(Record, len(f.t.values))
+	for i, v := range f.t.values {
+		switch current := f.current[i].(type) {
+		case string:
+			rec[v.name] = current
+		case []string:
+			rec[v.name] = append([]string(nil), current...)
+		default:
+			if v.options[optList] {
+				rec[v.name] = []string{}
+			} else {
+				rec[v.name] = ""
+			}
+		}
+	}
+	f.records = append(f.records, rec)
+	f.clear(false)
+}
+
+// clear resets the values, keeping the Filldown ones unless all is set
+func (f *fsm) clear(all bool) {
+	for i, v := range f.t.values {
+		if all || !v.options[optFilldown] {
+			f.current[i] = nil
+		}
+	}
+}
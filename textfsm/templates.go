@@ -0,0 +1,128 @@
+package textfsm
+
+import (
+	"bufio"
+	"embed"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+//go:embed templates
+var embedded embed.FS
+
+// ErrNoTemplate is returned by Lookup when no template parses the command's output.
+var ErrNoTemplate = errors.New("No template found for the command.")
+
+// entry is a line of the index, giving the template of a platform's command
+type entry struct {
+	file     string
+	platform string
+	command  *regexp.Regexp
+}
+
+var templates = struct {
+	once   sync.Once
+	index  []entry
+	err    error
+	mut    sync.Mutex
+	parsed map[string]*Template // by file
+}{parsed: make(map[string]*Template)}
+
+// Lookup returns the embedded template for the command of a platform, ie "cisco_ios" and
+// "show ip interface brief". Commands can be abbreviated as they can on the device, like "sh ip int br".
+func Lookup(platform, command string) (*Template, error) {
+	templates.once.Do(loadIndex)
+	if templates.err != nil {
+		return nil, templates.err
+	}
+	command = strings.Join(strings.Fields(command), " ")
+	for _, e := range templates.index {
+		if e.platform == strings.ToLower(platform) && e.command.MatchString(command) {
+			return Load(e.file)
+		}
+	}
+	return nil, ErrNoTemplate
+}
+
+// Load returns an embedded template by its name, ie "cisco_ios_show_version".
+func Load(name string) (*Template, error) {
+	file := strings.TrimSuffix(name, ".textfsm") + ".textfsm"
+	templates.mut.Lock()
+	defer templates.mut.Unlock()
+	if t, ok := templates.parsed[file]; ok {
+		return t, nil
+	}
+	f, err := embedded.Open("templates/" + file)
+	if err != nil {
+		return nil, ErrNoTemplate
+	}
+	defer f.Close()
+	t, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	templates.parsed[file] = t
+	return t, nil
+}
+
+// loadIndex reads the index of the embedded templates. Each line has the template's file, the
+// platform and the command, where [[...]] marks the part of a word that can be left out:
+//
+//	cisco_ios_show_version.textfsm, cisco_ios, sh[[ow]] ver[[sion]]
+func loadIndex() {
+	f, err := embedded.Open("templates/index")
+	if err != nil {
+		templates.err = fmt.Errorf("Unable to read the template index: %s", err)
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, ",", 3)
+		if len(fields) != 3 {
+			templates.err = fmt.Errorf("Invalid template index, line %d: expected the file, platform and command.", n)
+			return
+		}
+		re, err := regexp.Compile("^" + abbreviations(strings.TrimSpace(fields[2])) + "$")
+		if err != nil {
+			templates.err = fmt.Errorf("Invalid template index, line %d: %s", n, err)
+			return
+		}
+		templates.index = append(templates.index, entry{
+			file:     strings.TrimSpace(fields[0]),
+			platform: strings.TrimSpace(fields[1]),
+			command:  re,
+		})
+	}
+}
+
+// abbreviations turns a command like "sh[[ow]] ver[[sion]]" into a regex matching each abbreviation, ie
+// "sh(o(w)?)? ver(s(i(o(n)?)?)?)?".
+func abbreviations(command string) string {
+	var b strings.Builder
+	for len(command) > 0 {
+		start := strings.Index(command, "[[")
+		end := strings.Index(command, "]]")
+		if start < 0 || end < start {
+			b.WriteString(regexp.QuoteMeta(command))
+			break
+		}
+		b.WriteString(regexp.QuoteMeta(command[:start]))
+		optional := command[start+2 : end]
+		for _, c := range optional {
+			b.WriteString("(" + regexp.QuoteMeta(string(c)))
+		}
+		b.WriteString(strings.Repeat(")?", len([]rune(optional))))
+		command = command[end+2:]
+	}
+	return b.String()
+}
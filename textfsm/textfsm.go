@@ -0,0 +1,374 @@
+// Package textfsm turns the text output of CLI commands into records, using templates in the
+// TextFSM syntax (https://github.com/google/textfsm/wiki/TextFSM). A template declares the values
+// to extract, followed by the states of a state machine whose rules match the output line by line:
+//
+//	Value INTERFACE (\S+)
+//	Value STATUS (up|down|administratively down)
+//
+//	Start
+//	  ^${INTERFACE}\s+\S+\s+\S+\s+\S+\s+${STATUS} -> Record
+//
+// The value options Filldown, Fillup, Key, List and Required are supported, and so are the Next,
+// Continue, Record, NoRecord, Clear, Clearall and Error actions. Rules use Go's regexp syntax, which
+// lacks Python's lookarounds and backreferences; templates using them fail to parse.
+//
+// Templates for common commands of the built in platforms are embedded, see Lookup.
+package textfsm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// The value options
+const (
+	optFilldown = "Filldown"
+	optFillup   = "Fillup"
+	optKey      = "Key"
+	optList     = "List"
+	optRequired = "Required"
+)
+
+// The line and record operations of an action
+const (
+	lineNext = iota
+	lineContinue
+	lineError
+)
+
+const (
+	recordNone = iota
+	recordRecord
+	recordClear
+	recordClearAll
+)
+
+// The reserved states
+const (
+	stateStart = "Start"
+	stateEnd   = "End"
+	stateEOF   = "EOF"
+)
+
+// value is a Value line of a template
+type value struct {
+	name    string
+	regex   string
+	options map[string]bool
+}
+
+// rule is a line of a state, matching the output and acting on it
+type rule struct {
+	line     int // in the template
+	re       *regexp.Regexp
+	lineOp   int
+	recordOp int
+	state    string // the state to change to, if any
+	message  string // of an Error action
+}
+
+// Template is a parsed template. It can be used by several goroutines at once.
+type Template struct {
+	values []*value
+	index  map[string]int // of the values by name
+	states map[string][]rule
+}
+
+// Record is a match of the template: the values by name, with a string for each value, or a []string for
+// the List values.
+type Record map[string]interface{}
+
+// String returns the named value, or "" if it is missing or a list.
+func (r Record) String(name string) string {
+	s, _ := r[name].(string)
+	return s
+}
+
+// List returns the named List value.
+func (r Record) List(name string) []string {
+	l, _ := r[name].([]string)
+	return l
+}
+
+// SyntaxError is an error in a template.
+type SyntaxError struct {
+	Line int
+	Err  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("Invalid template, line %d: %s", e.Line, e.Err)
+}
+
+func syntaxError(line int, format string, args ...interface{}) error {
+	return &SyntaxError{Line: line, Err: fmt.Sprintf(format, args...)}
+}
+
+var (
+	stateName = regexp.MustCompile(`^\w+$`)
+	valueName = regexp.MustCompile(`^\w+$`)
+	ruleLine  = regexp.MustCompile(`^\s+\^`)
+	// the action follows the last " ->" of a rule
+	ruleAction = regexp.MustCompile(`^(.*)\s->(.*)$`)
+	// the operations of an action, ie Next.Record, Continue.Clear, Error or Record
+	actionOps = regexp.MustCompile(`^(?:(Next|Continue|Error)(?:\.(NoRecord|Record|Clearall|Clear))?|(NoRecord|Record|Clearall|Clear))$`)
+	// what follows the operations, the new state or the message of an Error
+	actionState = regexp.MustCompile(`^(\w+|".*")?$`)
+)
+
+// Parse reads a template.
+func Parse(r io.Reader) (*Template, error) {
+	t := &Template{index: make(map[string]int), states: make(map[string][]rule)}
+	scanner := bufio.NewScanner(r)
+	n := 0
+	inValues := true
+	var state string // the state whose rules are being read, if any
+	for scanner.Scan() {
+		n++
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		switch {
+		case inValues && strings.HasPrefix(line, "Value "):
+			if err := t.parseValue(n, line); err != nil {
+				return nil, err
+			}
+		case inValues && line == "":
+			if len(t.values) > 0 {
+				inValues = false
+			}
+		case inValues:
+			return nil, syntaxError(n, "expected a Value, or a blank line ending the values")
+		case line == "":
+			state = ""
+		case state == "" && stateName.MatchString(line):
+			if _, ok := t.states[line]; ok {
+				return nil, syntaxError(n, "the state %s is declared twice", line)
+			}
+			if line == stateEnd {
+				return nil, syntaxError(n, "the End state is reserved, and must be empty")
+			}
+			state = line
+			t.states[state] = nil
+		case state != "" && ruleLine.MatchString(line):
+			r, err := t.parseRule(n, strings.TrimSpace(line))
+			if err != nil {
+				return nil, err
+			}
+			t.states[state] = append(t.states[state], r)
+		case state != "":
+			return nil, syntaxError(n, "expected a rule starting with ^")
+		default:
+			return nil, syntaxError(n, "expected a state name")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Unable to read the template: %s", err)
+	}
+	if len(t.values) == 0 {
+		return nil, errors.New("Invalid template, it has no values.")
+	}
+	if _, ok := t.states[stateStart]; !ok {
+		return nil, errors.New("Invalid template, it has no Start state.")
+	}
+	for _, rules := range t.states {
+		for _, r := range rules {
+			if _, ok := t.states[r.state]; !ok && r.state != "" && r.state != stateEnd && r.state != stateEOF {
+				return nil, syntaxError(r.line, "the state %s is not declared", r.state)
+			}
+		}
+	}
+	return t, nil
+}
+
+// ParseString reads a template from a string.
+func ParseString(template string) (*Template, error) {
+	return Parse(strings.NewReader(template))
+}
+
+// MustParse is ParseString, but panics if the template is invalid.
+func MustParse(template string) *Template {
+	t, err := ParseString(template)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// parseValue reads a line like "Value Filldown,Required NAME (\S+)"
+func (t *Template) parseValue(n int, line string) error {
+	fields := strings.Split(line, " ")
+	if len(fields) < 3 {
+		return syntaxError(n, "expected \"Value [options] NAME (regex)\"")
+	}
+	v := &value{options: make(map[string]bool)}
+	if strings.HasPrefix(fields[2], "(") {
+		v.name, v.regex = fields[1], strings.Join(fields[2:], " ")
+	} else {
+		if len(fields) < 4 {
+			return syntaxError(n, "expected \"Value [options] NAME (regex)\"")
+		}
+		for _, option := range strings.Split(fields[1], ",") {
+			switch option {
+			case optFilldown, optFillup, optKey, optList, optRequired:
+				if v.options[option] {
+					return syntaxError(n, "the option %s is given twice", option)
+				}
+				v.options[option] = true
+			default:
+				return syntaxError(n, "unknown option %q", option)
+			}
+		}
+		v.name, v.regex = fields[2], strings.Join(fields[3:], " ")
+	}
+	if !valueName.MatchString(v.name) {
+		return syntaxError(n, "invalid value name %q", v.name)
+	}
+	if _, ok := t.index[v.name]; ok {
+		return syntaxError(n, "the value %s is declared twice", v.name)
+	}
+	if !strings.HasPrefix(v.regex, "(") || !strings.HasSuffix(v.regex, ")") {
+		return syntaxError(n, "the regex of %s must be enclosed in parentheses", v.name)
+	}
+	if _, err := regexp.Compile(v.regex); err != nil {
+		return syntaxError(n, "invalid regex for %s: %s", v.name, err)
+	}
+	t.index[v.name] = len(t.values)
+	t.values = append(t.values, v)
+	return nil
+}
+
+// parseRule reads a line like "^${NAME}\s+up -> Next.Record State"
+func (t *Template) parseRule(n int, line string) (rule, error) {
+	r := rule{line: n}
+	match := line
+	if m := ruleAction.FindStringSubmatch(line); m != nil {
+		match = strings.TrimSpace(m[1])
+		action := strings.TrimSpace(m[2])
+		// the operations come first, unless the action is only the new state
+		fields := strings.SplitN(action, " ", 2)
+		ops := actionOps.FindStringSubmatch(fields[0])
+		rest := action
+		if ops != nil {
+			rest = ""
+			if len(fields) > 1 {
+				rest = strings.TrimSpace(fields[1])
+			}
+		} else {
+			ops = make([]string, 4)
+		}
+		if !actionState.MatchString(rest) {
+			return r, syntaxError(n, "invalid action %q", action)
+		}
+		switch ops[1] {
+		case "Continue":
+			r.lineOp = lineContinue
+		case "Error":
+			r.lineOp = lineError
+		}
+		recordOp := ops[2]
+		if recordOp == "" {
+			recordOp = ops[3]
+		}
+		switch recordOp {
+		case "Record":
+			r.recordOp = recordRecord
+		case "Clear":
+			r.recordOp = recordClear
+		case "Clearall":
+			r.recordOp = recordClearAll
+		}
+		if r.lineOp == lineError {
+			r.message = strings.Trim(rest, `"`)
+		} else if strings.HasPrefix(rest, `"`) {
+			return r, syntaxError(n, "only the Error action takes a message")
+		} else {
+			r.state = rest
+		}
+		if r.lineOp == lineContinue && r.state != "" {
+			return r, syntaxError(n, "the Continue action can't change the state")
+		}
+	}
+	expanded, err := t.expand(n, match)
+	if err != nil {
+		return r, err
+	}
+	if r.re, err = regexp.Compile(expanded); err != nil {
+		return r, syntaxError(n, "invalid regex: %s", err)
+	}
+	return r, nil
+}
+
+// expand replaces the ${NAME} and $NAME of the values with their named regexes, and $$ with $
+func (t *Template) expand(n int, match string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(match); i++ {
+		if match[i] != '$' {
+			b.WriteByte(match[i])
+			continue
+		}
+		rest := match[i+1:]
+		var name string
+		switch {
+		case strings.HasPrefix(rest, "$"):
+			b.WriteByte('$')
+			i++
+			continue
+		case strings.HasPrefix(rest, "{"):
+			end := strings.IndexByte(rest, '}')
+			if end < 0 {
+				return "", syntaxError(n, "unclosed ${")
+			}
+			name = rest[1:end]
+			i += end + 1
+		default:
+			name = identifier(rest)
+			if name == "" {
+				return "", syntaxError(n, "a lone $, use $$ to match the end of the line")
+			}
+			i += len(name)
+		}
+		index, ok := t.index[name]
+		if !ok {
+			return "", syntaxError(n, "the value %s is not declared", name)
+		}
+		v := t.values[index]
+		b.WriteString("(?P<" + v.name + ">" + v.regex[1:])
+	}
+	return b.String(), nil
+}
+
+// identifier returns the leading word characters of s
+func identifier(s string) string {
+	for i, c := range s {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// Header returns the names of the values, in the order they are declared.
+func (t *Template) Header() []string {
+	names := make([]string, len(t.values))
+	for i, v := range t.values {
+		names[i] = v.name
+	}
+	return names
+}
+
+// Keys returns the names of the values with the Key option, which identify a record.
+func (t *Template) Keys() []string {
+	var keys []string
+	for _, v := range t.values {
+		if v.options[optKey] {
+			keys = append(keys, v.name)
+		}
+	}
+	return keys
+}
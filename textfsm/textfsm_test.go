@@ -0,0 +1,186 @@
+package textfsm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		template string
+		err      string
+	}{
+		{"Start\n  ^foo\n", "Invalid template, line 1: expected a Value, or a blank line ending the values"},
+		{"Value A (x)\n\nOther\n  ^x\n", "Invalid template, it has no Start state."},
+		{"Value A x\n\nStart\n  ^x\n", "Invalid template, line 1: expected \"Value [options] NAME (regex)\""},
+		{"Value Bogus A (x)\n\nStart\n  ^x\n", "Invalid template, line 1: unknown option \"Bogus\""},
+		{"Value A (x)\nValue A (y)\n\nStart\n", "Invalid template, line 2: the value A is declared twice"},
+		{"Value A (x\n\nStart\n", "Invalid template, line 1: the regex of A must be enclosed in parentheses"},
+		{"Value A (x)\n\nStart\n  ^${B}\n", "Invalid template, line 4: the value B is not declared"},
+		{"Value A (x)\n\nStart\n  ^x$\n", "Invalid template, line 4: a lone $, use $$ to match the end of the line"},
+		{"Value A (x)\n\nStart\n  ^x -> Missing\n", "Invalid template, line 4: the state Missing is not declared"},
+		{"Value A (x)\n\nStart\n  ^x -> Continue Other\n\nOther\n", "Invalid template, line 4: the Continue action can't change the state"},
+		{"Value A (x)\n\nStart\n  ^x -> Jump.Record\n", "Invalid template, line 4: invalid action \"Jump.Record\""},
+		{"Value A (x)\n\nStart\n  ^(?=x)\n", "Invalid template, line 4: invalid regex: error parsing regexp: invalid or unsupported Perl syntax: `(?=`"},
+		{"Value A (x)\n\nStart\n  foo\n", "Invalid template, line 4: expected a rule starting with ^"},
+	}
+	for _, test := range tests {
+		_, err := ParseString(test.template)
+		assert.EqualError(t, err, test.err, test.template)
+	}
+}
+
+func TestParseText_Options(t *testing.T) {
+	template := MustParse(`# a routing table, with the interfaces of each route
+Value Filldown VRF (\S+)
+Value Required PREFIX (\S+)
+Value List NEXTHOP (\S+)
+Value Fillup PROTOCOL (\w+)
+
+Start
+  ^VRF ${VRF}
+  ^${PREFIX}\s+via\s+${NEXTHOP} -> Continue
+  ^\S+\s+via\s+\S+\s+${PROTOCOL}
+  ^\s+via\s+${NEXTHOP}
+  ^\s*$$ -> Record
+  ^end -> End
+`)
+	records, err := template.ParseText("VRF red\n10.0.0.0/8 via 1.1.1.1\n  via 1.1.1.2\n\n" +
+		"VRF blue\n\n10.1.0.0/16 via 2.2.2.2\n\n192.168.0.0/24 via 3.3.3.3 static\n\nend\n10.9.9.0/24 via 9.9.9.9\n")
+	assert.NoError(t, err)
+	// the protocol fills up the routes before it, and the route after End is left out
+	assert.Equal(t, []Record{
+		{"VRF": "red", "PREFIX": "10.0.0.0/8", "NEXTHOP": []string{"1.1.1.1", "1.1.1.2"}, "PROTOCOL": "static"},
+		{"VRF": "blue", "PREFIX": "10.1.0.0/16", "NEXTHOP": []string{"2.2.2.2"}, "PROTOCOL": "static"},
+		{"VRF": "blue", "PREFIX": "192.168.0.0/24", "NEXTHOP": []string{"3.3.3.3"}, "PROTOCOL": "static"},
+	}, records)
+	assert.Equal(t, []string{"VRF", "PREFIX", "NEXTHOP", "PROTOCOL"}, template.Header())
+}
+
+func TestParseText_States(t *testing.T) {
+	template := MustParse(`Value Key NAME (\S+)
+Value VALUE (\d+)
+
+Start
+  ^Counters -> Counters
+  ^Error -> Error "unexpected error output"
+
+Counters
+  ^${NAME}:\s+${VALUE} -> Record
+  ^Reset -> Clearall
+  ^${NAME}: -> Next.Clear
+
+EOF
+`)
+	records, err := template.ParseText("ignored: 1\r\nCounters\r\nin: 10\r\nout: 20\r\nbad:\r\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []Record{{"NAME": "in", "VALUE": "10"}, {"NAME": "out", "VALUE": "20"}}, records)
+	assert.Equal(t, []string{"NAME"}, template.Keys())
+
+	// the empty EOF state stops the last record
+	records, err = template.ParseText("Counters\nin: 10\npartial: x")
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	_, err = template.ParseText("Error")
+	assert.EqualError(t, err, `The template rejected the output at "Error", rule line 6: unexpected error output`)
+
+	records, err = template.ParseText("nothing to see")
+	assert.NoError(t, err)
+	assert.Equal(t, []Record{}, records)
+}
+
+func TestLookup(t *testing.T) {
+	for _, command := range []string{"show ip interface brief", "sh ip int br", "show  ip   interface bri"} {
+		template, err := Lookup("cisco_ios", command)
+		assert.NoError(t, err, command)
+		if assert.NotNil(t, template) {
+			assert.Equal(t, []string{"INTERFACE", "IP_ADDRESS", "STATUS", "PROTOCOL"}, template.Header())
+		}
+	}
+	_, err := Lookup("cisco_ios", "show ip interface briefly")
+	assert.Equal(t, ErrNoTemplate, err)
+	_, err = Lookup("junos", "show ip interface brief")
+	assert.Equal(t, ErrNoTemplate, err)
+	_, err = Load("missing")
+	assert.Equal(t, ErrNoTemplate, err)
+	assert.Equal(t, "sh(o(w)?)? ver(s(i(o(n)?)?)?)?", abbreviations("sh[[ow]] ver[[sion]]"))
+}
+
+// TestTemplates parses the outputs of the simulated devices with the embedded templates
+func TestTemplates(t *testing.T) {
+	tests := []struct {
+		platform string
+		command  string
+		records  []Record
+	}{
+		{"cisco_ios", "show version", []Record{{
+			"VERSION": "15.2(7)E4", "ROMMON": "Bootstrap", "HOSTNAME": "access1",
+			"UPTIME": "12 weeks, 3 days, 4 hours, 22 minutes", "RELOAD_REASON": "power-on",
+			// a switch has its model and serial on both the processor and the "Model number" lines
+			"RUNNING_IMAGE": "flash:/c2960x-universalk9-mz.152-7.E4.bin",
+			"HARDWARE":      []string{"WS-C2960X-48FPD-L", "WS-C2960X-48FPD-L"},
+			"SERIAL":        []string{"FOC2045X1AB", "FOC2045X1AB"}, "CONFIG_REGISTER": "0xF", "MAC": []string{"00:11:22:33:44:55"},
+		}}},
+		{"cisco_ios", "show ip interface brief", []Record{
+			{"INTERFACE": "Vlan1", "IP_ADDRESS": "unassigned", "STATUS": "administratively down", "PROTOCOL": "down"},
+			{"INTERFACE": "Vlan10", "IP_ADDRESS": "10.0.10.2", "STATUS": "up", "PROTOCOL": "up"},
+			{"INTERFACE": "GigabitEthernet1/0/1", "IP_ADDRESS": "unassigned", "STATUS": "up", "PROTOCOL": "up"},
+			{"INTERFACE": "GigabitEthernet1/0/2", "IP_ADDRESS": "unassigned", "STATUS": "up", "PROTOCOL": "up"},
+			{"INTERFACE": "GigabitEthernet1/0/3", "IP_ADDRESS": "unassigned", "STATUS": "administratively down", "PROTOCOL": "down"},
+		}},
+		{"cisco_ios", "show interfaces", []Record{
+			{"INTERFACE": "Vlan10", "LINK_STATUS": "up", "PROTOCOL_STATUS": "up", "HARDWARE_TYPE": "EtherSVI",
+				"ADDRESS": "0011.2233.4455", "BIA": "0011.2233.4455", "DESCRIPTION": "Management", "IP_ADDRESS": "10.0.10.2/24",
+				"MTU": "1500", "BANDWIDTH": "1000000 Kbit", "DUPLEX": "", "SPEED": "", "INPUT_RATE": "2000",
+				"OUTPUT_RATE": "1000", "INPUT_ERRORS": "0", "OUTPUT_ERRORS": "0"},
+			{"INTERFACE": "GigabitEthernet1/0/1", "LINK_STATUS": "up", "PROTOCOL_STATUS": "up (connected)",
+				"HARDWARE_TYPE": "Gigabit Ethernet", "ADDRESS": "0011.2233.4481", "BIA": "0011.2233.4481",
+				"DESCRIPTION": "uplink to core1", "IP_ADDRESS": "", "MTU": "1500", "BANDWIDTH": "1000000 Kbit",
+				"DUPLEX": "Full", "SPEED": "1000Mb/s", "INPUT_RATE": "9120000", "OUTPUT_RATE": "12840000",
+				"INPUT_ERRORS": "12", "OUTPUT_ERRORS": "0"},
+			{"INTERFACE": "GigabitEthernet1/0/3", "LINK_STATUS": "administratively down", "PROTOCOL_STATUS": "down (disabled)",
+				"HARDWARE_TYPE": "Gigabit Ethernet", "ADDRESS": "0011.2233.4483", "BIA": "0011.2233.4483",
+				"DESCRIPTION": "", "IP_ADDRESS": "", "MTU": "1500", "BANDWIDTH": "10000 Kbit", "DUPLEX": "Auto",
+				"SPEED": "Auto-speed", "INPUT_RATE": "0", "OUTPUT_RATE": "0", "INPUT_ERRORS": "0", "OUTPUT_ERRORS": "0"},
+		}},
+		{"cisco_xr", "show version", []Record{{
+			"VERSION": "6.1.4", "HOSTNAME": "core1", "UPTIME": "1 year, 5 weeks, 2 days, 3 hours, 11 minutes",
+			"HARDWARE": "ASR9K Series", "MEMORY": "12582912K",
+		}}},
+		{"junos", "show version", []Record{{"HOSTNAME": "edge1", "MODEL": "mx204", "VERSION": "19.4R3-S2.2"}}},
+		{"foundry", "show version", []Record{{
+			"VERSION": "08.0.30hT311", "HARDWARE": "ICX6450-24", "SERIAL": "BZS3234K0AB",
+			"UPTIME": "7 day(s) 2 hour(s) 11 minute(s) 5 second(s)",
+		}}},
+		{"casa", "show version", []Record{{
+			"PRODUCT": "C10G CMTS", "HARDWARE_VERSION": "1.0", "VERSION": "7.2.1", "IMAGE": "/fdsk1/C10G-7.2.1.bin",
+			"SERIAL": "CASA10G0012345", "HOSTNAME": "cmts1", "UPTIME": "47 days 3 hours 12 minutes 9 seconds",
+		}}},
+		{"casa", "show ip interface brief", []Record{
+			{"INTERFACE": "gige 0/0", "IP_ADDRESS": "10.0.20.2/24", "STATUS": "up", "PROTOCOL": "up"},
+			{"INTERFACE": "gige 0/1", "IP_ADDRESS": "unassigned", "STATUS": "down", "PROTOCOL": "down"},
+			{"INTERFACE": "loopback 0", "IP_ADDRESS": "10.255.0.10/32", "STATUS": "up", "PROTOCOL": "up"},
+			{"INTERFACE": "ip-bundle 1", "IP_ADDRESS": "10.10.0.1/22", "STATUS": "up", "PROTOCOL": "up"},
+			{"INTERFACE": "docsis-mac 1", "IP_ADDRESS": "unassigned", "STATUS": "up", "PROTOCOL": "up"},
+		}},
+	}
+	for _, test := range tests {
+		output, err := os.ReadFile(filepath.Join("..", "gondisim", "fixtures", test.platform,
+			strings.Replace(test.command, " ", "_", -1)+".txt"))
+		if !assert.NoError(t, err) {
+			continue
+		}
+		template, err := Lookup(test.platform, test.command)
+		if !assert.NoError(t, err, "%s %s", test.platform, test.command) {
+			continue
+		}
+		records, err := template.ParseText(string(output))
+		assert.NoError(t, err)
+		assert.Equal(t, test.records, records, "%s %s", test.platform, test.command)
+	}
+}
@@ -0,0 +1,132 @@
+package transcript
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/morganhein/gondi/schema"
+)
+
+// platformer is implemented by the transport drivers
+type platformer interface {
+	Platform() schema.DeviceType
+}
+
+// subscriber is implemented by the transport drivers, which wait for each listener to take every
+// line, so that none are dropped however busy the device is
+type subscriber interface {
+	Subscribe(events chan schema.MessageEvent) (id int)
+	Unsubscribe(id int)
+}
+
+// ErrNotRecordable is returned for devices that don't publish their session to listeners, which
+// the transport drivers do.
+var ErrNotRecordable = errors.New("The device's session can't be recorded.")
+
+// Recorder writes every line a device sends and receives to a transcript. Start it before
+// connecting to capture the login as well. Passwords are never published by the drivers,
+// so they don't appear in transcripts.
+type Recorder struct {
+	device subscriber
+	w      *bufio.Writer
+	enc    *json.Encoder
+	closer io.Closer // the file opened by Create
+	events chan schema.MessageEvent
+	id     int
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+	err    error
+}
+
+// NewRecorder starts recording the device's session to w. The device is subscribed to directly,
+// and waits for the recorder to take each line.
+func NewRecorder(w io.Writer, device schema.Device) (*Recorder, error) {
+	s, ok := device.(subscriber)
+	if !ok {
+		return nil, ErrNotRecordable
+	}
+	r := &Recorder{
+		device: s,
+		w:      bufio.NewWriter(w),
+		events: make(chan schema.MessageEvent, 1024),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	r.enc = json.NewEncoder(r.w)
+	header := Header{Version: Version, Started: time.Now()}
+	if p, ok := device.(platformer); ok {
+		header.Platform = string(p.Platform())
+	}
+	if err := r.enc.Encode(header); err != nil {
+		return nil, fmt.Errorf("Unable to write the transcript header: %s", err)
+	}
+	r.id = s.Subscribe(r.events)
+	go r.run()
+	return r, nil
+}
+
+// Create starts recording the device's session to a new file at path.
+func Create(path string, device schema.Device) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create transcript: %s", err)
+	}
+	r, err := NewRecorder(f, device)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.closer = f
+	return r, nil
+}
+
+// run writes the lines until stopped, and then those already taken
+func (r *Recorder) run() {
+	defer close(r.done)
+	for {
+		select {
+		case e := <-r.events:
+			r.write(e)
+		case <-r.stop:
+			for {
+				select {
+				case e := <-r.events:
+					r.write(e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *Recorder) write(e schema.MessageEvent) {
+	if r.err == nil {
+		r.err = r.enc.Encode(Entry{Time: e.Time, Dir: direction(e.Dir), Line: e.Message})
+	}
+}
+
+// Close stops recording, and flushes the transcript. The first write error is returned.
+func (r *Recorder) Close() error {
+	r.once.Do(func() {
+		r.device.Unsubscribe(r.id)
+		close(r.stop)
+		<-r.done
+		if err := r.w.Flush(); err != nil && r.err == nil {
+			r.err = err
+		}
+		if r.closer != nil {
+			if err := r.closer.Close(); err != nil && r.err == nil {
+				r.err = err
+			}
+		}
+	})
+	return r.err
+}
@@ -0,0 +1,107 @@
+// Package transcript records device sessions to newline delimited JSON files, and reads them back
+// so a session can be replayed with transport.NewReplay.
+//
+// The first line of a transcript is a Header, and every following line is an Entry holding one
+// line sent to, or received from, the device.
+package transcript
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/morganhein/gondi/schema"
+)
+
+// Version is the transcript format written by the Recorder
+const Version = 1
+
+// The directions of an entry
+const (
+	In  = "in"  // written to the device
+	Out = "out" // read from the device's stdout
+	Err = "err" // read from the device's stderr
+)
+
+// Header is the first line of a transcript.
+type Header struct {
+	Version  int       `json:"version"`
+	Platform string    `json:"platform,omitempty"` // the driver the session was recorded with
+	Started  time.Time `json:"started"`
+}
+
+// Entry is a single line of a session. Lines written to the device keep their trailing carriage return.
+type Entry struct {
+	Time time.Time `json:"time"`
+	Dir  string    `json:"dir"`
+	Line string    `json:"line"`
+}
+
+// Transcript is a recorded session.
+type Transcript struct {
+	Header  Header
+	Entries []Entry
+}
+
+// direction returns the entry direction of an event type
+func direction(t schema.EventType) string {
+	switch t {
+	case schema.Stdin:
+		return In
+	case schema.Stderr:
+		return Err
+	default:
+		return Out
+	}
+}
+
+// Read parses a transcript.
+func Read(r io.Reader) (*Transcript, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	t := &Transcript{}
+	line := 0
+	for scanner.Scan() {
+		line++
+		if line == 1 {
+			if err := json.Unmarshal(scanner.Bytes(), &t.Header); err != nil {
+				return nil, fmt.Errorf("Unable to parse the transcript header: %s", err)
+			}
+			if t.Header.Version != Version {
+				return nil, fmt.Errorf("Unsupported transcript version %d.", t.Header.Version)
+			}
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("Unable to parse line %d of the transcript: %s", line, err)
+		}
+		switch e.Dir {
+		case In, Out, Err:
+		default:
+			return nil, fmt.Errorf("Line %d of the transcript has an unknown direction %q.", line, e.Dir)
+		}
+		t.Entries = append(t.Entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Unable to read the transcript: %s", err)
+	}
+	if line == 0 {
+		return nil, errors.New("The transcript is empty.")
+	}
+	return t, nil
+}
+
+// Load reads the transcript file at path.
+func Load(path string) (*Transcript, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open transcript: %s", err)
+	}
+	defer f.Close()
+	return Read(f)
+}
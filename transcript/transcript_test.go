@@ -0,0 +1,32 @@
+package transcript
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRead(t *testing.T) {
+	data := `{"version":1,"platform":"cisco_ios","started":"2021-06-01T10:00:00Z"}
+{"time":"2021-06-01T10:00:00.1Z","dir":"out","line":"access1>"}
+{"time":"2021-06-01T10:00:00.2Z","dir":"in","line":"show clock\r"}
+{"time":"2021-06-01T10:00:00.3Z","dir":"out","line":"10:00:00.300 UTC Tue Jun 1 2021"}
+`
+	tr, err := Read(strings.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, "cisco_ios", tr.Header.Platform)
+	assert.Len(t, tr.Entries, 3)
+	assert.Equal(t, Entry{Time: tr.Entries[1].Time, Dir: In, Line: "show clock\r"}, tr.Entries[1])
+}
+
+func TestRead_Errors(t *testing.T) {
+	_, err := Read(strings.NewReader(""))
+	assert.Error(t, err)
+
+	_, err = Read(strings.NewReader(`{"version":2}`))
+	assert.EqualError(t, err, "Unsupported transcript version 2.")
+
+	_, err = Read(strings.NewReader("{\"version\":1}\n{\"dir\":\"sideways\"}\n"))
+	assert.EqualError(t, err, `Line 2 of the transcript has an unknown direction "sideways".`)
+}
@@ -0,0 +1,140 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/morganhein/gondi/schema"
+)
+
+// probes are sent to detect the platform when the banner doesn't give it away
+var probes = []string{"show version"}
+
+var autodetectDefinition = Definition{
+	Name: string(Autodetect),
+	// the login prompts of all the built in drivers
+	LoginPrompt:  `.*?(?:[Ll]ogin(?: [Nn]ame)?|[Uu]sername):? *?$`,
+	Continuation: []string{`:\r$`, `:\x1B\[K$`, `^.*?--More--`, `^---\(more.*\)---`},
+	Timeout:      "30s",
+}
+
+type autodetect struct {
+	base
+}
+
+func (a *autodetect) Initialize() error {
+	return a.apply(a, autodetectDefinition)
+}
+
+func (a *autodetect) Connect(method schema.ConnectionMethod, options schema.ConnectOptions, args ...string) error {
+	return a.ConnectContext(context.Background(), method, options, args...)
+}
+
+// ConnectContext detects the platform again on every connection, since the address may now be another device
+func (a *autodetect) ConnectContext(ctx context.Context, method schema.ConnectionMethod, options schema.ConnectOptions,
+	args ...string) error {
+	if !a.Connected() {
+		if err := a.upgrade(autodetectDefinition); err != nil {
+			return err
+		}
+	}
+	return a.base.ConnectContext(ctx, method, options, args...)
+}
+
+// Detect works out the platform of the connected device from its banner and the output of the probe
+// commands, and upgrades the session to that driver's prompts, paging and timeout, sending its post
+// login commands. A device that matches no driver is left as a generic session.
+func (b *base) Detect(ctx context.Context) (schema.DeviceType, error) {
+	if err := b.turn(ctx, 0); err != nil {
+		return "", err
+	}
+	defer b.commands.release()
+	return b.detect(ctx)
+}
+
+func (b *base) detect(ctx context.Context) (schema.DeviceType, error) {
+	def, ok := identify(definitions(), b.banner)
+	for i := 0; !ok && i < len(probes); i++ {
+		result, err := b.writeExpectTimeout(ctx, probes[i], b.prompt, b.timeout)
+		if err != nil {
+			return "", fmt.Errorf("Unable to detect the platform, %q failed: %s", probes[i], err)
+		}
+		def, ok = identify(definitions(), result)
+	}
+	if !ok {
+		log.Warningf("Unable to detect the platform of %s, using the generic driver.", b.Options().Host)
+		def = genericDefinition
+	}
+	log.Debugf("Detected the %s platform.", def.Name)
+	if err := b.upgrade(def); err != nil {
+		return "", err
+	}
+	if err := b.postLogin(ctx); err != nil {
+		return "", err
+	}
+	return b.Platform(), nil
+}
+
+// upgrade switches the session to the definition without reconnecting. Ciphers and the terminal size
+// were already negotiated, so only take effect on the next connection.
+func (b *base) upgrade(def Definition) error {
+	def = def.withDefaults()
+	c, err := def.compile()
+	if err != nil {
+		return err
+	}
+	b.mut.Lock()
+	b.definition = def
+	b.compiled = c
+	b.mut.Unlock()
+	return nil
+}
+
+// definitions returns the definitions of the registered drivers, in the order of their names.
+func definitions() []Definition {
+	registry.mut.RLock()
+	defer registry.mut.RUnlock()
+	names := make([]string, 0, len(registry.definitions))
+	for name := range registry.definitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var defs []Definition
+	seen := map[string]bool{}
+	for _, name := range names {
+		def := registry.definitions[name]
+		if seen[def.Name] {
+			continue
+		}
+		seen[def.Name] = true
+		defs = append(defs, def)
+	}
+	return defs
+}
+
+// identify returns the definition matching the most of its detect patterns in the lines. Ties go
+// to the first definition, so a more specific platform needs more patterns than the one it refines.
+func identify(defs []Definition, lines []string) (Definition, bool) {
+	var found Definition
+	best := 0
+	for _, def := range defs {
+		c, err := def.compile()
+		if err != nil {
+			continue
+		}
+		matched := 0
+		for _, re := range c.detect {
+			for _, line := range lines {
+				if re.MatchString(line) {
+					matched++
+					break
+				}
+			}
+		}
+		if matched > best {
+			found, best = def, matched
+		}
+	}
+	return found, best > 0
+}
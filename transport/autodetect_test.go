@@ -0,0 +1,116 @@
+package transport_test
+
+import (
+	"testing"
+
+	"github.com/morganhein/gondi/gondisim"
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutodetect(t *testing.T) {
+	for _, platform := range gondisim.Platforms() {
+		for _, method := range []schema.ConnectionMethod{transport.Telnet, transport.SSH} {
+			p, err := gondisim.Lookup(platform)
+			assert.NoError(t, err)
+			sim := gondisim.New(p)
+			if method == transport.SSH {
+				err = sim.StartSSH()
+			} else {
+				err = sim.StartTelnet()
+			}
+			assert.NoError(t, err)
+
+			dev, err := transport.New(transport.Autodetect)
+			assert.NoError(t, err)
+			err = dev.Connect(method, schema.ConnectOptions{
+				Host:     sim.Host(),
+				Port:     sim.Port(),
+				Username: sim.Username,
+				Password: sim.Password,
+				HostKey:  schema.HostKeyPolicy{Mode: schema.HostKeyPinned, Fingerprint: sim.Fingerprint()},
+			})
+			if !assert.NoError(t, err, "%s over %v", platform, method) {
+				sim.Close()
+				continue
+			}
+			detected := dev.(interface{ Platform() schema.DeviceType }).Platform()
+			assert.Equal(t, schema.DeviceType(platform), detected, "%s over %v", platform, method)
+
+			// the session now uses the detected driver, including its post login commands
+			def := dev.(interface{ Definition() transport.Definition }).Definition()
+			assert.Equal(t, append([]string{"show version"}, def.PostLogin...), sim.Commands(), platform)
+			res, err := dev.WriteCapture("show version")
+			assert.NoError(t, err, platform)
+			assert.NotEmpty(t, res, platform)
+			dev.Disconnect()
+			sim.Close()
+		}
+	}
+}
+
+func TestAutodetect_Unknown(t *testing.T) {
+	p, err := gondisim.Lookup("cisco_ios")
+	assert.NoError(t, err)
+	p.Outputs = map[string]string{"show version": "Acme OS 1.0\n"}
+	sim := gondisim.New(p)
+	assert.NoError(t, sim.StartTelnet())
+	defer sim.Close()
+
+	dev, err := transport.New(transport.Autodetect)
+	assert.NoError(t, err)
+	err = dev.Connect(transport.Telnet, schema.ConnectOptions{
+		Host:     sim.Host(),
+		Port:     sim.Port(),
+		Username: sim.Username,
+		Password: sim.Password,
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, transport.Generic, dev.(interface{ Platform() schema.DeviceType }).Platform())
+		dev.Disconnect()
+	}
+}
+
+func TestAutodetect_ConcurrentReads(t *testing.T) {
+	p, err := gondisim.Lookup("cisco_ios")
+	assert.NoError(t, err)
+	sim := gondisim.New(p)
+	assert.NoError(t, sim.StartTelnet())
+	defer sim.Close()
+
+	dev, err := transport.New(transport.Autodetect)
+	assert.NoError(t, err)
+	reader := dev.(interface {
+		Platform() schema.DeviceType
+		transport.Prompter
+	})
+	// the platform and prompts are read while the session is upgraded to the detected driver
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for reader.Platform() != transport.Cisco {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			reader.Prompt()
+			reader.EnablePrompt()
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+	err = dev.Connect(transport.Telnet, schema.ConnectOptions{
+		Host:     sim.Host(),
+		Port:     sim.Port(),
+		Username: sim.Username,
+		Password: sim.Password,
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, transport.Cisco, reader.Platform())
+		dev.Disconnect()
+	}
+}
@@ -1,6 +1,7 @@
 package transport
 
 import (
+	"context"
 	"regexp"
 	"sync"
 	"testing"
@@ -23,7 +24,7 @@ func TestBase_expect(t *testing.T) {
 	wgClient.Add(1)
 
 	go func() {
-		res, err := c.expect(events, lr, time.Duration(10)*time.Second)
+		res, err := c.expect(context.Background(), events, lr, time.Duration(10)*time.Second)
 		assert.NoError(t, err)
 		assert.Equal(t, []string{"Login:"}, res)
 		wgClient.Done()
@@ -36,3 +37,22 @@ func TestBase_expect(t *testing.T) {
 	events <- e
 	wgClient.Wait()
 }
+
+func TestBase_expectCancel(t *testing.T) {
+	c := &base{}
+	err := c.Initialize()
+	assert.NoError(t, err)
+
+	events := make(chan schema.MessageEvent)
+	lr, _ := regexp.Compile(`^[Ll]ogin:? *?$`)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		time.Sleep(time.Duration(50) * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	_, err = c.expect(ctx, events, lr, time.Duration(10)*time.Second)
+	assert.Equal(t, context.Canceled, err)
+	assert.True(t, time.Since(start) < time.Duration(5)*time.Second)
+}
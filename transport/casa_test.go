@@ -1,328 +1,119 @@
 package transport_test
 
 import (
-	"fmt"
+	"context"
 	"net"
 	"regexp"
-	"sync"
 	"testing"
 	"time"
 
-	"github.com/morganhein/gondi"
+	"github.com/morganhein/gondi/gondisim"
 	"github.com/morganhein/gondi/schema"
 	"github.com/morganhein/gondi/transport"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestCasa_LoginTelnet(t *testing.T) {
-	// create TCP server
-	l, err := net.Listen("tcp", ":3000")
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer l.Close()
-
-	wgClient := &sync.WaitGroup{}
-	wgClient.Add(1)
-
-	g := gondi.NewG()
-	go func() {
-		dev, err := g.Connect(transport.Casa, "test-cmts", transport.Telnet, schema.ConnectOptions{
-			Host:           "127.0.0.1",
-			Port:           3000,
-			Username:       "test",
-			Password:       "password",
-			EnablePassword: "enable",
-		})
-		assert.NoError(t, err)
-		dev.Disconnect()
-		wgClient.Done()
-	}()
-
-	// listen for TCP connections
-	conn, err := l.Accept()
-	assert.NoError(t, err)
-	conn.Write([]byte("Login:\n"))
-	buf := make([]byte, 20)
-
-	i, err := conn.Read(buf)
-	assert.NoError(t, err)
-	assert.NotZero(t, i)
-	fmt.Println("Server: Login found: ", string(buf[:i]))
-	conn.Write([]byte("Password:\n"))
+	sim, dev := connect(t, transport.Casa, transport.Telnet)
+	dev.Disconnect()
 
-	i, err = conn.Read(buf)
-	assert.NoError(t, err)
-	assert.NotZero(t, i)
-	fmt.Println("Server: Password found: ", string(buf[:i]))
-
-	conn.Write([]byte("device > "))
-	defer conn.Close()
-	wgClient.Wait()
+	//expect the page-off command to turn off the more prompt
+	assert.Equal(t, []string{"page-off"}, sim.Commands())
 }
 
 func TestCasa_Write(t *testing.T) {
-	// create TCP server
-	l, err := net.Listen("tcp", ":3000")
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer l.Close()
-
-	wgClient := &sync.WaitGroup{}
-	wgClient.Add(1)
-
-	g := gondi.NewG()
-	go func() {
-		dev, err := g.Connect(transport.Casa, "test-cmts", transport.Telnet, schema.ConnectOptions{
-			Host:           "127.0.0.1",
-			Port:           3000,
-			Username:       "test",
-			Password:       "password",
-			EnablePassword: "enable",
-		})
-		assert.NoError(t, err)
-		dev.Write("Hello", true)
-		dev.Write("Goodbye", false)
-		dev.Disconnect()
-		wgClient.Done()
-	}()
-
-	// listen for TCP connections
-	conn, err := l.Accept()
-	assert.NoError(t, err)
-	conn.Write([]byte("Login:\n"))
-	buf := make([]byte, 20)
-
-	i, err := conn.Read(buf)
-	assert.NoError(t, err)
-	assert.NotZero(t, i)
-	fmt.Println("Server: Login found: ", string(buf[:i]))
-	conn.Write([]byte("Password:\n"))
-
-	i, err = conn.Read(buf)
-	assert.NoError(t, err)
-	if i != 0 {
-		fmt.Println("Server: Password found: ", string(buf[:i]))
-	}
-	conn.Write([]byte("device > "))
+	sim, dev := connect(t, transport.Casa, transport.Telnet)
 
-	//expect the page-off command to turn off the more prompt
-	i, err = conn.Read(buf)
+	_, err := dev.Write("Hello", true)
 	assert.NoError(t, err)
-	assert.Equal(t, "page-off\r", string(buf[:i]))
-
-	//expect the "Hello" with a carriage return
-	i, err = conn.Read(buf)
+	//"Goodbye" without a carriage return is completed by the next write
+	_, err = dev.Write("Goodbye", false)
 	assert.NoError(t, err)
-	assert.Equal(t, "Hello\r", string(buf[:i]))
-
-	//expect the "Goodbye" without a carriage return
-	i, err = conn.Read(buf)
+	_, err = dev.Write("exit", true)
 	assert.NoError(t, err)
-	assert.Equal(t, "Goodbyeexit\r", string(buf[:i]))
 
-	defer conn.Close()
-	wgClient.Wait()
+	assert.Eventually(t, func() bool {
+		return len(sim.Commands()) == 3
+	}, time.Duration(2)*time.Second, time.Duration(10)*time.Millisecond)
+	assert.Equal(t, []string{"page-off", "Hello", "Goodbyeexit"}, sim.Commands())
+	dev.Disconnect()
 }
 
 func TestCasa_WriteCapture(t *testing.T) {
-	// create TCP server
-	l, err := net.Listen("tcp", ":3000")
-	assert.NoError(t, err)
-	defer l.Close()
-
-	wgClient := &sync.WaitGroup{}
-	wgClient.Add(1)
-
-	g := gondi.NewG()
-	go func() {
-		dev, err := g.Connect(transport.Casa, "test-cmts", transport.Telnet, schema.ConnectOptions{
-			Host:           "127.0.0.1",
-			Port:           3000,
-			Username:       "test",
-			Password:       "password",
-			EnablePassword: "enable",
-		})
-		assert.NoError(t, err)
-		res, err := dev.WriteCapture("Goodbye")
-		assert.NoError(t, err)
-		assert.Equal(t, []string{"this", "is", "a", "set", "of", "commands", "device > "}, res)
-		dev.Disconnect()
-		wgClient.Done()
-	}()
-
-	// listen for TCP connections
-	conn, err := l.Accept()
-	assert.NoError(t, err)
-	conn.Write([]byte("Login:\n"))
-	buf := make([]byte, 20)
-
-	i, err := conn.Read(buf)
-	assert.NoError(t, err)
-	assert.NotZero(t, i)
-	fmt.Println("Server: Login found: ", string(buf[:i]))
-	conn.Write([]byte("Password:\n"))
-
-	i, err = conn.Read(buf)
-	assert.NoError(t, err)
-	assert.NotZero(t, i)
-	fmt.Println("Server: Password found: ", string(buf[:i]))
-	conn.Write([]byte("device > "))
+	_, dev := connect(t, transport.Casa, transport.Telnet, gondisim.WithOutputs(map[string]string{
+		"Goodbye": "this\nis\na\nset\nof\ncommands\n",
+	}))
 
-	//expect the page-off command to turn off the more prompt
-	i, err = conn.Read(buf)
+	res, err := dev.WriteCapture("Goodbye")
 	assert.NoError(t, err)
-	assert.Equal(t, "page-off\r", string(buf[:i]))
-
-	//expect the "Hello" with a carriage return
-	i, err = conn.Read(buf)
-	assert.NoError(t, err)
-	assert.Equal(t, "Goodbye\r", string(buf[:i]))
-
-	conn.Write([]byte("this\nis\na\nset\nof\ncommands\ndevice > "))
-
-	defer conn.Close()
-	wgClient.Wait()
+	assert.Equal(t, []string{"this", "is", "a", "set", "of", "commands", "cmts1> "}, res)
 }
 
 func TestCasa_WriteExpect(t *testing.T) {
-	// create TCP server
-	l, err := net.Listen("tcp", ":3000")
-	assert.NoError(t, err)
-	defer l.Close()
-
-	wgClient := &sync.WaitGroup{}
-	wgClient.Add(1)
-
-	g := gondi.NewG()
-	go func() {
-		dev, err := g.Connect(transport.Casa, "test-cmts", transport.Telnet, schema.ConnectOptions{
-			Host:           "127.0.0.1",
-			Port:           3000,
-			Username:       "test",
-			Password:       "password",
-			EnablePassword: "enable",
-		})
-		assert.NoError(t, err)
-		exp, err := regexp.Compile("^[Ss]tuff.*$")
-		assert.NoError(t, err)
-		res, err := dev.WriteExpect("Goodbye", exp)
-		assert.NoError(t, err)
-		assert.Equal(t, []string{"this", "is", "a", "Stuff and things"}, res)
-		dev.Disconnect()
-		wgClient.Done()
-	}()
+	_, dev := connect(t, transport.Casa, transport.Telnet, gondisim.WithOutputs(map[string]string{
+		"Goodbye": "this\nis\na\nStuff and things\nset\nof\ncommands\n",
+	}))
 
-	// listen for TCP connections
-	conn, err := l.Accept()
+	exp, err := regexp.Compile("^[Ss]tuff.*$")
 	assert.NoError(t, err)
-	conn.Write([]byte("Login:\n"))
-	buf := make([]byte, 20)
-
-	i, err := conn.Read(buf)
+	res, err := dev.WriteExpect("Goodbye", exp)
 	assert.NoError(t, err)
-	assert.NotZero(t, i)
-	fmt.Println("Server: Login found: ", string(buf[:i]))
-	conn.Write([]byte("Password:\n"))
+	assert.Equal(t, []string{"this", "is", "a", "Stuff and things"}, res)
+}
 
-	i, err = conn.Read(buf)
-	assert.NoError(t, err)
-	assert.NotZero(t, i)
-	fmt.Println("Server: password found: ", string(buf[:i]))
-	conn.Write([]byte("device > "))
+func TestCasa_WriteExpectTimeout(t *testing.T) {
+	delayed := false
+	handler := func(command string, term gondisim.Terminal) bool {
+		if command != "Goodbye" {
+			return false
+		}
+		if delayed {
+			term.Print("this\nis\na")
+			time.Sleep(time.Duration(1) * time.Second)
+		}
+		term.Print("Stuff and things\nset\nof\ncommands")
+		delayed = true
+		return true
+	}
+	_, dev := connect(t, transport.Casa, transport.Telnet, gondisim.WithHandler(handler))
 
-	//expect the page-off command to turn off the more prompt
-	i, err = conn.Read(buf)
+	exp, err := regexp.Compile("^[Ss]tuff.*$")
 	assert.NoError(t, err)
-	assert.Equal(t, "page-off\r", string(buf[:i]))
 
-	//expect the "Hello" with a carriage return
-	i, err = conn.Read(buf)
+	// Testing a success within the timeout
+	res, err := dev.WriteExpectTimeout("Goodbye", exp, time.Duration(10)*time.Second)
 	assert.NoError(t, err)
-	assert.Equal(t, "Goodbye\r", string(buf[:i]))
+	assert.Equal(t, []string{"Stuff and things"}, res)
 
-	conn.Write([]byte("this\nis\na\nStuff and things\nset\nof\ncommands\ndevice > "))
-
-	defer conn.Close()
-	wgClient.Wait()
+	// Testing a failure due to timeout
+	_, err = dev.WriteExpectTimeout("Goodbye", exp, time.Duration(100)*time.Millisecond)
+	assert.Error(t, err)
 }
 
-func TestCasa_WriteExpectTimeout(t *testing.T) {
-	// create TCP server
-	l, err := net.Listen("tcp", ":3000")
+func TestCasa_ConnectContextCancel(t *testing.T) {
+	// create a TCP server that never sends a login prompt
+	l, err := net.Listen("tcp", "127.0.0.1:0")
 	assert.NoError(t, err)
 	defer l.Close()
-
-	wgClient := &sync.WaitGroup{}
-	wgClient.Add(1)
-
-	g := gondi.NewG()
 	go func() {
-		dev, err := g.Connect(transport.Casa, "test-cmts", transport.Telnet, schema.ConnectOptions{
-			Host:           "127.0.0.1",
-			Port:           3000,
-			Username:       "test",
-			Password:       "password",
-			EnablePassword: "enable",
-		})
-		assert.NoError(t, err)
-
-		exp, err := regexp.Compile("^[Ss]tuff.*$")
-		assert.NoError(t, err)
-
-		// Testing a success within the timeout
-		res, err := dev.WriteExpectTimeout("Goodbye", exp, time.Duration(10)*time.Second)
-		assert.NoError(t, err)
-		assert.Equal(t, []string{"this", "is", "a", "Stuff and things"}, res)
-
-		// Testing a failure due to timeout
-		res, err = dev.WriteExpectTimeout("Goodbye", exp, time.Duration(100)*time.Millisecond)
-		assert.Error(t, err)
-		//assert.Equal(t, []string{"this", "is", "a"}, res)
-		dev.Disconnect()
-		wgClient.Done()
+		conn, err := l.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(time.Duration(5) * time.Second)
+		}
 	}()
 
-	// listen for TCP connections
-	conn, err := l.Accept()
-	assert.NoError(t, err)
-	defer conn.Close()
-
-	conn.Write([]byte("Login:\n"))
-	buf := make([]byte, 20)
-
-	i, err := conn.Read(buf)
-	assert.NoError(t, err)
-	assert.NotZero(t, i)
-	fmt.Println("Server: Login found: ", string(buf[:i]))
-
-	conn.Write([]byte("Password:\n"))
-
-	i, err = conn.Read(buf)
-	assert.NoError(t, err)
-	assert.NotZero(t, i)
-	fmt.Println("Server: password found: ", string(buf[:i]))
-	conn.Write([]byte("device > "))
-
-	//expect the page-off command to turn off the more prompt
-	i, err = conn.Read(buf)
-	assert.NoError(t, err)
-	assert.Equal(t, "page-off\r", string(buf[:i]))
-
-	//expect the "Goodbye" with a carriage return
-	i, err = conn.Read(buf)
-	assert.NoError(t, err)
-	assert.Equal(t, "Goodbye\r", string(buf[:i]))
-	conn.Write([]byte("this\nis\na\nStuff and things\nset\nof\ncommands\ndevice > "))
-
-	//expect the "Goodbye" with a carriage return
-	i, err = conn.Read(buf)
-	assert.NoError(t, err)
-	assert.Equal(t, "Goodbye\r", string(buf[:i]))
-	conn.Write([]byte("this\nis\na"))
-	time.Sleep(time.Duration(1) * time.Second)
-	conn.Write([]byte("Stuff and things\nset\nof\ncommands\ndevice > "))
-
-	wgClient.Wait()
+	dev, err := transport.New(transport.Casa)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(200)*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = dev.ConnectContext(ctx, transport.Telnet, schema.ConnectOptions{
+		Host:     "127.0.0.1",
+		Port:     l.Addr().(*net.TCPAddr).Port,
+		Username: "test",
+		Password: "password",
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < time.Duration(5)*time.Second)
 }
@@ -0,0 +1,148 @@
+package transport_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/morganhein/gondi/gondisim"
+	"github.com/morganhein/gondi/pubsub"
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+type provider struct {
+	keys  []string
+	creds schema.Credentials
+	err   error
+}
+
+func (p *provider) Credentials(ctx context.Context, key string) (schema.Credentials, error) {
+	p.keys = append(p.keys, key)
+	return p.creds, p.err
+}
+
+func TestCredentials_Redacted(t *testing.T) {
+	p, err := gondisim.Lookup("cisco_ios")
+	assert.NoError(t, err)
+	sim := gondisim.New(p)
+	sim.Password = "s3cret!"
+	// a device that echoes its arguments, as some do with mistyped commands
+	sim.Handler = func(command string, term gondisim.Terminal) bool {
+		if !strings.HasPrefix(command, "echo ") {
+			return false
+		}
+		term.Print(strings.TrimPrefix(command, "echo "))
+		return true
+	}
+	assert.NoError(t, sim.StartTelnet())
+	defer sim.Close()
+
+	events := make(chan schema.MessageEvent, 1024)
+	id := pubsub.Subscribe(events)
+	defer pubsub.Unsubscribe(id)
+	observed := make(chan schema.MessageEvent, 1024)
+
+	creds := &provider{creds: schema.Credentials{Password: "s3cret!"}}
+	dev, err := transport.New(transport.Cisco)
+	assert.NoError(t, err)
+	err = dev.Connect(transport.Telnet, schema.ConnectOptions{
+		Host:          sim.Host(),
+		Port:          sim.Port(),
+		Username:      sim.Username,
+		Password:      "stale",
+		Credentials:   creds,
+		CredentialKey: "sw1",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sw1"}, creds.keys)
+	observer := dev.(interface {
+		Subscribe(events chan schema.MessageEvent) (id int)
+		Unsubscribe(id int)
+	})
+	observerID := observer.Subscribe(observed)
+	// the output captured is what the device sent, only the observers have the secrets hidden
+	res, err := dev.WriteCapture("echo the password is s3cret!")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"the password is s3cret!", "access1>"}, res)
+	observer.Unsubscribe(observerID)
+	dev.Disconnect()
+
+	redacted := false
+	for len(observed) > 0 {
+		e := <-observed
+		assert.NotContains(t, e.Message, "s3cret!")
+		redacted = redacted || e.Message == "the password is ********"
+	}
+	assert.True(t, redacted)
+
+	for len(events) > 0 {
+		e := <-events
+		if e.Source == dev {
+			assert.NotContains(t, e.Message, "s3cret!")
+		}
+	}
+	options := dev.Options()
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		assert.NotContains(t, fmt.Sprintf(format, options), "s3cret!", format)
+	}
+}
+
+func TestCredentials_CaptureRaw(t *testing.T) {
+	p, err := gondisim.Lookup("cisco_ios")
+	assert.NoError(t, err)
+	sim := gondisim.New(p)
+	// the password is also a word of the output
+	sim.Password = "cisco"
+	assert.NoError(t, sim.StartTelnet())
+	defer sim.Close()
+
+	dev, err := transport.New(transport.Cisco)
+	assert.NoError(t, err)
+	err = dev.Connect(transport.Telnet, schema.ConnectOptions{
+		Host:     sim.Host(),
+		Port:     sim.Port(),
+		Username: sim.Username,
+		Password: sim.Password,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer dev.Disconnect()
+	res, err := dev.WriteCapture("show version")
+	assert.NoError(t, err)
+	assert.Contains(t, res, "cisco WS-C2960X-48FPD-L (APM86XXX) processor (revision D0) with 524288K bytes of memory.")
+}
+
+func TestCredentials_Errors(t *testing.T) {
+	sim, err := gondisim.NewTelnet("cisco_ios")
+	assert.NoError(t, err)
+	defer sim.Close()
+	options := schema.ConnectOptions{
+		Host:     sim.Host(),
+		Port:     sim.Port(),
+		Username: sim.Username,
+		Password: sim.Password,
+	}
+
+	// a provider without credentials for the device keeps the options' credentials
+	options.Credentials = &provider{err: schema.ErrNoCredentials}
+	dev, err := transport.New(transport.Cisco)
+	assert.NoError(t, err)
+	assert.NoError(t, dev.Connect(transport.Telnet, options))
+	dev.Disconnect()
+
+	failed := errors.New("The vault is sealed.")
+	creds := &provider{err: failed}
+	options.Credentials = creds
+	dev, err = transport.New(transport.Cisco)
+	assert.NoError(t, err)
+	err = dev.Connect(transport.Telnet, options)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "The vault is sealed.")
+	// the key defaults to the host
+	assert.Equal(t, []string{sim.Host()}, creds.keys)
+}
@@ -0,0 +1,209 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/morganhein/gondi/schema"
+	"gopkg.in/yaml.v3"
+)
+
+// Definition describes a driver as data: how to log in, how to recognise the prompts,
+// and what to send once a session is established. The built in drivers are definitions,
+// and more can be loaded at runtime from YAML or JSON files with LoadDriverFile.
+// Empty fields use the same defaults as the generic driver.
+type Definition struct {
+	Name           string   `yaml:"name" json:"name"`
+	Prompt         string   `yaml:"prompt" json:"prompt"`                   // matches the prompt that ends a command's output
+	EnablePrompt   string   `yaml:"enable_prompt" json:"enable_prompt"`     // matches the prompt while in privileged mode
+	ConfigPrompt   string   `yaml:"config_prompt" json:"config_prompt"`     // matches the prompt while in configuration mode
+	LoginPrompt    string   `yaml:"login_prompt" json:"login_prompt"`       // the telnet username prompt
+	PasswordPrompt string   `yaml:"password_prompt" json:"password_prompt"` // the telnet password prompt
+	Continuation   []string `yaml:"continuation" json:"continuation"`       // paging prompts answered with a space
+	PostLogin      []string `yaml:"post_login" json:"post_login"`           // commands sent after login, ie to disable paging
+	Timeout        string   `yaml:"timeout" json:"timeout"`                 // the default command timeout, ie "30s"
+	Ciphers        []string `yaml:"ciphers" json:"ciphers"`                 // SSH ciphers to offer, empty for the library defaults
+	TerminalWidth  int      `yaml:"terminal_width" json:"terminal_width"`
+	TerminalHeight int      `yaml:"terminal_height" json:"terminal_height"`
+	Detect         []string `yaml:"detect" json:"detect"` // match the banner or show version output to autodetect the platform
+}
+
+// Prompter is implemented by devices that know the prompts of their platform's modes.
+type Prompter interface {
+	Prompt() *regexp.Regexp
+	EnablePrompt() *regexp.Regexp
+	ConfigPrompt() *regexp.Regexp
+}
+
+// driverFile is the layout of a driver definitions file
+type driverFile struct {
+	Drivers []Definition `yaml:"drivers" json:"drivers"`
+}
+
+var genericDefinition = Definition{
+	Name:           string(Generic),
+	Prompt:         `> *$|# *$|\$ *$`,
+	EnablePrompt:   `# *$`,
+	ConfigPrompt:   `\(conf[^)]*\)# *$`,
+	LoginPrompt:    `.*?[Ll]ogin:? *?$`,
+	PasswordPrompt: `^.*?[Pp]assword:? *?$`,
+	Continuation:   []string{`:\r$`, `:\x1B\[K$`},
+	Timeout:        "30s",
+	TerminalWidth:  80,
+}
+
+// withDefaults returns a copy of the definition with the empty fields taken from the generic driver.
+func (d Definition) withDefaults() Definition {
+	g := genericDefinition
+	if d.Prompt == "" {
+		d.Prompt = g.Prompt
+	}
+	if d.EnablePrompt == "" {
+		d.EnablePrompt = g.EnablePrompt
+	}
+	if d.ConfigPrompt == "" {
+		d.ConfigPrompt = g.ConfigPrompt
+	}
+	if d.LoginPrompt == "" {
+		d.LoginPrompt = g.LoginPrompt
+	}
+	if d.PasswordPrompt == "" {
+		d.PasswordPrompt = g.PasswordPrompt
+	}
+	if d.Continuation == nil {
+		d.Continuation = g.Continuation
+	}
+	if d.Timeout == "" {
+		d.Timeout = g.Timeout
+	}
+	if d.TerminalWidth == 0 {
+		d.TerminalWidth = g.TerminalWidth
+	}
+	return d
+}
+
+// Validate checks that the definition has a name, that every pattern compiles and that the timeout parses.
+func (d Definition) Validate() error {
+	if strings.TrimSpace(d.Name) == "" {
+		return errors.New("A driver definition requires a name.")
+	}
+	_, err := d.compile()
+	return err
+}
+
+// compiled holds the parsed form of a definition, ready to be used by a device
+type compiled struct {
+	prompt         *regexp.Regexp
+	enablePrompt   *regexp.Regexp
+	configPrompt   *regexp.Regexp
+	loginPrompt    *regexp.Regexp
+	passwordPrompt *regexp.Regexp
+	continuation   []*regexp.Regexp
+	detect         []*regexp.Regexp
+	timeout        time.Duration
+}
+
+func (d Definition) compile() (c compiled, err error) {
+	d = d.withDefaults()
+	patterns := []struct {
+		field   string
+		pattern string
+		re      **regexp.Regexp
+	}{
+		{"prompt", d.Prompt, &c.prompt},
+		{"enable_prompt", d.EnablePrompt, &c.enablePrompt},
+		{"config_prompt", d.ConfigPrompt, &c.configPrompt},
+		{"login_prompt", d.LoginPrompt, &c.loginPrompt},
+		{"password_prompt", d.PasswordPrompt, &c.passwordPrompt},
+	}
+	for _, p := range patterns {
+		if *p.re, err = regexp.Compile(p.pattern); err != nil {
+			return c, fmt.Errorf("Driver %s has an invalid %s: %s", d.Name, p.field, err)
+		}
+	}
+	for _, next := range d.Continuation {
+		re, err := regexp.Compile(next)
+		if err != nil {
+			return c, fmt.Errorf("Driver %s has an invalid continuation: %s", d.Name, err)
+		}
+		c.continuation = append(c.continuation, re)
+	}
+	for _, next := range d.Detect {
+		re, err := regexp.Compile(next)
+		if err != nil {
+			return c, fmt.Errorf("Driver %s has an invalid detect pattern: %s", d.Name, err)
+		}
+		c.detect = append(c.detect, re)
+	}
+	if c.timeout, err = time.ParseDuration(d.Timeout); err != nil {
+		return c, fmt.Errorf("Driver %s has an invalid timeout: %s", d.Name, err)
+	}
+	return c, nil
+}
+
+// defined is a driver created from a definition at runtime
+type defined struct {
+	base
+	definition Definition
+}
+
+func (d *defined) Initialize() error {
+	return d.apply(d, d.definition)
+}
+
+// RegisterDefinition validates the definition and registers it as a driver under its name.
+func RegisterDefinition(def Definition) error {
+	if err := def.Validate(); err != nil {
+		return err
+	}
+	return register(def.Name, func() schema.Device {
+		return &defined{definition: def}
+	}, &def)
+}
+
+// LoadDefinitions reads driver definitions from a YAML or JSON file, chosen by the file extension.
+// The file holds a list of definitions under the "drivers" key.
+func LoadDefinitions(path string) ([]Definition, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read driver file: %s", err)
+	}
+	var file driverFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &file)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &file)
+	default:
+		return nil, fmt.Errorf("Unknown driver file format %q, expected .yaml, .yml or .json.", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse driver file %s: %s", path, err)
+	}
+	for i, def := range file.Drivers {
+		if err := def.Validate(); err != nil {
+			return nil, fmt.Errorf("Driver %d in %s: %s", i+1, path, err)
+		}
+	}
+	return file.Drivers, nil
+}
+
+// LoadDriverFile loads the definitions in the file and registers each of them.
+func LoadDriverFile(path string) error {
+	defs, err := LoadDefinitions(path)
+	if err != nil {
+		return err
+	}
+	for _, def := range defs {
+		if err := RegisterDefinition(def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package transport
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadDefinitions_YAML(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "drivers.yaml")
+	err := ioutil.WriteFile(file, []byte(`drivers:
+  - name: yaml_os
+    prompt: 'yaml[>#] *$'
+    enable_prompt: 'yaml# *$'
+    config_prompt: 'yaml\(config\)# *$'
+    post_login: [terminal length 0]
+    timeout: 15s
+`), 0600)
+	assert.NoError(t, err)
+
+	assert.NoError(t, LoadDriverFile(file))
+	d, err := New("yaml_os")
+	assert.NoError(t, err)
+	assert.IsType(t, &defined{}, d)
+
+	p := d.(Prompter)
+	assert.True(t, p.Prompt().MatchString("yaml> "))
+	assert.True(t, p.EnablePrompt().MatchString("yaml# "))
+	assert.True(t, p.ConfigPrompt().MatchString("yaml(config)# "))
+	assert.Equal(t, time.Duration(15)*time.Second, d.(*defined).timeout)
+	// empty fields use the generic defaults
+	assert.Equal(t, genericDefinition.LoginPrompt, d.(*defined).Definition().LoginPrompt)
+	assert.Equal(t, []string{"terminal length 0"}, d.(*defined).Definition().PostLogin)
+}
+
+func TestLoadDefinitions_JSON(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "drivers.json")
+	err := ioutil.WriteFile(file, []byte(`{"drivers": [{"name": "json_os", "login_prompt": "User:", "ciphers": ["aes128-ctr"]}]}`), 0600)
+	assert.NoError(t, err)
+
+	defs, err := LoadDefinitions(file)
+	assert.NoError(t, err)
+	assert.Len(t, defs, 1)
+	assert.Equal(t, "User:", defs[0].LoginPrompt)
+	assert.Equal(t, []string{"aes128-ctr"}, defs[0].Ciphers)
+}
+
+func TestLoadDefinitions_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.yaml")
+	assert.NoError(t, ioutil.WriteFile(bad, []byte("drivers:\n  - name: bad\n    prompt: '(unclosed'\n"), 0600))
+	_, err := LoadDefinitions(bad)
+	assert.Error(t, err)
+
+	unnamed := filepath.Join(dir, "unnamed.json")
+	assert.NoError(t, ioutil.WriteFile(unnamed, []byte(`{"drivers": [{"prompt": "> $"}]}`), 0600))
+	_, err = LoadDefinitions(unnamed)
+	assert.Error(t, err)
+
+	detect := filepath.Join(dir, "detect.yaml")
+	assert.NoError(t, ioutil.WriteFile(detect, []byte("drivers:\n  - name: bad\n    detect: ['[unclosed']\n"), 0600))
+	_, err = LoadDefinitions(detect)
+	assert.EqualError(t, err, "Driver 1 in "+detect+": Driver bad has an invalid detect pattern: "+
+		"error parsing regexp: missing closing ]: `[unclosed`")
+
+	_, err = LoadDefinitions(filepath.Join(dir, "drivers.toml"))
+	assert.Error(t, err)
+}
+
+func TestBuiltinDefinitions(t *testing.T) {
+	for _, def := range []Definition{genericDefinition, casaDefinition, ciscoiosDefinition, ciscoxrDefinition,
+		juniperDefinition, foundryDefinition} {
+		assert.NoError(t, def.Validate(), def.Name)
+	}
+}
@@ -1,97 +1,58 @@
 package transport
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"regexp"
-	"runtime"
 	"sync"
 	"time"
 
-	"github.com/morganhein/go-telnet"
 	"github.com/morganhein/gondi/logger"
 	"github.com/morganhein/gondi/pubsub"
 	"github.com/morganhein/gondi/schema"
 	"golang.org/x/crypto/ssh"
 )
 
+// The platforms with built in drivers
 const (
-	Cisco schema.DeviceType = iota
-	CiscoXE
-	CiscoXR
-	Casa
-	Juniper
-	Adva
-	Foundry
+	Generic schema.DeviceType = "generic"
+	Cisco   schema.DeviceType = "cisco_ios"
+	CiscoXE schema.DeviceType = "cisco_xe"
+	CiscoXR schema.DeviceType = "cisco_xr"
+	Casa    schema.DeviceType = "casa"
+	Juniper schema.DeviceType = "junos"
+	Foundry schema.DeviceType = "foundry"
+	// Autodetect logs in with a generic session, then detects the platform and upgrades the
+	// session to its driver in place.
+	Autodetect schema.DeviceType = "autodetect"
 )
 
 const (
 	SSH schema.ConnectionMethod = iota
 	Telnet
+	// Console is a telnet session through a console server, where the device only shows
+	// a prompt once return is pressed, and may already be logged in.
+	Console
 )
 
+// hidden is published in place of passwords
+const hidden = "********"
+
+// ErrNotConnected is returned by commands sent to a device that is not, or no longer, connected.
+var ErrNotConnected = errors.New("The device is not connected.")
+
+// ErrResizeUnsupported is returned when resizing the terminal of a session other than SSH.
+var ErrResizeUnsupported = errors.New("The terminal can only be resized over SSH.")
+
 var log schema.Logger
 
 func init() {
 	log = logger.Log
 }
 
-func New(deviceType schema.DeviceType) schema.Device {
-	log := logger.Log
-	switch deviceType {
-	case Cisco:
-		log.Debug("Creating a new Cisco device.")
-		d := &ciscoios{}
-		err := d.Initialize()
-		if err != nil {
-			return nil
-		}
-		return d
-	case CiscoXR:
-		log.Debug("Creating a new CiscoXR device.")
-		d := &ciscoxr{}
-		err := d.Initialize()
-		if err != nil {
-			return nil
-		}
-		return d
-	case Casa:
-		log.Debug("Creating a new Casa device.")
-		d := &casa{}
-		err := d.Initialize()
-		if err != nil {
-			return nil
-		}
-		return d
-	case Juniper:
-		log.Debug("Creating a new Juniper device.")
-		d := &juniper{}
-		err := d.Initialize()
-		if err != nil {
-			return nil
-		}
-		return d
-	case Foundry:
-		log.Debug("Creating a new Foundry device.")
-		d := &foundry{}
-		err := d.Initialize()
-		if err != nil {
-			return nil
-		}
-		return d
-	default:
-		log.Debug("Unknown device requested, making a base device.")
-		d := &base{}
-		err := d.Initialize()
-		if err != nil {
-			return nil
-		}
-		return d
-	}
-}
-
 type base struct {
 	ssh struct {
 		Config     *ssh.ClientConfig
@@ -101,75 +62,266 @@ type base struct {
 	telnet struct {
 		conn net.Conn
 	}
-	connOptions  schema.ConnectOptions
-	ready        bool //set to false when running a command
-	stdout       io.Reader
-	stdin        io.WriteCloser
-	stderr       io.Reader
-	shutdown     chan bool //shutdown channel for the publisher
-	continuation []*regexp.Regexp
-	prompt       *regexp.Regexp
-	events       chan schema.MessageEvent
-	publisher    *pubsub.Publisher
-	timeout      time.Duration  // The default timeout for this device
-	attachWg     sync.WaitGroup // The waitgroup for the publisher attachment
+	connOptions schema.ConnectOptions
+	mut         sync.Mutex    // guards connOptions, connected, closed, stdin, the ssh session and the definition
+	connected   bool          // set once logged in, until disconnected
+	closed      chan struct{} // closed on disconnect, to stop the running command
+	commands    queue         // serves commands one at a time, in order
+	stdout      io.Reader
+	stdin       io.WriteCloser
+	stderr      io.Reader
+	shutdown    chan bool //shutdown channel for the publisher
+	events      chan schema.MessageEvent
+	publisher   *pubsub.Publisher
+	attachWg    sync.WaitGroup // The waitgroup for the publisher attachment
+	definition  Definition     // The driver definition this device was initialized from
+	banner      []string       // The output before the first prompt, used to detect the platform
+	secrets     []string       // The secrets hidden in the published messages and logs
+	compiled                   // The compiled prompts of the definition
+}
 
+func (b *base) Initialize() error {
+	return b.apply(b, genericDefinition)
 }
 
-func (b base) Initialize() error {
-	b.events = make(chan schema.MessageEvent, 20)
-	b.publisher = pubsub.New(b, b.events)
-	b.prompt, _ = regexp.Compile(`> *$|# *$|\$ *$`)
-	for _, next := range []string{`:\r$`, `:\x1B\[K$`} {
-		if re, err := regexp.Compile(next); err == nil {
-			b.continuation = append(b.continuation, re)
-		}
+// apply initializes the device from a driver definition. The device is the outermost driver
+// type, which is the source of the events it publishes.
+func (b *base) apply(device schema.Device, def Definition) (err error) {
+	def = def.withDefaults()
+	if b.compiled, err = def.compile(); err != nil {
+		return err
 	}
-	b.ready = false
-	b.timeout = time.Duration(30) * time.Second
+	b.definition = def
+	b.events = make(chan schema.MessageEvent, 20)
+	b.publisher = pubsub.New(device, b.events)
 	return nil
 }
 
-func (b base) SupportedMethods() []schema.ConnectionMethod {
-	return []schema.ConnectionMethod{SSH, Telnet}
+// Definition returns the driver definition used by this device
+func (b *base) Definition() Definition {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return b.definition
 }
 
-func (b base) Connect(method schema.ConnectionMethod, options schema.ConnectOptions, args ...string) error {
-	if method == SSH {
-		options.Method = SSH
-		log.Debug("Casa: connecting via SSH.")
-		return b.connectSsh(options)
+// Platform returns the name of the driver definition used by this device
+func (b *base) Platform() schema.DeviceType {
+	return schema.DeviceType(b.Definition().Name)
+}
+
+// Prompt matches the prompt that ends a command's output
+func (b *base) Prompt() *regexp.Regexp {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return b.prompt
+}
+
+// EnablePrompt matches the prompt while in privileged mode
+func (b *base) EnablePrompt() *regexp.Regexp {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return b.enablePrompt
+}
+
+// ConfigPrompt matches the prompt while in configuration mode
+func (b *base) ConfigPrompt() *regexp.Regexp {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return b.configPrompt
+}
+
+func (b *base) SupportedMethods() []schema.ConnectionMethod {
+	return []schema.ConnectionMethod{SSH, Telnet, Console}
+}
+
+func (b *base) Connect(method schema.ConnectionMethod, options schema.ConnectOptions, args ...string) error {
+	return b.ConnectContext(context.Background(), method, options, args...)
+}
+
+func (b *base) ConnectContext(ctx context.Context, method schema.ConnectionMethod, options schema.ConnectOptions,
+	args ...string) (err error) {
+	if err := b.begin(); err != nil {
+		return err
+	}
+	if options, err = b.credentials(ctx, options); err != nil {
+		return b.finish(ctx, err)
 	}
-	if method == Telnet {
+	switch method {
+	case SSH:
+		options.Method = SSH
+		log.Debugf("%s: connecting via SSH.", b.definition.Name)
+		err = b.connectSsh(ctx, options)
+	case Telnet:
 		options.Method = Telnet
-		log.Debug("Casa: connecting via Telnet.")
-		return b.connectTelnet(options)
+		log.Debugf("%s: connecting via Telnet.", b.definition.Name)
+		err = b.connectTelnet(ctx, options)
+	case Console:
+		options.Method = Console
+		log.Debugf("%s: connecting via a console server.", b.definition.Name)
+		err = b.connectConsole(ctx, options)
+	default:
+		return errors.New("That connection type is currently not supported for this device.")
+	}
+	return b.finish(ctx, err)
+}
+
+// begin prepares a new connection, unless the device is already connected
+func (b *base) begin() error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	if b.connected {
+		return errors.New("The device is already connected.")
 	}
-	return errors.New("That connection type is currently not supported for this device.")
+	b.closed = make(chan struct{})
+	b.banner = nil
+	return nil
 }
 
-func (b base) connectSsh(options schema.ConnectOptions) error {
-	b.ssh.Config = CreateSSHConfig(options)
-	b.connOptions.Method = SSH
+// finish completes the connection once logged in, or cleans up after a failed login
+func (b *base) finish(ctx context.Context, err error) error {
+	if err == nil {
+		err = b.postLogin(ctx)
+	}
+	if err == nil && b.Platform() == Autodetect {
+		_, err = b.detect(ctx)
+	}
+	if err != nil {
+		b.teardown()
+		return err
+	}
+	b.mut.Lock()
+	b.connected = true
+	b.mut.Unlock()
+	return nil
+}
+
+func (b *base) setOptions(options schema.ConnectOptions) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	b.connOptions = options
+}
+
+// connectStream runs the session over already connected streams instead of dialing the host.
+// The method decides whether a telnet login is expected, or an SSH shell that is already authenticated.
+func (b *base) connectStream(ctx context.Context, method schema.ConnectionMethod, options schema.ConnectOptions,
+	stdin io.WriteCloser, stdout, stderr io.Reader) (err error) {
+	if err := b.begin(); err != nil {
+		return err
+	}
+	if options, err = b.credentials(ctx, options); err != nil {
+		return b.finish(ctx, err)
+	}
+	options.Method = method
+	b.setOptions(options)
+	b.mut.Lock()
+	b.stdin = stdin
+	b.mut.Unlock()
+	b.stdout = stdout
+	b.stderr = stderr
+	switch method {
+	case SSH:
+		err = b.startShell(ctx, nil)
+	case Telnet:
+		err = b.startTelnet(ctx, options)
+	case Console:
+		err = b.startConsole(ctx, options)
+	default:
+		err = errors.New("That connection type is currently not supported for this device.")
+	}
+	return b.finish(ctx, err)
+}
+
+// credentials looks up the credentials of the device with its provider, if it has one, and hides
+// the passwords in the messages published to observers and in the logs.
+func (b *base) credentials(ctx context.Context, options schema.ConnectOptions) (schema.ConnectOptions, error) {
+	if options.Credentials != nil {
+		key := options.CredentialKey
+		if key == "" {
+			key = options.Host
+		}
+		creds, err := options.Credentials.Credentials(ctx, key)
+		if err != nil && !errors.Is(err, schema.ErrNoCredentials) {
+			return options, fmt.Errorf("Unable to get the credentials of %s: %s", key, err)
+		}
+		if creds.Username != "" {
+			options.Username = creds.Username
+		}
+		if creds.Password != "" {
+			options.Password = creds.Password
+		}
+		if creds.EnablePassword != "" {
+			options.EnablePassword = creds.EnablePassword
+		}
+	}
+	var secrets []string
+	for _, secret := range []string{options.Password, options.EnablePassword} {
+		// a password that is also the username can't be hidden without hiding the username in prompts
+		if secret != options.Username {
+			secrets = append(secrets, secret)
+		}
+	}
+	b.mut.Lock()
+	b.secrets = secrets
+	b.mut.Unlock()
+	b.publisher.Redact(secrets...)
+	return options, nil
+}
+
+// Redact hides more secrets in the messages published to observers and in the logs, ie the password of a transfer
+// that is part of a command. They are hidden until the next connection.
+func (b *base) Redact(secrets ...string) {
+	b.mut.Lock()
+	b.secrets = append(b.secrets, secrets...)
+	all := append([]string(nil), b.secrets...)
+	b.mut.Unlock()
+	b.publisher.Redact(all...)
+}
+
+// postLogin sends the definition's post login commands, ie to disable paging
+func (b *base) postLogin(ctx context.Context) error {
+	for _, command := range b.definition.PostLogin {
+		log.Debug("Sending post login command: ", command)
+		// wait for the prompt, so the command's output isn't mistaken for the next command's
+		if _, err := b.writeExpectTimeout(ctx, command, b.prompt, b.timeout); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("Post login command %q failed: %s", command, err)
+		}
+	}
+	return nil
+}
+
+func (b *base) connectSsh(ctx context.Context, options schema.ConnectOptions) error {
+	config, err := CreateSSHConfig(options)
+	if err != nil {
+		return err
+	}
+	if len(b.definition.Ciphers) > 0 {
+		config.Ciphers = b.definition.Ciphers
+	}
+	b.ssh.Config = config
+	if options.Port == 0 {
+		options.Port = 22
+	}
 	host := fmt.Sprint(options.Host, ":", options.Port)
 	log.Debug("Dialing ", host)
-	conn, err := ssh.Dial("tcp", host, b.ssh.Config)
+	conn, err := dialSsh(ctx, host, b.ssh.Config)
 	if err != nil {
-		return fmt.Errorf("Failed to dial: %s", err)
+		return dialError(err)
 	}
 	b.ssh.connection = conn
 	b.ssh.session, err = b.ssh.connection.NewSession()
 	if err != nil {
 		return fmt.Errorf("Failed to create session: %s", err)
 	}
-	b.stdin, _ = b.ssh.session.StdinPipe()
+	stdin, _ := b.ssh.session.StdinPipe()
+	b.mut.Lock()
+	b.stdin = stdin
+	b.mut.Unlock()
 	b.stdout, _ = b.ssh.session.StdoutPipe()
 	b.stderr, _ = b.ssh.session.StderrPipe()
 
-	b.shutdown = make(chan bool, 1)
-	b.attachWg = sync.WaitGroup{}
-	go b.publisher.Attach(b.stdout, b.stderr, b.shutdown, b.attachWg)
-
 	modes := ssh.TerminalModes{
 		ssh.ECHO:          0,     // disable echoing
 		ssh.TTY_OP_ISPEED: 14400, // input speed = 14.4kbaud
@@ -177,162 +329,396 @@ func (b base) connectSsh(options schema.ConnectOptions) error {
 	}
 
 	// Request PTY
-	if err := b.ssh.session.RequestPty("xterm", 0, 80, modes); err != nil {
+	if err := b.ssh.session.RequestPty("xterm", b.definition.TerminalHeight, b.definition.TerminalWidth, modes); err != nil {
 		b.ssh.session.Close()
 		return fmt.Errorf("Request for pseudo terminal failed: %s", err)
 	}
 
-	// Start remote shell
-	if err := b.ssh.session.Shell(); err != nil {
-		return fmt.Errorf("Failed to start shell: %s", err)
+	b.setOptions(options)
+	if err := b.startShell(ctx, b.ssh.session.Shell); err != nil {
+		return err
 	}
-	b.connOptions = options
 	log.Info("SSH session created.")
-	b.ready = true
 	return nil
 }
 
-func (b base) connectTelnet(options schema.ConnectOptions) (err error) {
-	b.connOptions = options
-	if b.connOptions.Port == 0 {
-		b.connOptions.Port = 23
+// startShell attaches the publisher to the streams, starts the shell if needed, and waits for the first prompt.
+func (b *base) startShell(ctx context.Context, shell func() error) error {
+	b.attach(b.stderr)
+
+	// Subscribe before starting the shell, so the first prompt can't be missed
+	events := make(chan schema.MessageEvent, 20)
+	id := b.publisher.SubscribeRaw(events)
+	defer b.publisher.Unsubscribe(id)
+
+	if shell != nil {
+		// Start remote shell
+		if err := shell(); err != nil {
+			return fmt.Errorf("Failed to start shell: %s", err)
+		}
 	}
-	// connect to the host
-	host := fmt.Sprintf("%v:%v", b.connOptions.Host, options.Port)
+	banner, err := b.expect(ctx, events, b.prompt, time.Duration(20)*time.Second)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("Unable to detect the prompt after login: %s", err)
+	}
+	b.banner = banner
+	return nil
+}
 
+// attach starts publishing the output of the session
+func (b *base) attach(stderr io.Reader) {
 	b.shutdown = make(chan bool, 1)
-	b.attachWg = sync.WaitGroup{}
+	b.attachWg.Add(1)
+	go b.publisher.Attach(b.stdout, stderr, b.shutdown, &b.attachWg)
+}
 
-	b.telnet.conn, err = gote.Dial("tcp", host)
+func (b *base) connectTelnet(ctx context.Context, options schema.ConnectOptions) (err error) {
+	if options.Port == 0 {
+		options.Port = 23
+	}
+	b.setOptions(options)
+	// connect to the host
+	if err := b.dialTelnet(ctx, fmt.Sprintf("%v:%v", options.Host, options.Port)); err != nil {
+		return err
+	}
+	if err := b.startTelnet(ctx, options); err != nil {
+		return err
+	}
+	log.Info("Telnet session created.")
+	return nil
+}
+
+func (b *base) dialTelnet(ctx context.Context, host string) (err error) {
+	b.telnet.conn, err = dialTelnet(ctx, host)
 	if err != nil {
 		log.Info(err)
 		return err
 	}
-
 	log.Debug("TCP Connected, trying to login.")
-
 	b.stdout = b.telnet.conn
+	b.mut.Lock()
 	b.stdin = b.telnet.conn
+	b.mut.Unlock()
+	return nil
+}
 
-	go b.publisher.Attach(b.stdout, nil, b.shutdown, b.attachWg)
-
-	fmt.Println("Trying to authenticate.")
-	ready, err := b.loginTelnet(options.Username, options.Password)
-	if err != nil {
-		log.Warningf("Unable to login to telnet using username/password combination.")
+// connectConsole connects to the device's port on a console server, given as options.Console,
+// or Host and Port when it isn't set.
+func (b *base) connectConsole(ctx context.Context, options schema.ConnectOptions) error {
+	host := options.Console
+	if host == "" {
+		if options.Port == 0 {
+			options.Port = 23
+		}
+		host = fmt.Sprintf("%v:%v", options.Host, options.Port)
+	}
+	b.setOptions(options)
+	if err := b.dialTelnet(ctx, host); err != nil {
 		return err
 	}
+	if err := b.startConsole(ctx, options); err != nil {
+		return err
+	}
+	log.Info("Console session created.")
+	return nil
+}
 
-	if !ready {
-		log.Warning("Unable to login to telnet, device is not ready.")
-		return errors.New("Device not ready.")
+// startConsole attaches the publisher to the streams, wakes the console up and logs in if needed.
+func (b *base) startConsole(ctx context.Context, options schema.ConnectOptions) error {
+	events := make(chan schema.MessageEvent, 20)
+	id := b.publisher.SubscribeRaw(events)
+	defer b.publisher.Unsubscribe(id)
+	b.attach(nil)
+
+	// wake the console up, which shows either the login prompt or the prompt of a session left logged in
+	if _, err := b.write("", true, ""); err != nil {
+		return err
 	}
+	either := regexp.MustCompile("(?:" + b.loginPrompt.String() + ")|(?:" + b.prompt.String() + ")")
+	res, err := b.expect(ctx, events, either, time.Duration(20)*time.Second)
+	if err != nil {
+		return fmt.Errorf("No prompt on the console: %s", err)
+	}
+	b.banner = res
+	if b.match(res[len(res)-1], b.loginPrompt) {
+		return b.authenticate(ctx, events, options.Username, options.Password)
+	}
+	return nil
+}
 
-	log.Info("Telnet session created.")
-	b.ready = true
-	// need to login now
+// startTelnet attaches the publisher to the streams and logs in.
+func (b *base) startTelnet(ctx context.Context, options schema.ConnectOptions) error {
+	// Subscribe before attaching, so the login prompt can't be missed
+	events := make(chan schema.MessageEvent, 20)
+	id := b.publisher.SubscribeRaw(events)
+	defer b.publisher.Unsubscribe(id)
+	b.attach(nil)
+
+	log.Debug("Trying to authenticate.")
+	if err := b.loginTelnet(ctx, events, options.Username, options.Password); err != nil {
+		log.Warningf("Unable to login to telnet using username/password combination.")
+		return err
+	}
 	return nil
 }
 
-func (b base) loginTelnet(username, password string) (bool, error) {
+func (b *base) loginTelnet(ctx context.Context, events chan schema.MessageEvent, username, password string) error {
 	// detect "Login:" prompt
-	lr, err := regexp.Compile(`.*?[Ll]ogin:? *?$`)
-	if err != nil {
-		return false, err
-	}
-	_, err = b.writeExpectTimeout("", lr, time.Duration(20)*time.Second)
+	banner, err := b.expect(ctx, events, b.loginPrompt, time.Duration(20)*time.Second)
 	if err != nil {
-		return false, err
+		return err
 	}
+	b.banner = banner
+	return b.authenticate(ctx, events, username, password)
+}
+
+// authenticate answers the login prompt that was just shown
+func (b *base) authenticate(ctx context.Context, events chan schema.MessageEvent, username, password string) error {
+	timeout := time.Duration(20) * time.Second
 	// detect "Password:" prompt
-	pr, err := regexp.Compile(`^.*?[Pp]assword:? *?$`)
-	if err != nil {
-		return false, err
+	if _, err := b.write(username, true, username); err != nil {
+		return err
 	}
-	_, err = b.writeExpectTimeout(username, pr, time.Duration(20)*time.Second)
-	if err != nil {
-		return false, err
+	if _, err := b.expect(ctx, events, b.passwordPrompt, timeout); err != nil {
+		return err
 	}
 	//todo: handle Authentication failures
-	_, err = b.writeExpectTimeout(password, b.prompt, time.Duration(20)*time.Second)
-	if err != nil {
-		return false, err
+	if _, err := b.write(password, true, hidden); err != nil {
+		return err
 	}
-	return true, nil
+	_, err := b.expect(ctx, events, b.prompt, timeout)
+	return err
 }
 
-func (b base) Disconnect() bool {
-	if b.connOptions.Method == SSH {
-		b.ssh.session.Close()
+// Disconnect closes the session. A running command is stopped with ErrNotConnected, and so are the
+// commands waiting for their turn. It returns false if the device was not connected.
+func (b *base) Disconnect() bool {
+	b.mut.Lock()
+	if !b.connected {
+		b.mut.Unlock()
+		return false
 	}
+	b.connected = false
+	close(b.closed)
+	b.mut.Unlock()
 	//if b.connOptions.Method == Telnet {
 	//	// write "exit" to the stream?
 	//	b.stdin.Write([]byte("exit\r"))
 	//}
-	_ = b.stdin.Close()
-	b.shutdown <- true
-	b.attachWg.Wait()
+	b.teardown()
 	return true
 }
 
-func (b base) Expect(expectation *regexp.Regexp, timeout time.Duration) (result []string, err error) {
-	return b.WriteExpectTimeout("", expectation, timeout)
+// teardown closes the streams and stops the publisher. The streams are taken under b.mut, so a command
+// still writing, ie answering a page, finds them gone instead of using them as they are closed.
+func (b *base) teardown() {
+	b.mut.Lock()
+	session, connection, stdin := b.ssh.session, b.ssh.connection, b.stdin
+	b.ssh.session, b.ssh.connection, b.stdin = nil, nil, nil
+	b.mut.Unlock()
+	if session != nil {
+		session.Close()
+	}
+	if connection != nil {
+		connection.Close()
+	}
+	if stdin != nil {
+		_ = stdin.Close()
+	}
+	if b.shutdown != nil {
+		b.shutdown <- true
+		b.attachWg.Wait()
+		b.shutdown = nil
+	}
+}
+
+// Connected returns true while the device is logged in.
+func (b *base) Connected() bool {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return b.connected
+}
+
+// Subscribe adds a listener for the output of this device, with its secrets hidden. Unlike pubsub.Subscribe,
+// the device waits for the listener to take each message, so none are dropped; the listener must keep reading
+// until it unsubscribes.
+func (b *base) Subscribe(events chan schema.MessageEvent) (id int) {
+	return b.publisher.Subscribe(events)
+}
+
+// Unsubscribe removes a listener added with Subscribe.
+func (b *base) Unsubscribe(id int) {
+	b.publisher.Unsubscribe(id)
+}
+
+// Resize changes the size of the terminal on the device, in characters. Only SSH sessions can be
+// resized; the others return ErrResizeUnsupported.
+func (b *base) Resize(width, height int) error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	if !b.connected {
+		return ErrNotConnected
+	}
+	if b.ssh.session == nil {
+		return ErrResizeUnsupported
+	}
+	if err := b.ssh.session.WindowChange(height, width); err != nil {
+		return fmt.Errorf("Unable to resize the terminal: %s", err)
+	}
+	return nil
+}
+
+// turn waits until the device is free to run the caller's command, giving up with ErrQueueTimeout
+// after timeout, or with ctx.Err() once ctx is done. A zero timeout waits as long as ctx allows.
+// The caller must release the device with b.commands.release() once done.
+func (b *base) turn(ctx context.Context, timeout time.Duration) error {
+	if !b.Connected() {
+		return ErrNotConnected
+	}
+	wait := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		wait, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if err := b.commands.acquire(wait); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return ErrQueueTimeout
+	}
+	if !b.Connected() {
+		// disconnected while waiting
+		b.commands.release()
+		return ErrNotConnected
+	}
+	return nil
+}
+
+// Expect waits for the expectation without sending anything.
+func (b *base) Expect(expectation *regexp.Regexp, timeout time.Duration) (result []string, err error) {
+	if err := b.turn(context.Background(), timeout); err != nil {
+		return result, err
+	}
+	defer b.commands.release()
+	return b.listen(context.Background(), nil, expectation, timeout)
+}
+
+func (b *base) ExpectContext(ctx context.Context, expectation *regexp.Regexp) (result []string, err error) {
+	if err := b.turn(ctx, 0); err != nil {
+		return result, err
+	}
+	defer b.commands.release()
+	return b.listen(ctx, nil, expectation, b.timeout)
+}
+
+func (b *base) Write(command string, newline bool) (sent int, err error) {
+	if err := b.turn(context.Background(), b.timeout); err != nil {
+		return 0, err
+	}
+	defer b.commands.release()
+	return b.write(command, newline, command)
 }
 
-func (b base) Write(command string, newline bool) (sent int, err error) {
+// write sends the command, and publishes what was sent as a Stdin event. Secrets are published
+// as the logged text instead, so passwords don't end up in transcripts.
+func (b *base) write(command string, newline bool, logged string) (sent int, err error) {
 	if newline {
 		command += "\r"
+		logged += "\r"
+	}
+	b.mut.Lock()
+	stdin := b.stdin
+	b.mut.Unlock()
+	if stdin == nil {
+		return 0, ErrNotConnected
 	}
-	return b.stdin.Write([]byte(command))
+	if sent, err = stdin.Write([]byte(command)); err != nil {
+		return sent, err
+	}
+	b.publisher.Publish(logged, schema.Stdin)
+	return sent, nil
 }
 
-func (b base) WriteExpect(command string, expectation *regexp.Regexp) (result []string, err error) {
+// WriteExpect sends the command with a return, and waits for the expectation. An empty command sends a
+// bare return, which redisplays the prompt; Expect waits without sending anything.
+func (b *base) WriteExpect(command string, expectation *regexp.Regexp) (result []string, err error) {
 	return b.WriteExpectTimeout(command, expectation, b.timeout)
 }
 
-func (b base) WriteCapture(command string) (result []string, err error) {
+func (b *base) WriteCapture(command string) (result []string, err error) {
 	return b.WriteExpectTimeout(command, b.prompt, b.timeout)
 }
 
-func (b base) WriteExpectTimeout(command string, expectation *regexp.Regexp, timeout time.Duration) (result []string, err error) {
-	if !b.ready {
-		return result, errors.New("Device not ready to send another write command that requires capturing.")
+// WriteExpectTimeout waits up to timeout for the commands queued before it, then up to timeout
+// between lines of output for the expectation. Like WriteExpect, an empty command sends a bare return.
+func (b *base) WriteExpectTimeout(command string, expectation *regexp.Regexp, timeout time.Duration) (result []string, err error) {
+	if err := b.turn(context.Background(), timeout); err != nil {
+		return result, err
+	}
+	defer b.commands.release()
+	return b.writeExpectTimeout(context.Background(), command, expectation, timeout)
+}
+
+// WriteExpectContext waits for the commands queued before it for as long as ctx allows.
+func (b *base) WriteExpectContext(ctx context.Context, command string, expectation *regexp.Regexp) (result []string, err error) {
+	if err := b.turn(ctx, 0); err != nil {
+		return result, err
 	}
-	b.ready = false
-	return b.writeExpectTimeout(command, expectation, timeout)
+	defer b.commands.release()
+	return b.writeExpectTimeout(ctx, command, expectation, b.timeout)
+}
+
+func (b *base) writeExpectTimeout(ctx context.Context, command string, expectation *regexp.Regexp,
+	timeout time.Duration) (result []string, err error) {
+	return b.listen(ctx, &command, expectation, timeout)
 }
 
-func (b base) writeExpectTimeout(command string, expectation *regexp.Regexp,
+// listen subscribes to the output, sends the command if there is one, and waits for the expectation
+func (b *base) listen(ctx context.Context, command *string, expectation *regexp.Regexp,
 	timeout time.Duration) (result []string, err error) {
 	events := make(chan schema.MessageEvent, 20)
-	id := b.publisher.Subscribe(events)
+	id := b.publisher.SubscribeRaw(events)
 
 	defer func() {
-		b.ready = true
 		log.Debug("Defer unsubscribe being called.")
 		b.publisher.Unsubscribe(id)
 	}()
 
-	if len(command) > 0 {
+	if command != nil {
 		// write the command
-		log.Debug("Writing command: ", string(command))
-		_, err = b.Write(command, true)
+		log.Debug("Writing command: ", b.publisher.Redacted(*command))
+		_, err = b.write(*command, true, *command)
 		if err != nil {
 			// Unable to write command
 			return []string{}, err
 		}
 	}
 
-	return b.expect(events, expectation, timeout)
+	return b.expect(ctx, events, expectation, timeout)
 }
 
-func (b base) expect(events chan schema.MessageEvent, expectation *regexp.Regexp, timeout time.Duration) (result []string, err error) {
+// expect collects output until the expectation matches. It gives up when no output arrives
+// for the timeout duration, or as soon as ctx is cancelled.
+func (b *base) expect(ctx context.Context, events chan schema.MessageEvent, expectation *regexp.Regexp,
+	timeout time.Duration) (result []string, err error) {
 	// Create the timeout timer using this device types default
 	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	b.mut.Lock()
+	closed := b.closed
+	b.mut.Unlock()
 	for {
 		select {
 		case event := <-events:
 			//log.Debug("Received new event", event.Message)
+			if event.Dir == schema.Stdin {
+				// our own writes
+				continue
+			}
 			if event.Dir == schema.Stdout {
 				result = append(result, event.Message)
 				//log.Debug("Matching line ", event.Message)
@@ -342,33 +728,36 @@ func (b base) expect(events chan schema.MessageEvent, expectation *regexp.Regexp
 				}
 			}
 			if event.Dir == schema.Stderr {
-				log.Debug("Encountered an error:", event.Message)
+				log.Debug("Encountered an error:", b.publisher.Redacted(event.Message))
 				result = append(result, event.Message)
 			}
 			timer.Reset(timeout)
 			b.handleContinuation(event.Message)
 		case <-timer.C:
 			return result, errors.New("Command timeout reached without detecting expectation.")
-		default:
-			time.Sleep(time.Duration(20) * time.Millisecond)
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-closed:
+			return result, ErrNotConnected
 		}
 	}
 }
 
-func (b base) Options() schema.ConnectOptions {
-	runtime.Gosched()
+func (b *base) Options() schema.ConnectOptions {
+	b.mut.Lock()
+	defer b.mut.Unlock()
 	return b.connOptions
 }
 
-func (b base) match(line string, reg *regexp.Regexp) bool {
+func (b *base) match(line string, reg *regexp.Regexp) bool {
 	return reg.Find([]byte(line)) != nil
 }
 
-func (b base) handleContinuation(line string) {
+func (b *base) handleContinuation(line string) {
 	for _, con := range b.continuation {
 		if matched := con.Find([]byte(line)); matched != nil {
 			log.Debug("Found continuation request.", string(matched))
-			b.Write(" ", true)
+			b.write(" ", true, " ")
 		}
 	}
 }
@@ -1,24 +1,56 @@
 package transport
 
 import (
+	"errors"
 	"testing"
 
+	"github.com/morganhein/gondi/schema"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestNewDevice(t *testing.T) {
-	d := New(Cisco)
+	d, err := New(Cisco)
+	assert.NoError(t, err)
 	assert.IsType(t, &ciscoios{}, d)
 
-	d = New(CiscoXR)
+	d, err = New(CiscoXR)
+	assert.NoError(t, err)
 	assert.IsType(t, &ciscoxr{}, d)
 
-	d = New(Casa)
+	d, err = New(Casa)
+	assert.NoError(t, err)
 	assert.IsType(t, &casa{}, d)
 
-	d = New(Foundry)
+	d, err = New(Foundry)
+	assert.NoError(t, err)
 	assert.IsType(t, &foundry{}, d)
 
-	d = New(Juniper)
+	d, err = New(Juniper)
+	assert.NoError(t, err)
 	assert.IsType(t, &juniper{}, d)
+
+	d, err = New("JUNOS")
+	assert.NoError(t, err)
+	assert.IsType(t, &juniper{}, d)
+}
+
+func TestNewDevice_Unknown(t *testing.T) {
+	d, err := New("carrier_pigeon")
+	assert.Nil(t, d)
+	assert.True(t, errors.Is(err, ErrUnknownPlatform))
+	assert.Contains(t, err.Error(), "cisco_ios")
+}
+
+func TestRegisterDriver(t *testing.T) {
+	err := RegisterDriver("in_house", func() schema.Device { return &casa{} })
+	assert.NoError(t, err)
+	assert.Contains(t, Drivers(), "in_house")
+
+	d, err := New("in_house")
+	assert.NoError(t, err)
+	assert.IsType(t, &casa{}, d)
+
+	assert.Error(t, RegisterDriver("in_house", func() schema.Device { return &casa{} }))
+	assert.Error(t, RegisterDriver("Cisco_IOS", func() schema.Device { return &casa{} }))
+	assert.Error(t, RegisterDriver("nil_factory", nil))
 }
@@ -0,0 +1,126 @@
+package transport_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/morganhein/gondi/gondisim"
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+// fixtureLines returns the lines a driver should capture for a canned output, ending with the prompt.
+func fixtureLines(output, prompt string) []string {
+	output = strings.TrimRight(strings.Replace(output, "\r\n", "\n", -1), "\n")
+	return append(strings.Split(output, "\n"), prompt)
+}
+
+func TestDrivers_ShowVersion(t *testing.T) {
+	for _, platform := range gondisim.Platforms() {
+		for _, method := range []schema.ConnectionMethod{transport.Telnet, transport.SSH} {
+			p, err := gondisim.Lookup(platform)
+			assert.NoError(t, err)
+			sim := gondisim.New(p)
+			if method == transport.SSH {
+				err = sim.StartSSH()
+			} else {
+				err = sim.StartTelnet()
+			}
+			assert.NoError(t, err)
+
+			dev, err := transport.New(schema.DeviceType(platform))
+			assert.NoError(t, err, platform)
+			err = dev.Connect(method, schema.ConnectOptions{
+				Host:     sim.Host(),
+				Port:     sim.Port(),
+				Username: sim.Username,
+				Password: sim.Password,
+				HostKey:  schema.HostKeyPolicy{Mode: schema.HostKeyPinned, Fingerprint: sim.Fingerprint()},
+			})
+			if !assert.NoError(t, err, "%s over %v", platform, method) {
+				sim.Close()
+				continue
+			}
+			res, err := dev.WriteCapture("show version")
+			assert.NoError(t, err, platform)
+			prompt := p.Prompt
+			if p.StartEnabled {
+				prompt = p.EnablePrompt
+			}
+			assert.Equal(t, fixtureLines(p.Outputs["show version"], prompt), res, "%s over %v", platform, method)
+			dev.Disconnect()
+			sim.Close()
+		}
+	}
+}
+
+func TestDrivers_Paging(t *testing.T) {
+	p, err := gondisim.Lookup("cisco_ios")
+	assert.NoError(t, err)
+	// the driver's terminal length 0 is ignored, so the output is paged
+	p.PagingOff = nil
+	p.PageLength = 5
+	sim := gondisim.New(p)
+	assert.NoError(t, sim.StartTelnet())
+	defer sim.Close()
+
+	dev, err := transport.New(transport.Cisco)
+	assert.NoError(t, err)
+	assert.NoError(t, dev.Connect(transport.Telnet, schema.ConnectOptions{
+		Host:     sim.Host(),
+		Port:     sim.Port(),
+		Username: sim.Username,
+		Password: sim.Password,
+	}))
+	defer dev.Disconnect()
+
+	res, err := dev.WriteCapture("show version")
+	assert.NoError(t, err)
+	var lines []string
+	for _, line := range res {
+		// the pager prompt is overwritten by the next page
+		if line = strings.TrimSpace(line); line != "" && line != strings.TrimSpace(p.Pager) {
+			lines = append(lines, line)
+		}
+	}
+	var expected []string
+	for _, line := range fixtureLines(p.Outputs["show version"], p.Prompt) {
+		if line = strings.TrimSpace(line); line != "" {
+			expected = append(expected, line)
+		}
+	}
+	assert.Equal(t, expected, lines)
+}
+
+func TestDrivers_Console(t *testing.T) {
+	p, err := gondisim.Lookup("cisco_ios")
+	assert.NoError(t, err)
+	sim := gondisim.New(p)
+	assert.NoError(t, sim.StartConsole())
+	defer sim.Close()
+	options := schema.ConnectOptions{
+		Console:  sim.Host() + ":" + strconv.Itoa(sim.Port()),
+		Username: sim.Username,
+		Password: sim.Password,
+	}
+
+	// the first session logs in after waking the console up
+	dev, err := transport.New(transport.Cisco)
+	assert.NoError(t, err)
+	assert.NoError(t, dev.Connect(transport.Console, options))
+	assert.Equal(t, transport.Console, dev.Options().Method)
+	res, err := dev.WriteCapture("show version")
+	assert.NoError(t, err)
+	assert.Equal(t, fixtureLines(p.Outputs["show version"], p.Prompt), res)
+	dev.Disconnect()
+
+	// the console was left logged in, so the next session goes straight to the prompt
+	dev, err = transport.New(transport.Cisco)
+	assert.NoError(t, err)
+	assert.NoError(t, dev.Connect(transport.Console, options))
+	_, err = dev.WriteCapture("show version")
+	assert.NoError(t, err)
+	dev.Disconnect()
+}
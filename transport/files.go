@@ -0,0 +1,118 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/morganhein/gondi/schema"
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrFilesUnsupported is returned when copying files over a session other than SSH.
+var ErrFilesUnsupported = errors.New("Files can only be copied over SSH.")
+
+// progress counts the bytes of a copy for its callback
+type progress struct {
+	copied, total int64
+	callback      schema.Progress
+}
+
+func (p *progress) add(n int) {
+	p.copied += int64(n)
+	if p.callback != nil {
+		p.callback(p.copied, p.total)
+	}
+}
+
+// reader counts the bytes read from r
+func (p *progress) reader(r io.Reader) io.Reader {
+	return readerFunc(func(b []byte) (int, error) {
+		n, err := r.Read(b)
+		p.add(n)
+		return n, err
+	})
+}
+
+type readerFunc func(b []byte) (int, error)
+
+func (f readerFunc) Read(b []byte) (int, error) {
+	return f(b)
+}
+
+// client returns the SSH connection of the session, which the copies open their own sessions on
+func (b *base) client() (*ssh.Client, error) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	if !b.connected {
+		return nil, ErrNotConnected
+	}
+	if b.ssh.connection == nil {
+		return nil, ErrFilesUnsupported
+	}
+	return b.ssh.connection, nil
+}
+
+// Upload copies the local file to the remote path on the device over SFTP, or SCP if the device lacks SFTP.
+// The copy runs on its own SSH session, alongside the commands.
+func (b *base) Upload(local, remote string, callback schema.Progress) error {
+	client, err := b.client()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	p := &progress{total: info.Size(), callback: callback}
+	err = sftpUpload(client, f, remote, p)
+	if err == errNoSFTP {
+		log.Debugf("%s: SFTP is not supported, uploading with SCP.", b.definition.Name)
+		if _, err = f.Seek(0, io.SeekStart); err == nil {
+			p.copied = 0
+			err = scpUpload(client, f, info.Size(), info.Mode(), remote, p)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to upload %s: %s", local, err)
+	}
+	return nil
+}
+
+// Download copies the remote file on the device to the local path over SFTP, or SCP if the device lacks SFTP.
+// The local file is only replaced once the copy is complete.
+func (b *base) Download(remote, local string, callback schema.Progress) error {
+	client, err := b.client()
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(local), "."+filepath.Base(local)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	p := &progress{total: -1, callback: callback}
+	err = sftpDownload(client, f, remote, p)
+	if err == errNoSFTP {
+		log.Debugf("%s: SFTP is not supported, downloading with SCP.", b.definition.Name)
+		err = scpDownload(client, f, remote, p)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), local)
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to download %s: %s", remote, err)
+	}
+	return nil
+}
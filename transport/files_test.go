@@ -0,0 +1,82 @@
+package transport_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/morganhein/gondi/gondisim"
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+// image spans several SFTP requests, and ends part way through the last
+var image = bytes.Repeat([]byte("firmware"), 10000)
+
+func TestFiles(t *testing.T) {
+	for _, sftp := range []bool{true, false} {
+		sim, dev := connect(t, transport.Cisco, transport.SSH, gondisim.WithSFTP(sftp))
+		dir := t.TempDir()
+		local := filepath.Join(dir, "image.bin")
+		assert.NoError(t, ioutil.WriteFile(local, image, 0644))
+
+		var copied, total []int64
+		err := dev.Upload(local, "flash:/image.bin", func(n, size int64) {
+			copied = append(copied, n)
+			total = append(total, size)
+		})
+		assert.NoError(t, err, "sftp %v", sftp)
+		data, ok := sim.File("flash:/image.bin")
+		assert.True(t, ok)
+		assert.Equal(t, image, data)
+		if assert.NotEmpty(t, copied) {
+			assert.Equal(t, int64(len(image)), copied[len(copied)-1])
+			assert.Equal(t, int64(len(image)), total[0])
+		}
+
+		sim.SetFile("nvram:/startup-config", []byte("hostname access1\n"))
+		copied = nil
+		saved := filepath.Join(dir, "startup-config")
+		err = dev.Download("nvram:/startup-config", saved, func(n, size int64) {
+			copied = append(copied, n)
+			assert.Equal(t, int64(17), size)
+		})
+		assert.NoError(t, err, "sftp %v", sftp)
+		data, _ = ioutil.ReadFile(saved)
+		assert.Equal(t, "hostname access1\n", string(data))
+		assert.Equal(t, []int64{17}, copied)
+
+		// a failed download leaves nothing behind
+		err = dev.Download("nvram:/missing", filepath.Join(dir, "missing"), nil)
+		assert.Error(t, err)
+		files, _ := ioutil.ReadDir(dir)
+		assert.Len(t, files, 2)
+
+		// the session is still usable
+		_, err = dev.WriteCapture("show version")
+		assert.NoError(t, err)
+	}
+}
+
+func TestFiles_Telnet(t *testing.T) {
+	sim, err := gondisim.NewTelnet("cisco_ios")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer sim.Close()
+	dev, err := transport.New(transport.Cisco)
+	assert.NoError(t, err)
+	assert.Equal(t, transport.ErrNotConnected, dev.Upload("image.bin", "flash:/image.bin", nil))
+	err = dev.Connect(transport.Telnet, schema.ConnectOptions{
+		Host:     sim.Host(),
+		Port:     sim.Port(),
+		Username: sim.Username,
+		Password: sim.Password,
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, transport.ErrFilesUnsupported, dev.Download("flash:/image.bin", "image.bin", nil))
+		dev.Disconnect()
+	}
+}
@@ -0,0 +1,179 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/morganhein/gondi/schema"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// knownHostsMut serializes writes to known_hosts files from concurrent TOFU connections
+var knownHostsMut sync.Mutex
+
+// HostKeyError is returned from Connect when the device presents a host key
+// that is not trusted by the host key policy.
+type HostKeyError struct {
+	Host        string
+	Fingerprint string   // the SHA256 fingerprint of the key presented by the device
+	Expected    []string // the fingerprints that would have been accepted, empty if the host is unknown
+	Revoked     bool
+}
+
+func (e *HostKeyError) Error() string {
+	if e.Revoked {
+		return fmt.Sprintf("Host key %s presented by %s has been revoked.", e.Fingerprint, e.Host)
+	}
+	if len(e.Expected) == 0 {
+		return fmt.Sprintf("Host key %s presented by %s is not trusted, the host is unknown.", e.Fingerprint, e.Host)
+	}
+	return fmt.Sprintf("Host key mismatch for %s: presented %s, expected %s.", e.Host, e.Fingerprint,
+		strings.Join(e.Expected, ", "))
+}
+
+var hostKeyModes = map[string]schema.HostKeyMode{
+	"strict":   schema.HostKeyStrict,
+	"pinned":   schema.HostKeyPinned,
+	"tofu":     schema.HostKeyTOFU,
+	"insecure": schema.HostKeyInsecure,
+}
+
+// ParseHostKeyMode returns the host key mode with the name, ignoring case, ie "tofu".
+func ParseHostKeyMode(name string) (schema.HostKeyMode, error) {
+	if mode, ok := hostKeyModes[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return mode, nil
+	}
+	return 0, fmt.Errorf("Unknown host key mode %q, expected strict, pinned, tofu or insecure.", name)
+}
+
+// defaultKnownHosts returns the path to the current user's OpenSSH known_hosts file.
+func defaultKnownHosts() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("Unable to find the known_hosts file: %s", err)
+	}
+	return filepath.Join(home, ".ssh", "known_hosts"), nil
+}
+
+// hostKeyCallback builds the ssh.HostKeyCallback that enforces the given policy.
+func hostKeyCallback(policy schema.HostKeyPolicy) (ssh.HostKeyCallback, error) {
+	switch policy.Mode {
+	case schema.HostKeyInsecure:
+		log.Warning("Host key checking is disabled for this connection.")
+		return ssh.InsecureIgnoreHostKey(), nil
+	case schema.HostKeyPinned:
+		if policy.Fingerprint == "" {
+			return nil, errors.New("A pinned host key policy requires a fingerprint.")
+		}
+		return pinnedCallback(policy.Fingerprint), nil
+	case schema.HostKeyStrict, schema.HostKeyTOFU:
+		file := policy.KnownHosts
+		if file == "" {
+			var err error
+			if file, err = defaultKnownHosts(); err != nil {
+				return nil, err
+			}
+		}
+		if policy.Mode == schema.HostKeyTOFU {
+			if err := ensureFile(file); err != nil {
+				return nil, err
+			}
+		}
+		check, err := knownhosts.New(file)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to load known_hosts file %s: %s", file, err)
+		}
+		return knownHostsCallback(check, file, policy.Mode == schema.HostKeyTOFU), nil
+	}
+	return nil, fmt.Errorf("Unknown host key mode: %d", policy.Mode)
+}
+
+func pinnedCallback(fingerprint string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if matchFingerprint(fingerprint, key) {
+			return nil
+		}
+		return &HostKeyError{
+			Host:        hostname,
+			Fingerprint: ssh.FingerprintSHA256(key),
+			Expected:    []string{fingerprint},
+		}
+	}
+}
+
+// matchFingerprint compares the key against a SHA256 fingerprint, or the legacy MD5 hex form.
+func matchFingerprint(fingerprint string, key ssh.PublicKey) bool {
+	if strings.HasPrefix(fingerprint, "SHA256:") {
+		return fingerprint == ssh.FingerprintSHA256(key)
+	}
+	return strings.TrimPrefix(strings.ToLower(fingerprint), "md5:") == ssh.FingerprintLegacyMD5(key)
+}
+
+func knownHostsCallback(check ssh.HostKeyCallback, file string, tofu bool) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := check(hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) {
+			if len(keyErr.Want) == 0 && tofu {
+				log.Infof("Trusting host key %s for %s on first use.", ssh.FingerprintSHA256(key), hostname)
+				return appendKnownHost(file, hostname, key)
+			}
+			hkErr := &HostKeyError{Host: hostname, Fingerprint: ssh.FingerprintSHA256(key)}
+			for _, want := range keyErr.Want {
+				hkErr.Expected = append(hkErr.Expected, ssh.FingerprintSHA256(want.Key))
+			}
+			return hkErr
+		}
+		var revoked *knownhosts.RevokedError
+		if errors.As(err, &revoked) {
+			return &HostKeyError{Host: hostname, Fingerprint: ssh.FingerprintSHA256(key), Revoked: true}
+		}
+		return err
+	}
+}
+
+func ensureFile(file string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return fmt.Errorf("Unable to create the known_hosts directory: %s", err)
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("Unable to create the known_hosts file: %s", err)
+	}
+	return f.Close()
+}
+
+func appendKnownHost(file, hostname string, key ssh.PublicKey) error {
+	knownHostsMut.Lock()
+	defer knownHostsMut.Unlock()
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("Unable to store the host key: %s", err)
+	}
+	defer f.Close()
+	_, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+	return err
+}
+
+// dialError keeps host key failures typed, so callers can inspect them with errors.As.
+// Context errors are returned untouched.
+func dialError(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	var hkErr *HostKeyError
+	if errors.As(err, &hkErr) {
+		return hkErr
+	}
+	return fmt.Errorf("Failed to dial: %s", err)
+}
@@ -0,0 +1,86 @@
+package transport
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/morganhein/gondi/schema"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func newHostKey(t *testing.T) ssh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	key, err := ssh.NewPublicKey(pub)
+	assert.NoError(t, err)
+	return key
+}
+
+func TestHostKey_Pinned(t *testing.T) {
+	key := newHostKey(t)
+	other := newHostKey(t)
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 22}
+
+	cb, err := hostKeyCallback(schema.HostKeyPolicy{Mode: schema.HostKeyPinned, Fingerprint: ssh.FingerprintSHA256(key)})
+	assert.NoError(t, err)
+	assert.NoError(t, cb("router:22", addr, key))
+
+	err = cb("router:22", addr, other)
+	var hkErr *HostKeyError
+	assert.True(t, errors.As(err, &hkErr))
+	assert.Equal(t, ssh.FingerprintSHA256(other), hkErr.Fingerprint)
+	assert.Equal(t, []string{ssh.FingerprintSHA256(key)}, hkErr.Expected)
+
+	_, err = hostKeyCallback(schema.HostKeyPolicy{Mode: schema.HostKeyPinned})
+	assert.Error(t, err)
+}
+
+func TestHostKey_StrictAndTOFU(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	key := newHostKey(t)
+	other := newHostKey(t)
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 22}
+
+	// strict checking fails when the file does not exist
+	_, err := hostKeyCallback(schema.HostKeyPolicy{Mode: schema.HostKeyStrict, KnownHosts: file})
+	assert.Error(t, err)
+
+	// trust on first use stores the key
+	tofu, err := hostKeyCallback(schema.HostKeyPolicy{Mode: schema.HostKeyTOFU, KnownHosts: file})
+	assert.NoError(t, err)
+	assert.NoError(t, tofu("router:22", addr, key))
+
+	strict, err := hostKeyCallback(schema.HostKeyPolicy{Mode: schema.HostKeyStrict, KnownHosts: file})
+	assert.NoError(t, err)
+	assert.NoError(t, strict("router:22", addr, key))
+
+	// a changed key is a mismatch, even in TOFU mode
+	tofu, err = hostKeyCallback(schema.HostKeyPolicy{Mode: schema.HostKeyTOFU, KnownHosts: file})
+	assert.NoError(t, err)
+	err = tofu("router:22", addr, other)
+	var hkErr *HostKeyError
+	assert.True(t, errors.As(err, &hkErr))
+	assert.Equal(t, []string{ssh.FingerprintSHA256(key)}, hkErr.Expected)
+
+	// unknown hosts are rejected by strict checking
+	err = strict("switch:22", addr, other)
+	assert.True(t, errors.As(err, &hkErr))
+	assert.Empty(t, hkErr.Expected)
+}
+
+func TestParseHostKeyMode(t *testing.T) {
+	mode, err := ParseHostKeyMode("TOFU ")
+	assert.NoError(t, err)
+	assert.Equal(t, schema.HostKeyTOFU, mode)
+	mode, err = ParseHostKeyMode("pinned")
+	assert.NoError(t, err)
+	assert.Equal(t, schema.HostKeyPinned, mode)
+
+	_, err = ParseHostKeyMode("trusting")
+	assert.EqualError(t, err, `Unknown host key mode "trusting", expected strict, pinned, tofu or insecure.`)
+}
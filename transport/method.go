@@ -0,0 +1,40 @@
+package transport
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/morganhein/gondi/schema"
+)
+
+var methodNames = map[schema.ConnectionMethod]string{
+	SSH:     "ssh",
+	Telnet:  "telnet",
+	Console: "console",
+}
+
+// MethodName returns the name of a connection method, ie "ssh".
+func MethodName(method schema.ConnectionMethod) string {
+	if name, ok := methodNames[method]; ok {
+		return name
+	}
+	return fmt.Sprintf("method %d", int(method))
+}
+
+// ParseMethod returns the connection method with the name, ignoring case. The numbers of
+// the methods are accepted too, for older device files.
+func ParseMethod(name string) (schema.ConnectionMethod, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for method, next := range methodNames {
+		if next == name {
+			return method, nil
+		}
+	}
+	if n, err := strconv.Atoi(name); err == nil {
+		if _, ok := methodNames[schema.ConnectionMethod(n)]; ok {
+			return schema.ConnectionMethod(n), nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown connection method %q, expected ssh, telnet or console.", name)
+}
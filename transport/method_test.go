@@ -0,0 +1,24 @@
+package transport
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMethod(t *testing.T) {
+	for _, method := range []string{"ssh", "SSH", " ssh", "0"} {
+		m, err := ParseMethod(method)
+		assert.NoError(t, err, method)
+		assert.Equal(t, SSH, m, method)
+	}
+	m, err := ParseMethod("Console")
+	assert.NoError(t, err)
+	assert.Equal(t, Console, m)
+	assert.Equal(t, "telnet", MethodName(Telnet))
+
+	_, err = ParseMethod("pigeon")
+	assert.Error(t, err)
+	_, err = ParseMethod("9")
+	assert.Error(t, err)
+}
@@ -0,0 +1,56 @@
+package transport
+
+import (
+	"context"
+
+	"github.com/morganhein/gondi/textfsm"
+)
+
+// Parser is implemented by devices that can parse the output of their commands into records.
+type Parser interface {
+	WriteParse(command string, template *textfsm.Template) ([]textfsm.Record, error)
+	WriteParseContext(ctx context.Context, command string, template *textfsm.Template) ([]textfsm.Record, error)
+}
+
+// WriteParse sends the command, and parses its output up to the prompt with the template. A nil template
+// uses the embedded template for the platform's command, failing with textfsm.ErrNoTemplate if there is none.
+func (b *base) WriteParse(command string, template *textfsm.Template) ([]textfsm.Record, error) {
+	template, err := b.template(command, template)
+	if err != nil {
+		return nil, err
+	}
+	result, err := b.WriteCapture(command)
+	if err != nil {
+		return nil, err
+	}
+	return parse(result, template)
+}
+
+// WriteParseContext is WriteParse, but stops waiting as soon as ctx is cancelled, returning ctx.Err()
+func (b *base) WriteParseContext(ctx context.Context, command string, template *textfsm.Template) ([]textfsm.Record, error) {
+	template, err := b.template(command, template)
+	if err != nil {
+		return nil, err
+	}
+	result, err := b.WriteExpectContext(ctx, command, b.prompt)
+	if err != nil {
+		return nil, err
+	}
+	return parse(result, template)
+}
+
+// template returns the template given, or the embedded one for the command
+func (b *base) template(command string, template *textfsm.Template) (*textfsm.Template, error) {
+	if template != nil {
+		return template, nil
+	}
+	return textfsm.Lookup(string(b.Platform()), command)
+}
+
+// parse parses the captured lines, leaving out the prompt that ends them
+func parse(result []string, template *textfsm.Template) ([]textfsm.Record, error) {
+	if len(result) > 0 {
+		result = result[:len(result)-1]
+	}
+	return template.ParseLines(result)
+}
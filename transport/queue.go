@@ -0,0 +1,70 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrQueueTimeout is returned when a command's deadline passes while it waits for earlier commands to finish.
+var ErrQueueTimeout = errors.New("Timed out waiting for earlier commands on the device to finish.")
+
+// queue serializes the commands sent to a device. Callers are served in the order they arrived,
+// and a caller whose deadline passes while waiting leaves the queue without affecting the others.
+type queue struct {
+	mut     sync.Mutex
+	busy    bool
+	waiters []chan struct{}
+}
+
+// acquire waits for the caller's turn, or until ctx is done. The caller must release the queue
+// once its command has finished.
+func (q *queue) acquire(ctx context.Context) error {
+	q.mut.Lock()
+	if !q.busy {
+		q.busy = true
+		q.mut.Unlock()
+		return nil
+	}
+	turn := make(chan struct{})
+	q.waiters = append(q.waiters, turn)
+	q.mut.Unlock()
+
+	select {
+	case <-turn:
+		return nil
+	case <-ctx.Done():
+	}
+	q.mut.Lock()
+	for i, next := range q.waiters {
+		if next == turn {
+			q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+			q.mut.Unlock()
+			return ctx.Err()
+		}
+	}
+	q.mut.Unlock()
+	// the turn was handed over just as ctx finished, so pass it on
+	q.release()
+	return ctx.Err()
+}
+
+// release hands the device over to the next waiting caller.
+func (q *queue) release() {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	if len(q.waiters) == 0 {
+		q.busy = false
+		return
+	}
+	next := q.waiters[0]
+	q.waiters = q.waiters[1:]
+	close(next)
+}
+
+// waiting returns the number of callers waiting for their turn.
+func (q *queue) waiting() int {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	return len(q.waiters)
+}
@@ -0,0 +1,51 @@
+package transport
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue_Order(t *testing.T) {
+	q := &queue{}
+	assert.NoError(t, q.acquire(context.Background()))
+
+	var mut sync.Mutex
+	var served []int
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, q.acquire(context.Background()))
+			mut.Lock()
+			served = append(served, i)
+			mut.Unlock()
+			q.release()
+		}(i)
+		// wait for the caller to join the queue before starting the next one
+		for q.waiting() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	q.release()
+	wg.Wait()
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, served)
+}
+
+func TestQueue_Deadline(t *testing.T) {
+	q := &queue{}
+	assert.NoError(t, q.acquire(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(50)*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, q.acquire(ctx))
+	assert.Equal(t, 0, q.waiting())
+
+	// the caller that gave up doesn't hold up the ones behind it
+	q.release()
+	assert.NoError(t, q.acquire(context.Background()))
+}
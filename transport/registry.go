@@ -0,0 +1,103 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/morganhein/gondi/schema"
+)
+
+// ErrUnknownPlatform is wrapped by the error New returns when no driver is registered for a platform.
+var ErrUnknownPlatform = errors.New("Unknown platform")
+
+// Factory creates a new device for a platform. New calls Initialize on the result,
+// so the factory only needs to allocate it.
+type Factory func() schema.Device
+
+var registry = struct {
+	mut         sync.RWMutex
+	drivers     map[string]Factory
+	definitions map[string]Definition // the definitions of the drivers that have one, to detect them
+}{drivers: make(map[string]Factory), definitions: make(map[string]Definition)}
+
+func init() {
+	builtin := map[schema.DeviceType]struct {
+		factory    Factory
+		definition Definition
+	}{
+		Generic:    {func() schema.Device { return &base{} }, genericDefinition},
+		Autodetect: {func() schema.Device { return &autodetect{} }, autodetectDefinition},
+		Cisco:      {func() schema.Device { return &ciscoios{} }, ciscoiosDefinition},
+		CiscoXE:    {func() schema.Device { return &ciscoios{} }, ciscoiosDefinition},
+		CiscoXR:    {func() schema.Device { return &ciscoxr{} }, ciscoxrDefinition},
+		Casa:       {func() schema.Device { return &casa{} }, casaDefinition},
+		Juniper:    {func() schema.Device { return &juniper{} }, juniperDefinition},
+		Foundry:    {func() schema.Device { return &foundry{} }, foundryDefinition},
+	}
+	for name, driver := range builtin {
+		registry.drivers[string(name)] = driver.factory
+		registry.definitions[string(name)] = driver.definition.withDefaults()
+	}
+}
+
+// RegisterDriver makes a driver available under the platform name, so it can be created
+// with New. Names are case insensitive, and registering a name twice is an error. Drivers
+// registered with a factory aren't detected by the autodetect platform; use RegisterDefinition
+// for that.
+func RegisterDriver(name string, factory Factory) error {
+	return register(name, factory, nil)
+}
+
+// register adds the driver, and its definition if it has one
+func register(name string, factory Factory, def *Definition) error {
+	if factory == nil {
+		return errors.New("Unable to register a nil driver factory.")
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return errors.New("Unable to register a driver without a name.")
+	}
+	registry.mut.Lock()
+	defer registry.mut.Unlock()
+	if _, ok := registry.drivers[name]; ok {
+		return fmt.Errorf("A driver is already registered for the platform %q.", name)
+	}
+	registry.drivers[name] = factory
+	if def != nil {
+		registry.definitions[name] = def.withDefaults()
+	}
+	return nil
+}
+
+// Drivers returns the sorted names of all registered platforms.
+func Drivers() []string {
+	registry.mut.RLock()
+	defer registry.mut.RUnlock()
+	names := make([]string, 0, len(registry.drivers))
+	for name := range registry.drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates and initializes a device using the driver registered for the platform.
+func New(platform schema.DeviceType) (schema.Device, error) {
+	name := strings.ToLower(strings.TrimSpace(string(platform)))
+	registry.mut.RLock()
+	factory, ok := registry.drivers[name]
+	registry.mut.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w %q, the registered platforms are: %s", ErrUnknownPlatform, platform,
+			strings.Join(Drivers(), ", "))
+	}
+	log.Debugf("Creating a new %s device.", name)
+	d := factory()
+	if err := d.Initialize(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
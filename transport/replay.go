@@ -0,0 +1,178 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/transcript"
+)
+
+// streamer is implemented by every driver, since they all embed base
+type streamer interface {
+	connectStream(ctx context.Context, method schema.ConnectionMethod, options schema.ConnectOptions,
+		stdin io.WriteCloser, stdout, stderr io.Reader) error
+}
+
+// ReplayError reports where a replayed session stopped following its transcript.
+type ReplayError struct {
+	Entry    int    // the index of the transcript entry that was expected
+	Expected string // the recorded input, empty after the end of the transcript
+	Got      string // the input the driver sent instead
+}
+
+func (e *ReplayError) Error() string {
+	if e.Entry < 0 {
+		return fmt.Sprintf("Replay received %q after the end of the transcript.", e.Got)
+	}
+	return fmt.Sprintf("Replay expected %q at entry %d of the transcript, but received %q.", e.Expected, e.Entry+1,
+		e.Got)
+}
+
+// Replay is a device that answers from a recorded transcript instead of a network connection.
+// The platform's driver runs unchanged on top of it, so a session recorded on real hardware
+// can be reproduced deterministically: each recorded answer is only sent once the driver has
+// written the recorded input preceding it.
+type Replay struct {
+	schema.Device
+	transcript *transcript.Transcript
+	mut        sync.Mutex
+	err        error
+}
+
+// NewReplay loads the transcript at path, and creates a device that replays it using the platform's
+// driver. An empty platform uses the platform recorded in the transcript.
+func NewReplay(platform schema.DeviceType, path string) (*Replay, error) {
+	t, err := transcript.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewTranscriptReplay(platform, t)
+}
+
+// NewTranscriptReplay creates a device that replays an already loaded transcript.
+func NewTranscriptReplay(platform schema.DeviceType, t *transcript.Transcript) (*Replay, error) {
+	if platform == "" {
+		platform = schema.DeviceType(t.Header.Platform)
+	}
+	device, err := New(platform)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := device.(streamer); !ok {
+		return nil, fmt.Errorf("The %s driver does not support replays.", platform)
+	}
+	return &Replay{Device: device, transcript: t}, nil
+}
+
+func (r *Replay) Connect(method schema.ConnectionMethod, options schema.ConnectOptions, args ...string) error {
+	return r.ConnectContext(context.Background(), method, options, args...)
+}
+
+// ConnectContext starts the replay. The method must be the one the session was recorded with,
+// so the driver expects the same login sequence.
+func (r *Replay) ConnectContext(ctx context.Context, method schema.ConnectionMethod, options schema.ConnectOptions,
+	args ...string) error {
+	stdinReader, stdinWriter := io.Pipe()
+	stdoutReader, stdoutWriter := io.Pipe()
+	stderrReader, stderrWriter := io.Pipe()
+	go r.serve(stdinReader, stdoutWriter, stderrWriter)
+	err := r.Device.(streamer).connectStream(ctx, method, options, stdinWriter, stdoutReader, stderrReader)
+	if err != nil {
+		stdinWriter.Close()
+		if replayErr := r.Err(); replayErr != nil {
+			return replayErr
+		}
+	}
+	return err
+}
+
+// Err returns the first divergence from the transcript, or nil if the driver has followed it so far.
+func (r *Replay) Err() error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return r.err
+}
+
+func (r *Replay) fail(err error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if r.err == nil {
+		r.err = err
+		log.Warning(err)
+	}
+}
+
+// serve plays the device's side of the transcript
+func (r *Replay) serve(stdin io.ReadCloser, stdout, stderr *io.PipeWriter) {
+	defer stdin.Close()
+	entries := r.transcript.Entries
+	in := bufio.NewReader(stdin)
+	i := 0
+	// answer sends the recorded output up to the next recorded input
+	answer := func() error {
+		for ; i < len(entries) && entries[i].Dir != transcript.In; i++ {
+			w := stdout
+			if entries[i].Dir == transcript.Err {
+				w = stderr
+			}
+			if _, err := io.WriteString(w, entries[i].Line+"\n"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var err error
+	for err = answer(); err == nil && i < len(entries); err = answer() {
+		expected := entries[i].Line
+		var got string
+		if got, err = readInput(in, expected); err != nil {
+			break
+		}
+		if !sameInput(expected, got) {
+			err = &ReplayError{Entry: i, Expected: expected, Got: got}
+			break
+		}
+		i++
+	}
+	if err == nil {
+		// the transcript is exhausted, so anything else the driver sends wasn't recorded
+		var extra []byte
+		extra, err = in.ReadBytes('\r')
+		if len(extra) > 0 {
+			err = &ReplayError{Entry: -1, Got: string(extra)}
+		}
+	}
+	var replayErr *ReplayError
+	if errors.As(err, &replayErr) {
+		r.fail(err)
+	} else {
+		err = nil
+	}
+	stdout.CloseWithError(err)
+	stderr.CloseWithError(err)
+}
+
+// readInput reads what the driver wrote for the expected entry: a line ending with a carriage
+// return, or the same number of bytes for a write without one.
+func readInput(in *bufio.Reader, expected string) (string, error) {
+	if strings.HasSuffix(expected, "\r") {
+		return in.ReadString('\r')
+	}
+	buf := make([]byte, len(expected))
+	n, err := io.ReadFull(in, buf)
+	return string(buf[:n]), err
+}
+
+// sameInput compares the input with the recorded one. Passwords are recorded hidden, so any is accepted.
+func sameInput(expected, got string) bool {
+	if expected == hidden+"\r" {
+		return strings.HasSuffix(got, "\r")
+	}
+	return expected == got
+}
@@ -0,0 +1,144 @@
+package transport_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/morganhein/gondi/gondisim"
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/transcript"
+	"github.com/morganhein/gondi/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+// record captures a telnet session with a fake IOS switch, returning the transcript path and the captured output
+func record(t *testing.T, commands ...string) (string, [][]string) {
+	sim, err := gondisim.NewTelnet("cisco_ios")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+
+	dev, err := transport.New(transport.Cisco)
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "session.ndjson")
+	rec, err := transcript.Create(path, dev)
+	assert.NoError(t, err)
+
+	assert.NoError(t, dev.Connect(transport.Telnet, schema.ConnectOptions{
+		Host:     sim.Host(),
+		Port:     sim.Port(),
+		Username: sim.Username,
+		Password: sim.Password,
+	}))
+	var outputs [][]string
+	for _, command := range commands {
+		res, err := dev.WriteCapture(command)
+		assert.NoError(t, err)
+		outputs = append(outputs, res)
+	}
+	assert.NoError(t, rec.Close())
+	dev.Disconnect()
+	return path, outputs
+}
+
+func TestReplay(t *testing.T) {
+	path, outputs := record(t, "show version", "show ip interface brief")
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"line":"show version\r"`)
+	// the username and password are both "admin", but only the username is recorded
+	assert.Equal(t, 1, strings.Count(string(data), `"line":"admin\r"`))
+	assert.Contains(t, string(data), `"line":"********\r"`)
+
+	replay, err := transport.NewReplay("", path)
+	assert.NoError(t, err)
+	// any password is accepted, since it was never recorded
+	assert.NoError(t, replay.Connect(transport.Telnet, schema.ConnectOptions{Username: "admin", Password: "other"}))
+	defer replay.Disconnect()
+
+	res, err := replay.WriteCapture("show version")
+	assert.NoError(t, err)
+	assert.Equal(t, outputs[0], res)
+	res, err = replay.WriteCapture("show ip interface brief")
+	assert.NoError(t, err)
+	assert.Equal(t, outputs[1], res)
+	assert.NoError(t, replay.Err())
+}
+
+func TestReplay_Diverged(t *testing.T) {
+	path, _ := record(t, "show version")
+
+	replay, err := transport.NewReplay(transport.Cisco, path)
+	assert.NoError(t, err)
+	assert.NoError(t, replay.Connect(transport.Telnet, schema.ConnectOptions{Username: "admin"}))
+	defer replay.Disconnect()
+
+	_, err = replay.WriteExpectTimeout("show running-config", regexp.MustCompile("#$"), time.Duration(200)*time.Millisecond)
+	assert.Error(t, err)
+	var replayErr *transport.ReplayError
+	assert.True(t, errors.As(replay.Err(), &replayErr))
+	assert.Equal(t, "show version\r", replayErr.Expected)
+	assert.Equal(t, "show running-config\r", replayErr.Got)
+}
+
+func TestRecord_LongOutput(t *testing.T) {
+	p, err := gondisim.Lookup("cisco_ios")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for i := 0; i < 5000; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	p.Outputs["show tech-support"] = strings.Join(lines, "\n")
+	sim := gondisim.New(p)
+	if err := sim.StartTelnet(); err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Close()
+
+	dev, err := transport.New(transport.Cisco)
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "session.ndjson")
+	rec, err := transcript.Create(path, dev)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, dev.Connect(transport.Telnet, schema.ConnectOptions{
+		Host:     sim.Host(),
+		Port:     sim.Port(),
+		Username: sim.Username,
+		Password: sim.Password,
+	}))
+	_, err = dev.WriteCapture("show tech-support")
+	assert.NoError(t, err)
+	assert.NoError(t, rec.Close())
+	dev.Disconnect()
+
+	// none of the lines are dropped, though the reads may split some of them
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	tr, err := transcript.Read(strings.NewReader(string(data)))
+	if assert.NoError(t, err) {
+		var output strings.Builder
+		for _, e := range tr.Entries {
+			if e.Dir == transcript.Out {
+				output.WriteString(e.Line)
+			}
+		}
+		assert.Contains(t, output.String(), strings.Join(lines, ""))
+	}
+}
+
+func TestRecord_NotRecordable(t *testing.T) {
+	_, err := transcript.NewRecorder(ioutil.Discard, nil)
+	assert.Equal(t, transcript.ErrNotRecordable, err)
+}
@@ -0,0 +1,134 @@
+package transport
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// The source and sink of the scp protocol, run against "scp -t" and "scp -f" on the device, for the
+// devices that don't support SFTP.
+
+// scpAck waits for the device to accept the last step
+func scpAck(r *bufio.Reader) error {
+	b, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("Unable to read the SCP response: %s", err)
+	}
+	if b == 0 {
+		return nil
+	}
+	message, _ := r.ReadString('\n')
+	return fmt.Errorf("The device refused the transfer: %s", strings.TrimSpace(message))
+}
+
+// scpStart runs the scp command on a new session of the connection
+func scpStart(client *ssh.Client, command string) (*ssh.Session, io.WriteCloser, *bufio.Reader, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	in, _ := session.StdinPipe()
+	out, _ := session.StdoutPipe()
+	if err := session.Start(command); err != nil {
+		session.Close()
+		return nil, nil, nil, fmt.Errorf("Unable to start SCP: %s", err)
+	}
+	return session, in, bufio.NewReader(out), nil
+}
+
+// scpUpload sends size bytes read from r to the remote file, created with the mode
+func scpUpload(client *ssh.Client, r io.Reader, size int64, mode os.FileMode, remote string, p *progress) error {
+	session, in, out, err := scpStart(client, "scp -t "+shellQuote(remote))
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	if err := scpAck(out); err != nil {
+		return err
+	}
+	fmt.Fprintf(in, "C%04o %d %s\n", mode.Perm(), size, path.Base(remote))
+	if err := scpAck(out); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(in, p.reader(r), size); err != nil {
+		return err
+	}
+	in.Write([]byte{0})
+	if err := scpAck(out); err != nil {
+		return err
+	}
+	in.Close()
+	return session.Wait()
+}
+
+// scpDownload writes the remote file to w
+func scpDownload(client *ssh.Client, w io.Writer, remote string, p *progress) error {
+	session, in, out, err := scpStart(client, "scp -f "+shellQuote(remote))
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	in.Write([]byte{0})
+	var header string
+	for {
+		if header, err = out.ReadString('\n'); err != nil {
+			return fmt.Errorf("Unable to read the SCP response: %s", err)
+		}
+		switch header[0] {
+		case 'T':
+			// the times of the file, which aren't kept
+			in.Write([]byte{0})
+			continue
+		case 1, 2:
+			return fmt.Errorf("The device refused the transfer: %s", strings.TrimSpace(header[1:]))
+		case 'C':
+		default:
+			return fmt.Errorf("Unexpected SCP header %q.", strings.TrimSpace(header))
+		}
+		break
+	}
+	fields := strings.Fields(header)
+	if len(fields) != 3 {
+		return fmt.Errorf("Invalid SCP header %q.", strings.TrimSpace(header))
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || size < 0 {
+		return fmt.Errorf("Invalid SCP file size %q.", fields[1])
+	}
+	p.total = size
+	in.Write([]byte{0})
+	if _, err := io.CopyN(w, p.reader(out), size); err != nil {
+		return err
+	}
+	if err := scpAck(out); err != nil {
+		return err
+	}
+	in.Write([]byte{0})
+	in.Close()
+	if err := session.Wait(); err != nil {
+		var exit *ssh.ExitMissingError
+		// some devices close the session without an exit status once the file is sent
+		if !errors.As(err, &exit) {
+			return err
+		}
+	}
+	return nil
+}
+
+// shellQuote quotes the path for the shell of the device, if it needs quoting
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("/._-:+@%", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
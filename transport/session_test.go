@@ -0,0 +1,202 @@
+package transport_test
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/morganhein/gondi/gondisim"
+	"github.com/morganhein/gondi/schema"
+	"github.com/morganhein/gondi/textfsm"
+	"github.com/morganhein/gondi/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+// connect starts a fake device of the platform, and connects to it over the method. Both are closed when
+// the test ends.
+func connect(t *testing.T, platform schema.DeviceType, method schema.ConnectionMethod,
+	options ...gondisim.Option) (*gondisim.Server, schema.Device) {
+	start := gondisim.NewTelnet
+	if method == transport.SSH {
+		start = gondisim.NewSSH
+	}
+	sim, err := start(string(platform), options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sim.Close() })
+	connect := schema.ConnectOptions{
+		Host:           sim.Host(),
+		Port:           sim.Port(),
+		Username:       sim.Username,
+		Password:       sim.Password,
+		EnablePassword: sim.EnablePassword,
+	}
+	if method == transport.SSH {
+		connect.HostKey = schema.HostKeyPolicy{Mode: schema.HostKeyPinned, Fingerprint: sim.Fingerprint()}
+	}
+	dev, err := transport.New(platform)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.Connect(method, connect); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dev.Disconnect() })
+	return sim, dev
+}
+
+// slow answers "show slow N" after a while
+func slow(command string, term gondisim.Terminal) bool {
+	var n int
+	if _, err := fmt.Sscanf(command, "show slow %d", &n); err != nil {
+		return false
+	}
+	time.Sleep(time.Duration(20) * time.Millisecond)
+	term.Print(fmt.Sprintf("answer %d", n))
+	return true
+}
+
+func TestSession_Concurrent(t *testing.T) {
+	sim, dev := connect(t, transport.Cisco, transport.Telnet, gondisim.WithHandler(slow))
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, err := dev.WriteCapture(fmt.Sprintf("show slow %d", i))
+			assert.NoError(t, err)
+			assert.Equal(t, []string{fmt.Sprintf("answer %d", i), "access1>"}, res)
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, sim.Commands(), 11)
+}
+
+func TestSession_QueueTimeout(t *testing.T) {
+	_, dev := connect(t, transport.Cisco, transport.Telnet, gondisim.WithHandler(slow))
+
+	prompt := regexp.MustCompile("access1>$")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := dev.WriteExpectTimeout("show slow 1", regexp.MustCompile("never$"), time.Duration(300)*time.Millisecond)
+		assert.Error(t, err)
+	}()
+	time.Sleep(time.Duration(50) * time.Millisecond)
+	_, err := dev.WriteExpectTimeout("show slow 2", prompt, time.Duration(50)*time.Millisecond)
+	assert.Equal(t, transport.ErrQueueTimeout, err)
+	<-done
+
+	// the device is free again once the first command gives up
+	res, err := dev.WriteCapture("show slow 3")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"answer 3", "access1>"}, res)
+}
+
+func TestSession_Disconnect(t *testing.T) {
+	_, dev := connect(t, transport.Cisco, transport.Telnet, gondisim.WithHandler(slow))
+
+	done := make(chan error)
+	go func() {
+		_, err := dev.WriteExpectTimeout("show slow 1", regexp.MustCompile("never$"), time.Duration(10)*time.Second)
+		done <- err
+	}()
+	time.Sleep(time.Duration(100) * time.Millisecond)
+	assert.True(t, dev.Disconnect())
+	assert.Equal(t, transport.ErrNotConnected, <-done)
+	assert.False(t, dev.Disconnect())
+
+	_, err := dev.WriteCapture("show version")
+	assert.Equal(t, transport.ErrNotConnected, err)
+}
+
+// paged answers "show paged" with pages, each answered with a space by the device
+func paged(command string, term gondisim.Terminal) bool {
+	if command != "show paged" {
+		return false
+	}
+	for i := 0; i < 50; i++ {
+		term.Print("line --More-- ")
+		time.Sleep(time.Millisecond)
+	}
+	term.Print("done")
+	return true
+}
+
+func TestSession_DisconnectWriting(t *testing.T) {
+	done := regexp.MustCompile("^done")
+	for i := 0; i < 10; i++ {
+		_, dev := connect(t, transport.Cisco, transport.Telnet, gondisim.WithHandler(paged))
+		wg := sync.WaitGroup{}
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			// queued writers, with the one running answering the pages as the streams are closed
+			go func() {
+				defer wg.Done()
+				for {
+					_, err := dev.WriteExpectTimeout("show paged", done, time.Second)
+					if err == transport.ErrNotConnected {
+						return
+					}
+				}
+			}()
+		}
+		time.Sleep(time.Duration(20) * time.Millisecond)
+		assert.True(t, dev.Disconnect())
+		wg.Wait()
+	}
+}
+
+func TestSession_EmptyCommand(t *testing.T) {
+	_, dev := connect(t, transport.Cisco, transport.Telnet)
+	// a bare return redisplays the prompt
+	res, err := dev.WriteCapture("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"access1>"}, res)
+	_, err = dev.Expect(regexp.MustCompile("access1>$"), time.Duration(100)*time.Millisecond)
+	assert.Error(t, err, "nothing is sent, so the prompt isn't shown again")
+}
+
+func TestSession_Resize(t *testing.T) {
+	type resizer interface {
+		Resize(width, height int) error
+	}
+	sim, dev := connect(t, transport.Cisco, transport.SSH)
+	// the size of the definition is requested along with the terminal
+	width, _ := sim.WindowSize()
+	assert.NotZero(t, width)
+
+	assert.NoError(t, dev.(resizer).Resize(132, 50))
+	assert.Eventually(t, func() bool {
+		width, height := sim.WindowSize()
+		return width == 132 && height == 50
+	}, time.Second, time.Duration(10)*time.Millisecond)
+	dev.Disconnect()
+	assert.Equal(t, transport.ErrNotConnected, dev.(resizer).Resize(80, 24))
+
+	// telnet sessions can't be resized
+	_, dev = connect(t, transport.Cisco, transport.Telnet)
+	assert.Equal(t, transport.ErrResizeUnsupported, dev.(resizer).Resize(80, 24))
+}
+
+func TestSession_WriteParse(t *testing.T) {
+	_, dev := connect(t, transport.Cisco, transport.Telnet, gondisim.WithHandler(slow))
+
+	records, err := dev.(transport.Parser).WriteParse("show ip interface brief", nil)
+	assert.NoError(t, err)
+	if assert.Len(t, records, 5) {
+		assert.Equal(t, textfsm.Record{"INTERFACE": "Vlan10", "IP_ADDRESS": "10.0.10.2", "STATUS": "up", "PROTOCOL": "up"}, records[1])
+	}
+
+	template := textfsm.MustParse("Value ANSWER (\\d+)\n\nStart\n  ^answer ${ANSWER}\n")
+	records, err = dev.(transport.Parser).WriteParse("show slow 7", template)
+	assert.NoError(t, err)
+	assert.Equal(t, []textfsm.Record{{"ANSWER": "7"}}, records)
+
+	_, err = dev.(transport.Parser).WriteParse("show clock", nil)
+	assert.Equal(t, textfsm.ErrNoTemplate, err)
+}
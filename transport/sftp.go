@@ -0,0 +1,286 @@
+package transport
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// A client of version 3 of the SFTP protocol, with just enough of it to copy a file each way. The
+// requests are sent one at a time, which is slower than pipelining them but plenty for configs.
+
+const (
+	sftpInit    = 1
+	sftpVersion = 2
+	sftpOpen    = 3
+	sftpClose   = 4
+	sftpRead    = 5
+	sftpWrite   = 6
+	sftpFstat   = 8
+	sftpStatus  = 101
+	sftpHandle  = 102
+	sftpData    = 103
+	sftpAttrs   = 105
+)
+
+// the flags of an open, and of the attributes
+const (
+	sftpFlagRead   = 0x01
+	sftpFlagWrite  = 0x02
+	sftpFlagCreate = 0x08
+	sftpFlagTrunc  = 0x10
+	sftpAttrSize   = 0x01
+)
+
+const (
+	sftpOK  = 0
+	sftpEOF = 1
+)
+
+// sftpChunk is the most data read or written by a request, which every server accepts
+const sftpChunk = 32768
+
+// errNoSFTP is returned when the device doesn't run the sftp subsystem
+var errNoSFTP = errors.New("The device does not support SFTP.")
+
+type sftpClient struct {
+	session *ssh.Session
+	in      io.WriteCloser
+	out     io.Reader
+	id      uint32
+}
+
+// openSFTP starts the sftp subsystem on a new session of the connection, returning errNoSFTP if the
+// device refuses it.
+func openSFTP(client *ssh.Client) (*sftpClient, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	c := &sftpClient{session: session}
+	c.in, _ = session.StdinPipe()
+	c.out, _ = session.StdoutPipe()
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		session.Close()
+		return nil, errNoSFTP
+	}
+	if err := c.send(sftpInit, ssh.Marshal(struct{ Version uint32 }{3})); err != nil {
+		c.Close()
+		return nil, err
+	}
+	typ, _, err := c.receive()
+	if err == nil && typ != sftpVersion {
+		err = fmt.Errorf("Unexpected SFTP packet %d.", typ)
+	}
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close ends the sftp session
+func (c *sftpClient) Close() error {
+	c.in.Close()
+	return c.session.Close()
+}
+
+func (c *sftpClient) send(typ byte, payload []byte) error {
+	packet := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(packet, uint32(1+len(payload)))
+	packet[4] = typ
+	_, err := c.in.Write(append(packet, payload...))
+	return err
+}
+
+func (c *sftpClient) receive() (typ byte, payload []byte, err error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(c.out, header); err != nil {
+		return 0, nil, fmt.Errorf("Unable to read the SFTP response: %s", err)
+	}
+	length := binary.BigEndian.Uint32(header)
+	if length < 1 || length > 4*sftpChunk {
+		return 0, nil, fmt.Errorf("Invalid SFTP packet length %d.", length)
+	}
+	payload = make([]byte, length-1)
+	if _, err := io.ReadFull(c.out, payload); err != nil {
+		return 0, nil, fmt.Errorf("Unable to read the SFTP response: %s", err)
+	}
+	return header[4], payload, nil
+}
+
+// request sends a request with the next id, and returns the type and payload of its response, turning
+// error statuses into errors.
+func (c *sftpClient) request(typ byte, request interface{}) (byte, []byte, error) {
+	c.id++
+	id := make([]byte, 4)
+	binary.BigEndian.PutUint32(id, c.id)
+	if err := c.send(typ, append(id, ssh.Marshal(request)...)); err != nil {
+		return 0, nil, err
+	}
+	typ, payload, err := c.receive()
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(payload) < 4 || binary.BigEndian.Uint32(payload) != c.id {
+		return 0, nil, errors.New("Received an SFTP response to another request.")
+	}
+	payload = payload[4:]
+	if typ == sftpStatus {
+		var status struct {
+			Code    uint32
+			Message string
+			Rest    []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(payload, &status); err != nil && len(payload) < 4 {
+			return 0, nil, errors.New("Received an invalid SFTP status.")
+		} else if err != nil {
+			// old servers send the code alone
+			status.Code = binary.BigEndian.Uint32(payload)
+		}
+		switch status.Code {
+		case sftpOK:
+		case sftpEOF:
+			return typ, nil, io.EOF
+		default:
+			if status.Message == "" {
+				status.Message = fmt.Sprintf("status %d", status.Code)
+			}
+			return typ, nil, fmt.Errorf("The device refused the request: %s", status.Message)
+		}
+	}
+	return typ, payload, nil
+}
+
+// sftpExpect checks the response is of the type
+func sftpExpect(typ, want byte, err error) error {
+	if err == nil && typ != want {
+		return fmt.Errorf("Unexpected SFTP packet %d.", typ)
+	}
+	return err
+}
+
+func (c *sftpClient) open(path string, flags uint32) (handle string, err error) {
+	typ, payload, err := c.request(sftpOpen, struct {
+		Path  string
+		Flags uint32
+		Attrs uint32
+	}{path, flags, 0})
+	if err := sftpExpect(typ, sftpHandle, err); err != nil {
+		return "", err
+	}
+	var h struct{ Handle string }
+	if err := ssh.Unmarshal(payload, &h); err != nil {
+		return "", errors.New("Received an invalid SFTP handle.")
+	}
+	return h.Handle, nil
+}
+
+func (c *sftpClient) close(handle string) error {
+	typ, _, err := c.request(sftpClose, struct{ Handle string }{handle})
+	return sftpExpect(typ, sftpStatus, err)
+}
+
+// size returns the size of the open file, or -1 if the device doesn't say
+func (c *sftpClient) size(handle string) int64 {
+	typ, payload, err := c.request(sftpFstat, struct{ Handle string }{handle})
+	if sftpExpect(typ, sftpAttrs, err) != nil || len(payload) < 12 {
+		return -1
+	}
+	if binary.BigEndian.Uint32(payload)&sftpAttrSize == 0 {
+		return -1
+	}
+	return int64(binary.BigEndian.Uint64(payload[4:]))
+}
+
+func (c *sftpClient) read(handle string, offset int64) ([]byte, error) {
+	typ, payload, err := c.request(sftpRead, struct {
+		Handle string
+		Offset uint64
+		Length uint32
+	}{handle, uint64(offset), sftpChunk})
+	if err := sftpExpect(typ, sftpData, err); err != nil {
+		return nil, err
+	}
+	var d struct{ Data []byte }
+	if err := ssh.Unmarshal(payload, &d); err != nil {
+		return nil, errors.New("Received invalid SFTP data.")
+	}
+	return d.Data, nil
+}
+
+func (c *sftpClient) write(handle string, offset int64, data []byte) error {
+	typ, _, err := c.request(sftpWrite, struct {
+		Handle string
+		Offset uint64
+		Data   []byte
+	}{handle, uint64(offset), data})
+	return sftpExpect(typ, sftpStatus, err)
+}
+
+// sftpUpload writes everything read from r to the remote file, replacing it
+func sftpUpload(client *ssh.Client, r io.Reader, remote string, p *progress) error {
+	c, err := openSFTP(client)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	handle, err := c.open(remote, sftpFlagWrite|sftpFlagCreate|sftpFlagTrunc)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, sftpChunk)
+	var offset int64
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if err := c.write(handle, offset, buf[:n]); err != nil {
+				c.close(handle)
+				return err
+			}
+			offset += int64(n)
+			p.add(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			c.close(handle)
+			return err
+		}
+	}
+	return c.close(handle)
+}
+
+// sftpDownload writes the remote file to w
+func sftpDownload(client *ssh.Client, w io.Writer, remote string, p *progress) error {
+	c, err := openSFTP(client)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	handle, err := c.open(remote, sftpFlagRead)
+	if err != nil {
+		return err
+	}
+	defer c.close(handle)
+	p.total = c.size(handle)
+	var offset int64
+	for {
+		data, err := c.read(handle, offset)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		offset += int64(len(data))
+		p.add(len(data))
+	}
+}
@@ -1,7 +1,9 @@
 package transport
 
 import (
+	"context"
 	"io/ioutil"
+	"net"
 
 	"github.com/morganhein/gondi/schema"
 	"golang.org/x/crypto/ssh"
@@ -20,9 +22,16 @@ func publicKeyFile(file string) ssh.AuthMethod {
 	return ssh.PublicKeys(key)
 }
 
-func CreateSSHConfig(options schema.ConnectOptions) (sshConfig *ssh.ClientConfig) {
+// CreateSSHConfig builds the client configuration for the connect options,
+// including the host key callback that enforces options.HostKey.
+func CreateSSHConfig(options schema.ConnectOptions) (sshConfig *ssh.ClientConfig, err error) {
+	callback, err := hostKeyCallback(options.HostKey)
+	if err != nil {
+		return nil, err
+	}
 	sshConfig = &ssh.ClientConfig{
-		User: options.Username,
+		User:            options.Username,
+		HostKeyCallback: callback,
 	}
 	if options.Password != "" {
 		sshConfig.Auth = []ssh.AuthMethod{
@@ -36,3 +45,32 @@ func CreateSSHConfig(options schema.ConnectOptions) (sshConfig *ssh.ClientConfig
 	}
 	return
 }
+
+// dialSsh connects and completes the SSH handshake, aborting as soon as ctx is cancelled.
+func dialSsh(ctx context.Context, host string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	// closing the connection is the only way to interrupt a handshake in progress
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	c, chans, reqs, err := ssh.NewClientConn(conn, host, config)
+	close(done)
+	if ctx.Err() != nil {
+		conn.Close()
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
@@ -0,0 +1,37 @@
+package transport
+
+import (
+	"context"
+	"net"
+
+	"github.com/morganhein/go-telnet"
+)
+
+// dialTelnet dials the host, returning early with ctx.Err() if the context is cancelled first.
+func dialTelnet(ctx context.Context, host string) (net.Conn, error) {
+	type dialed struct {
+		conn net.Conn
+		err  error
+	}
+	result := make(chan dialed, 1)
+	go func() {
+		conn, err := gote.Dial("tcp", host)
+		if err != nil {
+			result <- dialed{nil, err}
+			return
+		}
+		result <- dialed{conn, nil}
+	}()
+	select {
+	case d := <-result:
+		return d.conn, d.err
+	case <-ctx.Done():
+		// the dial can't be interrupted, so close the connection if it completes after all
+		go func() {
+			if d := <-result; d.err == nil {
+				d.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}